@@ -3,9 +3,11 @@ module github.com/TelephoneTan/GoHTTPServer
 go 1.20
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/TelephoneTan/GoHTTPGzipServer v1.1.2
 	github.com/TelephoneTan/GoLog v0.0.0-20230123123405-22c9b91ea0b0
 	golang.org/x/net v0.9.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -9,4 +9,6 @@ const (
 	Location                  = "Location"
 	AcceptEncoding            = "Accept-Encoding"
 	ContentEncoding           = "Content-Encoding"
+	RetryAfter                = "Retry-After"
+	ETag                      = "ETag"
 )
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"github.com/TelephoneTan/GoHTTPServer/util"
+	"github.com/TelephoneTan/GoLog/log"
+	"net/http"
+	"strings"
+)
+
+// AccessControl 是按客户端 IP 的访问控制列表
+//
+// 列表中的每一项可以是单个 IP、CIDR 或区间，格式与 util.IPRangeSet 相同。
+// 客户端 IP 取 Effective(r).ClientIP，即根据 Container.GetTrustedProxies 还原的客户端 IP
+type AccessControl struct {
+	// 不为空时只允许这些客户端访问
+	Allow []string
+	// 拒绝这些客户端访问，优先于 Allow
+	Deny []string
+	// 拒绝访问时回复的状态码，默认为 403，也可以使用 404 隐藏资源的存在
+	DeniedStatus int
+}
+
+type compiledAccessControl struct {
+	// Allow 和 Deny 都为空时不限制
+	unrestricted bool
+	clients      util.IPRangeSet
+}
+
+func compileAccessControl(ac AccessControl) compiledAccessControl {
+	entries := make([]string, 0, len(ac.Allow)+len(ac.Deny))
+	entries = append(entries, ac.Allow...)
+	for _, entry := range ac.Deny {
+		entries = append(entries, "!"+strings.TrimSpace(entry))
+	}
+	compiled := compiledAccessControl{unrestricted: len(entries) == 0}
+	var err error
+	if compiled.clients, err = util.ParseIPRangeSet(entries...); err != nil {
+		// 列表有误时拒绝所有客户端，以免意外放行
+		log.E("访问控制列表有误：", err)
+		compiled.unrestricted = false
+	}
+	return compiled
+}
+
+// 检查访问控制列表，拒绝访问时作出回复并返回 true
+func checkAccess(w http.ResponseWriter, r *http.Request, getAccessControl func() AccessControl, cache *matcherCache[compiledAccessControl]) bool {
+	if getAccessControl == nil {
+		return false
+	}
+	ac := getAccessControl()
+	compiled := cache.get(listKey(nil).strings(ac.Allow).strings(ac.Deny), func() compiledAccessControl {
+		return compileAccessControl(ac)
+	})
+	if compiled.unrestricted || compiled.clients.Contains(Effective(r).ClientIP) {
+		return false
+	}
+	statusCode := ac.DeniedStatus
+	if statusCode == 0 {
+		statusCode = http.StatusForbidden
+	}
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(statusCode)
+	return true
+}
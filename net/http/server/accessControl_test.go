@@ -0,0 +1,62 @@
+package server
+
+import (
+	"github.com/TelephoneTan/GoHTTPServer/net/http/method"
+	"github.com/TelephoneTan/GoHTTPServer/types"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckAccess(t *testing.T) {
+	tests := []struct {
+		name       string
+		ac         AccessControl
+		remoteAddr string
+		wantStatus int
+	}{
+		{"unrestricted", AccessControl{}, "192.168.0.1:1", http.StatusNoContent},
+		{"allowed", AccessControl{Allow: []string{"10.0.0.0/8"}}, "10.1.2.3:1", http.StatusNoContent},
+		{"not in allow list", AccessControl{Allow: []string{"10.0.0.0/8"}}, "192.168.0.1:1", http.StatusForbidden},
+		{"deny wins over allow", AccessControl{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.0.5"}}, "10.0.0.5:1", http.StatusForbidden},
+		{"only deny", AccessControl{Deny: []string{"10.0.0.5"}}, "192.168.0.1:1", http.StatusNoContent},
+		{"custom status", AccessControl{Deny: []string{"::1"}, DeniedStatus: http.StatusNotFound}, "[::1]:1", http.StatusNotFound},
+		{"invalid list denies", AccessControl{Allow: []string{"10.0.0.0/33"}}, "10.1.2.3:1", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		for _, level := range []string{"server", "node"} {
+			t.Run(tt.name+" on "+level, func(t *testing.T) {
+				ac := tt.ac
+				var recorded int
+				node := NewResourceManager[any](func() types.WordList { return types.WordList{{"api"}} }, nil, func(rm ResourceManager[any]) {
+					rm.Record = func(*http.Request, PathPack) { recorded++ }
+					rm.Guide = map[method.Method]ResourceRequestHandler[any]{
+						method.GET: {
+							Peek:  func(*http.Request, PathPack) (any, bool) { return nil, true },
+							Reply: func(w http.ResponseWriter, _ func() bool, _ any) { w.WriteHeader(http.StatusNoContent) },
+						},
+					}
+					if level == "node" {
+						rm.GetAccessControl = func() AccessControl { return ac }
+					}
+				})
+				s := NewServer(nil, nil, func(s Server) {
+					if level == "server" {
+						s.GetAccessControl = func() AccessControl { return ac }
+					}
+				}).Use(node)
+				r := newLocalRequest("GET", "http://example.com/api")
+				r.RemoteAddr = tt.remoteAddr
+				w := httptest.NewRecorder()
+				s.Handle(w, r)
+				if w.Code != tt.wantStatus {
+					t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+				}
+				// 被节点的访问控制拒绝时同样记录请求
+				if level == "node" && recorded != 1 {
+					t.Errorf("Record called %d times, want 1", recorded)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"github.com/TelephoneTan/GoLog/log"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type AccessLogFormat int
+
+const (
+	// CombinedLogFormat 是 Apache/Nginx 的 Combined Log Format
+	CombinedLogFormat AccessLogFormat = iota
+	// JSONLinesFormat 每行一个 JSON 对象，包含 AccessLogEntry 的全部字段
+	JSONLinesFormat
+)
+
+// AccessLogEntry 是一条访问日志
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	// 客户端 IP 和协议，经过可信代理时为还原后的值，见 Effective
+	ClientIP   string        `json:"clientIP"`
+	Scheme     string        `json:"scheme"`
+	Host       string        `json:"host"`
+	HostPack   *HostPack     `json:"hostPack,omitempty"`
+	Method     string        `json:"method"`
+	Path       string        `json:"path"`
+	RequestURI string        `json:"requestURI"`
+	Proto      string        `json:"proto"`
+	TLSVersion string        `json:"tlsVersion,omitempty"`
+	Status     int           `json:"status"`
+	Size       int64         `json:"size"`
+	Duration   time.Duration `json:"duration"`
+	Referer    string        `json:"referer,omitempty"`
+	UserAgent  string        `json:"userAgent,omitempty"`
+	// 处理该请求的节点链，每个节点为其 WordList.Join()
+	Nodes     []string `json:"nodes,omitempty"`
+	RequestID string   `json:"requestID"`
+	ErrorID   string   `json:"errorID,omitempty"`
+}
+
+type _AccessLog struct {
+	Format AccessLogFormat
+	Writer io.Writer
+	lock   sync.Mutex
+}
+
+// AccessLog 用于记录访问日志，可以设置在 Server 和 Container 上
+//
+// Container 上的 AccessLog 记录所有请求，包括没有被任何 Server 处理的请求；
+// Server 上的 AccessLog 只记录被该 Server 处理的请求
+type AccessLog = *_AccessLog
+
+func NewAccessLog(format AccessLogFormat, writer io.Writer, init ...func(AccessLog)) AccessLog {
+	l := &_AccessLog{
+		Format: format,
+		Writer: writer,
+	}
+	if len(init) > 0 {
+		init[0](l)
+	}
+	return l
+}
+
+func tlsVersionName(state *tls.ConnectionState) string {
+	if state == nil {
+		return ""
+	}
+	switch state.Version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("0x%04X", state.Version)
+	}
+}
+
+func newAccessLogEntry(r *http.Request, state *requestState) AccessLogEntry {
+	effective := Effective(r)
+	entry := AccessLogEntry{
+		Time:       state.start,
+		RemoteAddr: r.RemoteAddr,
+		Scheme:     effective.Scheme,
+		Host:       effective.Host,
+		HostPack:   state.hostInfo,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		RequestURI: r.RequestURI,
+		Proto:      r.Proto,
+		TLSVersion: tlsVersionName(r.TLS),
+		Duration:   time.Since(state.start),
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+		Nodes:      append([]string(nil), state.nodes...),
+		ErrorID:    state.errorID,
+		RequestID:  state.requestID,
+	}
+	if effective.ClientIP != nil {
+		entry.ClientIP = effective.ClientIP.String()
+	}
+	if state.response != nil {
+		entry.Status = state.response.status()
+		entry.Size = state.response.written
+	}
+	if entry.Status == 0 { // 什么都没有写的回复会由 net/http 补上 200
+		entry.Status = http.StatusOK
+	}
+	return entry
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// CombinedLogFormat：%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+func (e AccessLogEntry) combined() string {
+	host := e.ClientIP
+	if host == "" {
+		host = e.RemoteAddr
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+	size := "-"
+	if e.Size > 0 {
+		size = strconv.FormatInt(e.Size, 10)
+	}
+	return fmt.Sprintf(
+		"%s - - [%s] %s %d %s %s %s\n",
+		orDash(host),
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(e.Method+" "+e.RequestURI+" "+e.Proto),
+		e.Status,
+		size,
+		strconv.Quote(orDash(e.Referer)),
+		strconv.Quote(orDash(e.UserAgent)),
+	)
+}
+
+func (l AccessLog) Log(entry AccessLogEntry) {
+	if l == nil || l.Writer == nil {
+		return
+	}
+	var line string
+	switch l.Format {
+	case JSONLinesFormat:
+		bs, err := json.Marshal(entry)
+		if err != nil {
+			log.E("访问日志序列化失败：", err)
+			return
+		}
+		line = string(bs) + "\n"
+	default:
+		line = entry.combined()
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, err := io.WriteString(l.Writer, line); err != nil {
+		log.E("访问日志写入失败：", err)
+	}
+}
+
+func (l AccessLog) log(r *http.Request, state *requestState) {
+	if l == nil || state == nil {
+		return
+	}
+	l.Log(newAccessLogEntry(r, state))
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAccessLogTime = time.Date(2024, 3, 5, 14, 7, 9, 0, time.FixedZone("", 8*60*60))
+
+func TestAccessLogCombined(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry AccessLogEntry
+		want  string
+	}{
+		{
+			name: "all fields",
+			entry: AccessLogEntry{
+				Time:       testAccessLogTime,
+				RemoteAddr: "10.0.0.1:5000",
+				ClientIP:   "203.0.113.7",
+				Method:     "GET",
+				RequestURI: "/index.html?a=1",
+				Proto:      "HTTP/1.1",
+				Status:     200,
+				Size:       1234,
+				Referer:    "https://example.com/",
+				UserAgent:  "curl/8.0",
+			},
+			want: `203.0.113.7 - - [05/Mar/2024:14:07:09 +0800] "GET /index.html?a=1 HTTP/1.1" 200 1234 "https://example.com/" "curl/8.0"` + "\n",
+		},
+		{
+			name: "missing fields",
+			entry: AccessLogEntry{
+				Time:       testAccessLogTime,
+				RemoteAddr: "10.0.0.1:5000",
+				Method:     "HEAD",
+				RequestURI: "/",
+				Proto:      "HTTP/2.0",
+				Status:     304,
+			},
+			want: `10.0.0.1 - - [05/Mar/2024:14:07:09 +0800] "HEAD / HTTP/2.0" 304 - "-" "-"` + "\n",
+		},
+		{
+			name: "no address at all",
+			entry: AccessLogEntry{
+				Time:   testAccessLogTime,
+				Status: 400,
+			},
+			want: `- - - [05/Mar/2024:14:07:09 +0800] "  " 400 - "-" "-"` + "\n",
+		},
+		{
+			name: "escaping",
+			entry: AccessLogEntry{
+				Time:       testAccessLogTime,
+				ClientIP:   "::1",
+				Method:     "GET",
+				RequestURI: `/"quoted"\path`,
+				Proto:      "HTTP/1.1",
+				Status:     404,
+				Size:       9,
+				Referer:    "a\nb",
+				UserAgent:  `Mozilla "evil" 浏览器` + "\x00",
+			},
+			want: `::1 - - [05/Mar/2024:14:07:09 +0800] "GET /\"quoted\"\\path HTTP/1.1" 404 9 "a\nb" "Mozilla \"evil\" 浏览器\x00"` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			NewAccessLog(CombinedLogFormat, &sb).Log(tt.entry)
+			if sb.String() != tt.want {
+				t.Errorf("got  %s\nwant %s", sb.String(), tt.want)
+			}
+			if strings.Count(sb.String(), "\n") != 1 {
+				t.Errorf("line is not a single line: %q", sb.String())
+			}
+		})
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry AccessLogEntry
+		// 必须出现的字段
+		want map[string]any
+		// 必须省略的字段
+		omitted []string
+	}{
+		{
+			name: "all fields",
+			entry: AccessLogEntry{
+				Time:       testAccessLogTime,
+				ClientIP:   "203.0.113.7",
+				Method:     "POST",
+				Path:       "/api",
+				TLSVersion: "TLS 1.3",
+				Status:     500,
+				Size:       12,
+				Duration:   1500 * time.Microsecond,
+				Referer:    "https://example.com/",
+				UserAgent:  "curl/8.0",
+				Nodes:      []string{"api", "v1"},
+				RequestID:  "req-1",
+				ErrorID:    "E#1#2",
+			},
+			want: map[string]any{
+				"time":       "2024-03-05T14:07:09+08:00",
+				"clientIP":   "203.0.113.7",
+				"method":     "POST",
+				"path":       "/api",
+				"tlsVersion": "TLS 1.3",
+				"status":     float64(500),
+				"size":       float64(12),
+				"duration":   float64(1500000),
+				"referer":    "https://example.com/",
+				"userAgent":  "curl/8.0",
+				"nodes":      []any{"api", "v1"},
+				"requestID":  "req-1",
+				"errorID":    "E#1#2",
+			},
+		},
+		{
+			name:  "missing fields",
+			entry: AccessLogEntry{Time: testAccessLogTime, Status: 200},
+			want: map[string]any{
+				"clientIP":  "",
+				"requestID": "",
+				"size":      float64(0),
+			},
+			omitted: []string{"hostPack", "tlsVersion", "referer", "userAgent", "nodes", "errorID"},
+		},
+		{
+			name: "escaping",
+			entry: AccessLogEntry{
+				Time:      testAccessLogTime,
+				Path:      `/"a"\b`,
+				UserAgent: "<script>\n浏览器",
+			},
+			want: map[string]any{
+				"path":      `/"a"\b`,
+				"userAgent": "<script>\n浏览器",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			NewAccessLog(JSONLinesFormat, &sb).Log(tt.entry)
+			line := sb.String()
+			if !strings.HasSuffix(line, "\n") || strings.Count(line, "\n") != 1 {
+				t.Fatalf("line is not a single line: %q", line)
+			}
+			var got map[string]any
+			if err := json.Unmarshal([]byte(line), &got); err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tt.want {
+				value, has := got[key]
+				if !has {
+					t.Errorf("%s is missing", key)
+					continue
+				}
+				gotJSON, _ := json.Marshal(value)
+				wantJSON, _ := json.Marshal(want)
+				if string(gotJSON) != string(wantJSON) {
+					t.Errorf("%s = %s, want %s", key, gotJSON, wantJSON)
+				}
+			}
+			for _, key := range tt.omitted {
+				if _, has := got[key]; has {
+					t.Errorf("%s should be omitted", key)
+				}
+			}
+		})
+	}
+}
+
+func TestAccessLogNil(t *testing.T) {
+	var l AccessLog
+	l.Log(AccessLogEntry{})
+	NewAccessLog(CombinedLogFormat, nil).Log(AccessLogEntry{})
+}
+
+func TestServerAccessLog(t *testing.T) {
+	var sb strings.Builder
+	s := NewServer(nil, nil, func(s Server) {
+		s.GetHosts = func() []string { return []string{"example.com"} }
+		s.Guard = func(w http.ResponseWriter, _ *http.Request, _ *PathPack) bool {
+			_, _ = w.Write([]byte("hello"))
+			return true
+		}
+		s.AccessLog = NewAccessLog(JSONLinesFormat, &sb)
+	})
+	r := newLocalRequest("GET", "https://example.com/a?b=1")
+	r.RequestURI = "/a?b=1"
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.TLS = &tls.ConnectionState{Version: tls.VersionTLS12}
+	r.Header.Set("User-Agent", "test")
+	s.Handle(httptest.NewRecorder(), r)
+	// 不匹配的请求不由该 Server 记录
+	s.Handle(httptest.NewRecorder(), newLocalRequest("GET", "http://other.example/"))
+
+	lines := strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("logged %d lines, want 1: %q", len(lines), sb.String())
+	}
+	var entry AccessLogEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.ClientIP != "192.0.2.1" || entry.Host != "example.com" || entry.Method != "GET" ||
+		entry.Path != "/a" || entry.RequestURI != "/a?b=1" || entry.Status != http.StatusOK ||
+		entry.Size != 5 || entry.TLSVersion != "TLS 1.2" || entry.UserAgent != "test" ||
+		entry.RequestID == "" || entry.HostPack == nil {
+		t.Errorf("entry = %+v", entry)
+	}
+}
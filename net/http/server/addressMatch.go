@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/binary"
+	"github.com/TelephoneTan/GoHTTPServer/util"
+	"github.com/TelephoneTan/GoLog/log"
+	"net"
+	"sync/atomic"
+)
+
+// 由列表内容构成的标识，内容相同的列表得到相同的标识
+type listKey []byte
+
+func (k listKey) appendLen(n int) listKey {
+	return binary.AppendUvarint(k, uint64(n))
+}
+
+func (k listKey) strings(list []string) listKey {
+	k = k.appendLen(len(list))
+	for _, s := range list {
+		k = append(k.appendLen(len(s)), s...)
+	}
+	return k
+}
+
+func (k listKey) ips(list []net.IP) listKey {
+	k = k.appendLen(len(list))
+	for _, ip := range list {
+		k = append(k.appendLen(len(ip)), ip...)
+	}
+	return k
+}
+
+func (k listKey) ports(list []uint16) listKey {
+	k = k.appendLen(len(list))
+	for _, port := range list {
+		k = binary.BigEndian.AppendUint16(k, port)
+	}
+	return k
+}
+
+type matcherCacheEntry[M any] struct {
+	key   string
+	value M
+}
+
+// 由 Get* 函数返回的列表构建的查找结构
+//
+// 按列表内容比较，内容与上次相同时直接复用上次构建的查找结构，否则重新构建，
+// 因此 Get* 函数可以每次返回新的切片，也可以原地修改已经返回过的切片
+type matcherCache[M any] struct {
+	entry atomic.Pointer[matcherCacheEntry[M]]
+}
+
+func (c *matcherCache[M]) get(key listKey, build func() M) M {
+	if entry := c.entry.Load(); entry != nil && entry.key == string(key) {
+		return entry.value
+	}
+	entry := &matcherCacheEntry[M]{key: string(key), value: build()}
+	c.entry.Store(entry)
+	return entry.value
+}
+
+func matchIP(ip net.IP, getValidIPs func() []net.IP, getValidIPRanges func() []string, cache *matcherCache[util.IPRangeSet]) bool {
+	if getValidIPs == nil && getValidIPRanges == nil {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	var ips []net.IP
+	var ranges []string
+	if getValidIPs != nil {
+		ips = getValidIPs()
+	}
+	if getValidIPRanges != nil {
+		ranges = getValidIPRanges()
+	}
+	set := cache.get(listKey(nil).ips(ips).strings(ranges), func() util.IPRangeSet {
+		set, err := util.ParseIPRangeSet(ranges...)
+		if err != nil {
+			log.E("IP 范围有误：", err)
+		}
+		set.AddIPs(ips...)
+		return set
+	})
+	return set.Contains(ip)
+}
+
+func matchPort(port *uint16, getValidPorts func() []uint16, getValidPortRanges func() []string, cache *matcherCache[util.PortSet]) bool {
+	if getValidPorts == nil && getValidPortRanges == nil {
+		return true
+	}
+	if port == nil {
+		return false
+	}
+	var ports []uint16
+	var ranges []string
+	if getValidPorts != nil {
+		ports = getValidPorts()
+	}
+	if getValidPortRanges != nil {
+		ranges = getValidPortRanges()
+	}
+	set := cache.get(listKey(nil).ports(ports).strings(ranges), func() util.PortSet {
+		set, err := util.ParsePortSet(ranges...)
+		if err != nil {
+			log.E("端口范围有误：", err)
+		}
+		set.AddPorts(ports...)
+		return set
+	})
+	return set.Contains(*port)
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"github.com/TelephoneTan/GoHTTPServer/util"
+	"net"
+	"testing"
+)
+
+func TestListKey(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b listKey
+		same bool
+	}{
+		{"equal content", listKey(nil).strings([]string{"a", "b"}), listKey(nil).strings([]string{"a", "b"}), true},
+		{"nil and empty", listKey(nil).strings(nil), listKey(nil).strings([]string{}), true},
+		{"joined strings", listKey(nil).strings([]string{"ab"}), listKey(nil).strings([]string{"a", "b"}), false},
+		{"element moved between lists", listKey(nil).strings([]string{"a"}).strings(nil), listKey(nil).strings(nil).strings([]string{"a"}), false},
+		{"IPv4 and IPv6 forms", listKey(nil).ips([]net.IP{net.ParseIP("10.0.0.1").To4()}), listKey(nil).ips([]net.IP{net.ParseIP("10.0.0.1")}), false},
+		{"ports", listKey(nil).ports([]uint16{80, 443}), listKey(nil).ports([]uint16{80, 443}), true},
+		{"port order", listKey(nil).ports([]uint16{80, 443}), listKey(nil).ports([]uint16{443, 80}), false},
+	}
+	for _, tt := range tests {
+		if same := string(tt.a) == string(tt.b); same != tt.same {
+			t.Errorf("%s: same = %v, want %v", tt.name, same, tt.same)
+		}
+	}
+}
+
+func TestMatchIPFollowsListContent(t *testing.T) {
+	ranges := []string{"10.0.0.0/8"}
+	var ips []net.IP
+	var cache matcherCache[util.IPRangeSet]
+	steps := []struct {
+		name   string
+		update func()
+		ip     string
+		want   bool
+	}{
+		{"initial", func() {}, "10.1.2.3", true},
+		{"modified in place", func() { ranges[0] = "192.168.0.0/16" }, "10.1.2.3", false},
+		{"new slice with same content", func() { ranges = []string{"192.168.0.0/16"} }, "192.168.1.1", true},
+		{"added IP", func() { ips = append(ips, net.ParseIP("10.1.2.3")) }, "10.1.2.3", true},
+		{"IP modified in place", func() { ips[0] = net.ParseIP("10.1.2.4") }, "10.1.2.3", false},
+	}
+	for _, step := range steps {
+		step.update()
+		got := matchIP(net.ParseIP(step.ip), func() []net.IP { return ips }, func() []string { return ranges }, &cache)
+		if got != step.want {
+			t.Errorf("%s: matchIP(%s) = %v, want %v", step.name, step.ip, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"github.com/TelephoneTan/GoHTTPServer/net/http/header"
+	"github.com/TelephoneTan/GoHTTPServer/net/http/method"
+	"github.com/TelephoneTan/GoHTTPServer/net/mime"
+	"github.com/TelephoneTan/GoLog/log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAdminNetwork    = "tcp"
+	defaultAdminAddress    = "127.0.0.1:8999"
+	defaultAdminDrainGrace = 30 * time.Second
+)
+
+type _Admin struct {
+	Container Container
+	// Server 名称 -> Server，用于查看路由表和切换维护模式
+	GetServers func() map[string]Server
+	// 不为空时，请求需要携带 Authorization: Bearer <token>
+	GetToken func() string
+	// 不为空时，管理服务启用 TLS 并要求由这些 CA 签发的客户端证书
+	GetClientCAs func() *x509.CertPool
+	// 管理服务使用的证书选择函数，为空时使用 Container 当前的证书选择函数
+	GetPickSSLCertFunc func() PickSSLCertFunc
+	// 没有指定 grace 参数时，优雅停机的等待时间，默认为 30 秒
+	GetDrainGrace func() time.Duration
+	tlsConfigOnce sync.Once
+	tlsConfig     *tls.Config
+}
+
+// Admin 是运行时查看和控制 Container 的管理接口
+//
+// 必须设置 GetToken 或 GetClientCAs 中的至少一个，否则拒绝所有请求。提供以下接口：
+//
+//	GET  /listeners                             运行中的服务、状态及连接数
+//	GET  /routes[?format=json]                  各 Server 的路由表
+//	GET  /certificates                          使用过的证书及其过期时间
+//	GET  /servers                               各 Server 及其维护模式状态
+//	POST /maintenance?server=NAME&on=true|false 切换 Server 的维护模式
+//	POST /reload                                重新加载配置和证书
+//	POST /drain[?grace=30s]                     开始优雅停机
+type Admin = *_Admin
+
+func NewAdmin(container Container, getServers func() map[string]Server, init ...func(Admin)) Admin {
+	admin := &_Admin{
+		Container:  container,
+		GetServers: getServers,
+	}
+	if len(init) > 0 {
+		init[0](admin)
+	}
+	return admin
+}
+
+func (a Admin) servers() map[string]Server {
+	if a.GetServers == nil {
+		return nil
+	}
+	return a.GetServers()
+}
+
+func (a Admin) serverNames() []string {
+	servers := a.servers()
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (a Admin) authorized(r *http.Request) bool {
+	if a.GetToken != nil {
+		if token := a.GetToken(); token != "" {
+			auth := r.Header.Get("Authorization")
+			if strings.HasPrefix(auth, "Bearer ") &&
+				subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(token)) == 1 {
+				return true
+			}
+		}
+	}
+	if a.GetClientCAs != nil && r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		// 不只依赖握手时的验证，以免管理接口挂在其他 TLS 服务上时接受由其他 CA 签发的证书
+		intermediates := x509.NewCertPool()
+		for _, cert := range r.TLS.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := r.TLS.PeerCertificates[0].Verify(x509.VerifyOptions{
+			Roots:         a.GetClientCAs(),
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		return err == nil
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	bs, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set(header.ContentType, mime.JSON)
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(bs)
+}
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+func (a Admin) handle(m method.Method, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if parsed := method.Parse(r.Method); parsed != m && !(m == method.GET && parsed == method.HEAD) {
+			w.Header().Set("Allow", m.String())
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (a Admin) listeners(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, a.Container.Listeners())
+}
+
+func (a Admin) routes(w http.ResponseWriter, r *http.Request) {
+	servers := a.servers()
+	names := a.serverNames()
+	if r.URL.Query().Get("format") == "json" {
+		tables := map[string]RouteTable{}
+		for _, name := range names {
+			tables[name] = servers[name].Routes()
+		}
+		writeJSON(w, http.StatusOK, tables)
+		return
+	}
+	w.Header().Set(header.ContentType, mime.TextPlainUTF8)
+	for i, name := range names {
+		if i > 0 {
+			_, _ = w.Write([]byte("\n"))
+		}
+		_, _ = w.Write([]byte("# " + name + "\n" + servers[name].Routes().Text()))
+	}
+}
+
+func (a Admin) certificates(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, a.Container.Certificates())
+}
+
+type adminServerInfo struct {
+	Name        string `json:"name"`
+	Maintenance bool   `json:"maintenance"`
+}
+
+func (a Admin) serverList(w http.ResponseWriter, _ *http.Request) {
+	servers := a.servers()
+	list := make([]adminServerInfo, 0, len(servers))
+	for _, name := range a.serverNames() {
+		list = append(list, adminServerInfo{Name: name, Maintenance: servers[name].InMaintenance()})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (a Admin) maintenance(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name := query.Get("server")
+	s, has := a.servers()[name]
+	if !has {
+		writeJSON(w, http.StatusNotFound, adminError{"unknown server " + strconv.Quote(name)})
+		return
+	}
+	on, err := strconv.ParseBool(query.Get("on"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, adminError{"on must be true or false"})
+		return
+	}
+	s.SetMaintenance(on)
+	log.I("【管理】Server ", name, " 维护模式：", on)
+	writeJSON(w, http.StatusOK, adminServerInfo{Name: name, Maintenance: on})
+}
+
+func (a Admin) reload(w http.ResponseWriter, _ *http.Request) {
+	if err := a.Container.Reload(); err != nil {
+		log.E("【管理】重新加载配置失败：", err)
+		writeJSON(w, http.StatusInternalServerError, adminError{err.Error()})
+		return
+	}
+	log.I("【管理】已重新加载配置")
+	writeJSON(w, http.StatusOK, a.Container.Listeners())
+}
+
+func (a Admin) drain(w http.ResponseWriter, r *http.Request) {
+	grace := defaultAdminDrainGrace
+	if a.GetDrainGrace != nil {
+		grace = a.GetDrainGrace()
+	}
+	if s := r.URL.Query().Get("grace"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			writeJSON(w, http.StatusBadRequest, adminError{"invalid grace " + strconv.Quote(s)})
+			return
+		}
+		grace = d
+	}
+	a.Container.Drain(grace)
+	writeJSON(w, http.StatusAccepted, a.Container.Listeners())
+}
+
+func (a Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		if a.GetToken != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/listeners", a.handle(method.GET, a.listeners))
+	mux.HandleFunc("/routes", a.handle(method.GET, a.routes))
+	mux.HandleFunc("/certificates", a.handle(method.GET, a.certificates))
+	mux.HandleFunc("/servers", a.handle(method.GET, a.serverList))
+	mux.HandleFunc("/maintenance", a.handle(method.POST, a.maintenance))
+	mux.HandleFunc("/reload", a.handle(method.POST, a.reload))
+	mux.HandleFunc("/drain", a.handle(method.POST, a.drain))
+	mux.ServeHTTP(w, r)
+}
+
+func (a Admin) pickSSLCert(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if a.GetPickSSLCertFunc != nil {
+		if pickSSL := a.GetPickSSLCertFunc(); pickSSL != nil {
+			return pickSSL(info)
+		}
+	}
+	return a.Container.pickSSLCert(info)
+}
+
+// Service 返回管理服务，可以加入 Container.GetServices 的返回值中
+//
+// network 和 address 为空时监听 tcp 127.0.0.1:8999，也可以使用 Unix 套接字，例如 ("unix", "/run/app/admin.sock")。
+// 设置了 GetClientCAs 时服务启用 TLS 并验证客户端证书
+func (a Admin) Service(network string, address string) Service {
+	if network == "" {
+		network = defaultAdminNetwork
+	}
+	if address == "" {
+		address = defaultAdminAddress
+	}
+	service := Service{
+		Network: network,
+		Address: address,
+		Handler: a,
+	}
+	if a.GetClientCAs != nil {
+		// TLS 配置只创建一次，以免每次 Reload 都重新监听
+		a.tlsConfigOnce.Do(func() {
+			a.tlsConfig = &tls.Config{
+				GetCertificate: a.pickSSLCert,
+				ClientAuth:     tls.RequireAndVerifyClientCert,
+				GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+					return &tls.Config{
+						GetCertificate: a.pickSSLCert,
+						ClientAuth:     tls.RequireAndVerifyClientCert,
+						ClientCAs:      a.GetClientCAs(),
+					}, nil
+				},
+			}
+		})
+		service.UseTLS = true
+		service.TLSConfig = a.tlsConfig
+	}
+	return service
+}
@@ -0,0 +1,288 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// 测试用的 CA
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// 签发证书，usage 为 x509.ExtKeyUsageServerAuth 时证书用于 127.0.0.1
+func (ca *testCA) issue(t *testing.T, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestAdminAuthorization(t *testing.T) {
+	trusted := newTestCA(t, "trusted")
+	other := newTestCA(t, "other")
+	trustedClient := trusted.issue(t, x509.ExtKeyUsageClientAuth)
+	otherClient := other.issue(t, x509.ExtKeyUsageClientAuth)
+	trustedServerCert := trusted.issue(t, x509.ExtKeyUsageServerAuth)
+	tests := []struct {
+		name          string
+		token         string
+		clientCAs     bool
+		authorization string
+		// 客户端证书，为空时不是 TLS 请求，没有 Leaf 时是不带客户端证书的 TLS 请求
+		peer       *tls.Certificate
+		wantStatus int
+	}{
+		{"nothing configured", "", false, "Bearer x", nil, http.StatusUnauthorized},
+		{"missing token", "secret", false, "", nil, http.StatusUnauthorized},
+		{"wrong token", "secret", false, "Bearer guess", nil, http.StatusUnauthorized},
+		{"token prefix", "secret", false, "Bearer secre", nil, http.StatusUnauthorized},
+		{"wrong scheme", "secret", false, "Basic secret", nil, http.StatusUnauthorized},
+		{"right token", "secret", false, "Bearer secret", nil, http.StatusOK},
+		{"trusted client certificate", "", true, "", &trustedClient, http.StatusOK},
+		{"client certificate from another CA", "", true, "", &otherClient, http.StatusUnauthorized},
+		{"server certificate as client certificate", "", true, "", &trustedServerCert, http.StatusUnauthorized},
+		{"TLS without client certificate", "", true, "", &tls.Certificate{}, http.StatusUnauthorized},
+		{"either is enough", "secret", true, "Bearer guess", &trustedClient, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAdmin(NewContainer(nil, nil, nil), nil, func(a Admin) {
+				if tt.token != "" {
+					a.GetToken = func() string { return tt.token }
+				}
+				if tt.clientCAs {
+					a.GetClientCAs = func() *x509.CertPool { return trusted.pool }
+				}
+			})
+			r := httptest.NewRequest("GET", "/servers", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.peer != nil {
+				r.TLS = &tls.ConnectionState{}
+				if tt.peer.Leaf != nil {
+					r.TLS.PeerCertificates = []*x509.Certificate{tt.peer.Leaf}
+				}
+			}
+			w := httptest.NewRecorder()
+			a.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && tt.token != "" && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAdminClientCertificateHandshake(t *testing.T) {
+	trusted := newTestCA(t, "trusted")
+	other := newTestCA(t, "other")
+	serverCert := trusted.issue(t, x509.ExtKeyUsageServerAuth)
+	var services []Service
+	c := NewContainer(func() []Service { return services }, nil, nil, func(c Container) {
+		c.ShouldListenOnDefaultPorts = func() bool { return false }
+	})
+	defer stopContainer(c)
+	a := NewAdmin(c, nil, func(a Admin) {
+		a.GetClientCAs = func() *x509.CertPool { return trusted.pool }
+		a.GetPickSSLCertFunc = func() PickSSLCertFunc {
+			return func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return &serverCert, nil }
+		}
+	})
+	services = []Service{a.Service("tcp", "127.0.0.1:0")}
+	if err := c.apply(); err != nil {
+		t.Fatal(err)
+	}
+	addr := c.running[serviceKey(services[0])].listener.Addr().String()
+	tests := []struct {
+		name    string
+		client  *tls.Certificate
+		wantErr bool
+	}{
+		{"trusted client", func() *tls.Certificate { c := trusted.issue(t, x509.ExtKeyUsageClientAuth); return &c }(), false},
+		{"client from another CA", func() *tls.Certificate { c := other.issue(t, x509.ExtKeyUsageClientAuth); return &c }(), true},
+		{"no client certificate", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &tls.Config{RootCAs: trusted.pool}
+			if tt.client != nil {
+				config.Certificates = []tls.Certificate{*tt.client}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true}}
+			resp, err := client.Get("https://" + addr + "/servers")
+			if err == nil {
+				_ = resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					err = fmt.Errorf("status %s", resp.Status)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GET /servers error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func newTestAdmin(c Container, servers map[string]Server) Admin {
+	return NewAdmin(c, func() map[string]Server { return servers }, func(a Admin) {
+		a.GetToken = func() string { return "secret" }
+	})
+}
+
+func adminRequest(a Admin, method string, target string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, r)
+	return w
+}
+
+func TestAdminMethods(t *testing.T) {
+	a := newTestAdmin(NewContainer(nil, nil, nil), map[string]Server{"www": NewServer(nil, nil)})
+	tests := []struct {
+		method     string
+		target     string
+		wantStatus int
+		wantAllow  string
+	}{
+		{"GET", "/servers", http.StatusOK, ""},
+		{"HEAD", "/servers", http.StatusOK, ""},
+		{"POST", "/servers", http.StatusMethodNotAllowed, "GET"},
+		{"DELETE", "/routes", http.StatusMethodNotAllowed, "GET"},
+		{"GET", "/maintenance?server=www&on=true", http.StatusMethodNotAllowed, "POST"},
+		{"GET", "/drain", http.StatusMethodNotAllowed, "POST"},
+		{"GET", "/reload", http.StatusMethodNotAllowed, "POST"},
+		{"GET", "/unknown", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := adminRequest(a, tt.method, tt.target)
+		if w.Code != tt.wantStatus || w.Header().Get("Allow") != tt.wantAllow {
+			t.Errorf("%s %s = %d (Allow %q), want %d (Allow %q)", tt.method, tt.target, w.Code, w.Header().Get("Allow"), tt.wantStatus, tt.wantAllow)
+		}
+	}
+}
+
+func TestAdminMaintenance(t *testing.T) {
+	www := NewServer(nil, nil, func(s Server) {
+		s.GetMaintenanceOptions = func() MaintenanceOptions { return MaintenanceOptions{} }
+	})
+	a := newTestAdmin(NewContainer(nil, nil, nil), map[string]Server{"www": www})
+	tests := []struct {
+		target          string
+		wantStatus      int
+		wantMaintenance bool
+	}{
+		{"/maintenance?server=www&on=true", http.StatusOK, true},
+		{"/maintenance?server=www&on=maybe", http.StatusBadRequest, true},
+		{"/maintenance?server=api&on=false", http.StatusNotFound, true},
+		{"/maintenance?server=www&on=false", http.StatusOK, false},
+	}
+	for _, tt := range tests {
+		if w := adminRequest(a, "POST", tt.target); w.Code != tt.wantStatus {
+			t.Errorf("POST %s = %d, want %d", tt.target, w.Code, tt.wantStatus)
+		}
+		if www.InMaintenance() != tt.wantMaintenance {
+			t.Errorf("after POST %s: InMaintenance() = %v, want %v", tt.target, www.InMaintenance(), tt.wantMaintenance)
+		}
+	}
+}
+
+func TestAdminDrain(t *testing.T) {
+	services := []Service{{Network: "tcp", Address: "127.0.0.1:0"}}
+	c := NewContainer(func() []Service { return services }, nil, nil, func(c Container) {
+		c.ShouldListenOnDefaultPorts = func() bool { return false }
+	})
+	if err := c.apply(); err != nil {
+		t.Fatal(err)
+	}
+	a := newTestAdmin(c, nil)
+	if w := adminRequest(a, "POST", "/drain?grace=-1s"); w.Code != http.StatusBadRequest {
+		t.Errorf("POST /drain?grace=-1s = %d, want 400", w.Code)
+	}
+	if w := adminRequest(a, "POST", "/drain?grace=soon"); w.Code != http.StatusBadRequest {
+		t.Errorf("POST /drain?grace=soon = %d, want 400", w.Code)
+	}
+	if c.draining.Load() {
+		t.Fatal("invalid grace started draining")
+	}
+	if w := adminRequest(a, "POST", "/drain?grace=0s"); w.Code != http.StatusAccepted {
+		t.Fatalf("POST /drain = %d, want 202", w.Code)
+	}
+	done := make(chan struct{})
+	go func() {
+		c.await()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("services are still running after drain")
+	}
+	if err := c.apply(); err == nil {
+		t.Error("apply() after drain = nil, want an error")
+	}
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"bufio"
+	"github.com/TelephoneTan/GoHTTPServer/net/http/header"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CachePolicy 是一组缓存设置，对应 Cache-Control 和 Vary 头部
+//
+// 时长为 0 时不输出对应的指令；Private 或 NoStore 时不会重定向到 CDN
+type CachePolicy struct {
+	Private   bool
+	NoStore   bool
+	NoCache   bool
+	MaxAge    time.Duration
+	SMaxAge   time.Duration
+	Immutable bool
+	// 缓存过期之后，在此时长内可以先使用旧的回复，同时在后台重新验证
+	StaleWhileRevalidate time.Duration
+	// 追加到 Vary 头部的请求头部名
+	Vary []string
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
+
+// CacheControl 返回 Cache-Control 头部的值
+func (p CachePolicy) CacheControl() string {
+	var directives []string
+	if p.Private {
+		directives = append(directives, "private")
+	}
+	if p.NoStore {
+		directives = append(directives, "no-store")
+	}
+	if p.NoCache {
+		directives = append(directives, "no-cache")
+	}
+	if p.MaxAge > 0 {
+		directives = append(directives, "max-age="+seconds(p.MaxAge))
+	}
+	if p.SMaxAge > 0 && !p.Private {
+		directives = append(directives, "s-maxage="+seconds(p.SMaxAge))
+	}
+	if p.StaleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+seconds(p.StaleWhileRevalidate))
+	}
+	if p.Immutable {
+		directives = append(directives, "immutable")
+	}
+	return strings.Join(directives, ", ")
+}
+
+// 是否可以交给 CDN 等公共缓存
+func (p CachePolicy) public() bool {
+	return !p.Private && !p.NoStore
+}
+
+func (p CachePolicy) apply(w http.ResponseWriter) {
+	if cc := p.CacheControl(); cc != "" {
+		w.Header().Set(header.CacheControl, cc)
+	}
+	addVary(w, p.Vary...)
+}
+
+// 追加 Vary 头部中还没有的值
+func addVary(w http.ResponseWriter, keys ...string) {
+	for _, key := range keys {
+		key = http.CanonicalHeaderKey(strings.TrimSpace(key))
+		if key == "" {
+			continue
+		}
+		has := false
+		for _, value := range w.Header().Values("Vary") {
+			for _, existing := range strings.Split(value, ",") {
+				if existing = strings.TrimSpace(existing); existing == "*" || strings.EqualFold(existing, key) {
+					has = true
+				}
+			}
+		}
+		if !has {
+			w.Header().Add("Vary", key)
+		}
+	}
+}
+
+// CacheRule 是一条缓存规则，各项匹配条件中不为空的都满足时规则生效
+type CacheRule struct {
+	// 请求路径的 glob 模式，语法同 path.Match，另外 ** 可以匹配任意多级目录，例如 /static/**/*.js；不区分大小写
+	Paths []string
+	// 扩展名，例如 .js，不区分大小写
+	Extensions []string
+	// 内容类型，例如 text/css，忽略参数；可以用 image/* 匹配一类
+	ContentTypes []string
+	// 节点链的 glob 模式，节点链是请求经过的各节点的 WordList.Join() 用 / 连接，例如 static/**
+	Nodes  []string
+	Policy CachePolicy
+}
+
+// 匹配 glob 模式，** 匹配任意多级目录
+func matchGlob(pattern string, name string) bool {
+	return matchGlobSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(strings.Trim(name, "/"), "/"))
+}
+
+func matchGlobSegments(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(name); i >= 0; i-- {
+				if matchGlobSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+func matchContentType(pattern string, contentType string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(contentType, pattern[:len(pattern)-1])
+	}
+	return pattern == contentType
+}
+
+// 参与规则匹配的请求信息
+type cacheSubject struct {
+	path        string
+	extension   string
+	contentType string
+	nodes       string
+}
+
+func newCacheSubject(r *http.Request, filePath string, contentType string) cacheSubject {
+	subject := cacheSubject{path: strings.ToLower(r.URL.Path)}
+	if state := getRequestState(r); state != nil {
+		if state.paths != nil {
+			subject.path = strings.ToLower("/" + strings.Join(state.paths.Path, "/"))
+		}
+		subject.nodes = strings.Join(state.nodes, "/")
+	}
+	if filePath == "" {
+		filePath = subject.path
+	}
+	subject.extension = strings.ToLower(filepath.Ext(filePath))
+	if contentType == "" && subject.extension != "" {
+		contentType = mime.TypeByExtension(subject.extension)
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		subject.contentType = mediaType
+	}
+	return subject
+}
+
+func (rule CacheRule) match(subject cacheSubject) bool {
+	if len(rule.Paths) > 0 && !anyMatch(rule.Paths, func(p string) bool { return matchGlob(strings.ToLower(p), subject.path) }) {
+		return false
+	}
+	if len(rule.Extensions) > 0 && !anyMatch(rule.Extensions, func(e string) bool {
+		return strings.EqualFold(strings.TrimPrefix(e, "."), strings.TrimPrefix(subject.extension, "."))
+	}) {
+		return false
+	}
+	if len(rule.ContentTypes) > 0 && !anyMatch(rule.ContentTypes, func(t string) bool { return matchContentType(t, subject.contentType) }) {
+		return false
+	}
+	if len(rule.Nodes) > 0 && !anyMatch(rule.Nodes, func(n string) bool { return matchGlob(n, subject.nodes) }) {
+		return false
+	}
+	return true
+}
+
+func anyMatch(list []string, match func(string) bool) bool {
+	for _, item := range list {
+		if match(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// 按顺序查找第一条匹配的规则
+func (s Server) cachePolicy(subject cacheSubject) (CachePolicy, bool) {
+	if s.GetCacheRules == nil {
+		return CachePolicy{}, false
+	}
+	for _, rule := range s.GetCacheRules() {
+		if rule.match(subject) {
+			return rule.Policy, true
+		}
+	}
+	return CachePolicy{}, false
+}
+
+// cachePolicyWriter 在回复头部发出之前，按照回复的内容类型应用缓存规则；处理函数自己设置了 Cache-Control 时不做改动
+//
+// 通过 exposeOptional 对外暴露，只有被包装的 http.ResponseWriter 实现了的可选接口才可用
+type cachePolicyWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	server  Server
+	applied bool
+}
+
+func (s Server) wrapCachePolicy(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	if s.GetCacheRules == nil || len(s.GetCacheRules()) == 0 {
+		return w
+	}
+	return exposeOptional(&cachePolicyWriter{ResponseWriter: w, r: r, server: s}, w)
+}
+
+// Reply 使用的 toCDN，按请求路径匹配到的缓存规则不允许公共缓存时不重定向到 CDN
+func (s Server) replyToCDN(w http.ResponseWriter, r *http.Request) bool {
+	if policy, ok := s.cachePolicy(newCacheSubject(r, "", "")); ok && !policy.public() {
+		return false
+	}
+	return s.toCDN(w, r)
+}
+
+func (cw *cachePolicyWriter) applyPolicy(statusCode int) {
+	if cw.applied {
+		return
+	}
+	cw.applied = true
+	// 只有成功的回复和 304 需要缓存设置
+	if statusCode >= 300 && statusCode != http.StatusNotModified {
+		return
+	}
+	if cw.Header().Get(header.CacheControl) != "" {
+		return
+	}
+	subject := newCacheSubject(cw.r, "", cw.Header().Get(header.ContentType))
+	if policy, ok := cw.server.cachePolicy(subject); ok {
+		policy.apply(cw.ResponseWriter)
+	}
+}
+
+func (cw *cachePolicyWriter) WriteHeader(statusCode int) {
+	// 1xx 信息性回复不是最终的回复头部
+	if statusCode >= 200 {
+		cw.applyPolicy(statusCode)
+	}
+	cw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (cw *cachePolicyWriter) Write(bs []byte) (int, error) {
+	cw.applyPolicy(http.StatusOK)
+	return cw.ResponseWriter.Write(bs)
+}
+
+func (cw *cachePolicyWriter) Flush() {
+	cw.applyPolicy(http.StatusOK)
+	cw.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (cw *cachePolicyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return cw.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (cw *cachePolicyWriter) Push(target string, opts *http.PushOptions) error {
+	return cw.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+func (cw *cachePolicyWriter) ReadFrom(src io.Reader) (int64, error) {
+	cw.applyPolicy(http.StatusOK)
+	return cw.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+}
+
+// Unwrap 供 http.ResponseController 使用
+func (cw *cachePolicyWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
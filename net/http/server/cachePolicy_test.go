@@ -0,0 +1,214 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"/static/*.js", "/static/app.js", true},
+		{"/static/*.js", "/static/js/app.js", false},
+		{"/static/**/*.js", "/static/app.js", true},
+		{"/static/**/*.js", "/static/a/b/c/app.js", true},
+		{"/static/**/*.js", "/static/a/b/app.css", false},
+		{"/static/**", "/static", true},
+		{"/static/**", "/static/a/b", true},
+		{"/static/**", "/other/a", false},
+		{"**", "/", true},
+		{"**/*.png", "/a/b.png", true},
+		{"/a/**/b/**/c", "/a/x/b/y/z/c", true},
+		{"/a/**/b/**/c", "/a/x/c", false},
+		{"/img/?.png", "/img/a.png", true},
+		{"/img/[0-9].png", "/img/x.png", false},
+		{"/exact", "/exact/", true},
+		{"static/**", "static/assets/js", true},
+		{"/a/*", "/a", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCacheRuleMatch(t *testing.T) {
+	subject := cacheSubject{path: "/static/js/app.js", extension: ".js", contentType: "text/javascript", nodes: "static/js"}
+	tests := []struct {
+		name string
+		rule CacheRule
+		want bool
+	}{
+		{"empty rule", CacheRule{}, true},
+		{"path case insensitive", CacheRule{Paths: []string{"/STATIC/**"}}, true},
+		{"path mismatch", CacheRule{Paths: []string{"/api/**"}}, false},
+		{"any path", CacheRule{Paths: []string{"/api/**", "/static/**"}}, true},
+		{"extension without dot", CacheRule{Extensions: []string{"JS"}}, true},
+		{"extension mismatch", CacheRule{Extensions: []string{".css"}}, false},
+		{"content type", CacheRule{ContentTypes: []string{"text/javascript"}}, true},
+		{"content type wildcard", CacheRule{ContentTypes: []string{"text/*"}}, true},
+		{"content type mismatch", CacheRule{ContentTypes: []string{"image/*"}}, false},
+		{"nodes", CacheRule{Nodes: []string{"static/**"}}, true},
+		{"all conditions must match", CacheRule{Paths: []string{"/static/**"}, Extensions: []string{".css"}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.match(subject); got != tt.want {
+			t.Errorf("%s: match() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	tests := []struct {
+		policy CachePolicy
+		want   string
+	}{
+		{CachePolicy{}, ""},
+		{CachePolicy{MaxAge: time.Hour, SMaxAge: 2 * time.Hour}, "max-age=3600, s-maxage=7200"},
+		{CachePolicy{Private: true, MaxAge: 1500 * time.Millisecond, SMaxAge: time.Hour}, "private, max-age=2"},
+		{CachePolicy{NoStore: true, NoCache: true}, "no-store, no-cache"},
+		{CachePolicy{MaxAge: time.Minute, StaleWhileRevalidate: time.Second, Immutable: true}, "max-age=60, stale-while-revalidate=1, immutable"},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.CacheControl(); got != tt.want {
+			t.Errorf("CacheControl(%+v) = %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func newCacheTestServer(rules []CacheRule) Server {
+	return NewServer(nil, nil, func(s Server) {
+		s.GetCDNHost = func() string { return "cdn.example.com" }
+		s.GetCDNOriginHosts = func() []string { return []string{"origin.example.com"} }
+		s.GetCacheRules = func() []CacheRule { return rules }
+	})
+}
+
+func TestHandleFileCachePolicy(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.js")
+	if err := os.WriteFile(file, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	public := CachePolicy{MaxAge: time.Hour, SMaxAge: 2 * time.Hour}
+	tests := []struct {
+		name             string
+		rules            []CacheRule
+		privateOrNoCDN   bool
+		wantStatus       int
+		wantCacheControl string
+	}{
+		{"public rule redirects to CDN", []CacheRule{{Policy: public}}, false, http.StatusTemporaryRedirect, ""},
+		{"private file with public rule", []CacheRule{{Policy: public}}, true, http.StatusOK, "private, max-age=3600"},
+		{"private rule", []CacheRule{{Policy: CachePolicy{Private: true, MaxAge: time.Minute}}}, false, http.StatusOK, "private, max-age=60"},
+		{"no rule and private file", []CacheRule{{Extensions: []string{".css"}, Policy: public}}, true, http.StatusOK, "private"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCacheTestServer(tt.rules)
+			w := httptest.NewRecorder()
+			s.HandleFile(w, newLocalRequest("GET", "http://www.example.com/app.js"), file, tt.privateOrNoCDN)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Cache-Control"); got != tt.wantCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCacheControl)
+			}
+		})
+	}
+}
+
+func TestReplyToCDN(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy CachePolicy
+		want   bool
+	}{
+		{"public", CachePolicy{MaxAge: time.Hour}, true},
+		{"private", CachePolicy{Private: true}, false},
+		{"no-store", CachePolicy{NoStore: true}, false},
+	}
+	for _, tt := range tests {
+		s := newCacheTestServer([]CacheRule{{Paths: []string{"/api/**"}, Policy: tt.policy}})
+		w := httptest.NewRecorder()
+		if got := s.replyToCDN(w, newLocalRequest("GET", "http://www.example.com/api/me")); got != tt.want {
+			t.Errorf("%s: replyToCDN() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	// 没有匹配的规则时照常重定向
+	s := newCacheTestServer([]CacheRule{{Paths: []string{"/api/**"}, Policy: CachePolicy{Private: true}}})
+	if !s.replyToCDN(httptest.NewRecorder(), newLocalRequest("GET", "http://www.example.com/static/a.js")) {
+		t.Error("replyToCDN() = false without a matching rule")
+	}
+}
+
+func TestCachePolicyWriter(t *testing.T) {
+	s := newCacheTestServer([]CacheRule{{ContentTypes: []string{"text/css"}, Policy: CachePolicy{MaxAge: time.Minute}}})
+	tests := []struct {
+		name  string
+		inner http.ResponseWriter
+		// 通过 w 作出回复
+		reply            func(w http.ResponseWriter)
+		wantCacheControl string
+		flusher          bool
+		readerFrom       bool
+	}{
+		{"write", httptest.NewRecorder(), func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/css")
+			_, _ = w.Write([]byte("a{}"))
+		}, "max-age=60", true, false},
+		{"handler sets Cache-Control", httptest.NewRecorder(), func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/css")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusOK)
+		}, "no-store", true, false},
+		{"error status", httptest.NewRecorder(), func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/css")
+			w.WriteHeader(http.StatusNotFound)
+		}, "", true, false},
+		{"other content type", httptest.NewRecorder(), func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusOK)
+		}, "", true, false},
+		{"flush", httptest.NewRecorder(), func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/css")
+			w.(http.Flusher).Flush()
+		}, "max-age=60", true, false},
+		{"read from", &readerFromResponseWriter{}, func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/css")
+			_, _ = w.(io.ReaderFrom).ReadFrom(bytes.NewReader([]byte("a{}")))
+		}, "max-age=60", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.wrapCachePolicy(tt.inner, newLocalRequest("GET", "http://www.example.com/a"))
+			if _, ok := w.(http.Flusher); ok != tt.flusher {
+				t.Errorf("http.Flusher = %v, want %v", ok, tt.flusher)
+			}
+			if _, ok := w.(io.ReaderFrom); ok != tt.readerFrom {
+				t.Errorf("io.ReaderFrom = %v, want %v", ok, tt.readerFrom)
+			}
+			// 底层不支持时不暴露
+			if _, ok := w.(http.Hijacker); ok {
+				t.Error("http.Hijacker is exposed")
+			}
+			if _, ok := w.(http.Pusher); ok {
+				t.Error("http.Pusher is exposed")
+			}
+			tt.reply(w)
+			if got := tt.inner.Header().Get("Cache-Control"); got != tt.wantCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCacheControl)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/TelephoneTan/GoHTTPServer/util"
+	"github.com/TelephoneTan/GoLog/log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CDNSignType 是 CDN 重定向 URL 的签名形式，参照常见 CDN 的鉴权方式 A、B、C
+type CDNSignType int
+
+const (
+	// 签名放在一个查询参数中：?auth_key={expires}-{rand}-{uid}-{signature}，过期时间为十进制 Unix 时间戳；
+	// 生成时 rand 固定为 0，使同一分钟内生成的 URL 相同，验证时接受任意 rand
+	CDNSignTypeA CDNSignType = iota
+	// 签名放在路径前：/{expires}/{signature}/path，过期时间为十进制 Unix 时间戳
+	CDNSignTypeB
+	// 签名和过期时间分别放在两个查询参数中：?sign={signature}&t={expires}，过期时间为十六进制 Unix 时间戳
+	CDNSignTypeC
+)
+
+func (t CDNSignType) String() string {
+	switch t {
+	case CDNSignTypeA:
+		return "A"
+	case CDNSignTypeB:
+		return "B"
+	case CDNSignTypeC:
+		return "C"
+	}
+	return "CDNSignType(" + strconv.Itoa(int(t)) + ")"
+}
+
+const (
+	defaultCDNSignTTL          = time.Hour
+	defaultCDNSignParamA       = "auth_key"
+	defaultCDNSignParamC       = "sign"
+	defaultCDNSignExpiresParam = "t"
+	defaultCDNSignUID          = "0"
+	defaultCDNSignRand         = "0"
+)
+
+// CDNSignOptions 是 CDN 重定向 URL 的签名设置
+//
+// 签名是 HMAC-SHA256(密钥, 路径-过期时间) 的十六进制形式，Type A 还包括 -{rand}-{uid}；路径为转义后的形式，不包括查询参数。
+// CDN 应当设置为在缓存键中忽略签名参数（Type B 则是忽略路径前缀），否则每个签名都会回源一次；
+// 回源请求必须保留签名参数和 Type B 的路径前缀，否则验证失败
+type CDNSignOptions struct {
+	// 签名密钥，第一个用于签名，全部用于验证，以便轮换密钥；为空时不签名也不验证
+	Keys []string
+	Type CDNSignType
+	// 签名的有效期，0 视为 1 小时；过期时间向上取整到分钟，同一分钟内生成的 URL 相同
+	TTL time.Duration
+	// Type A 的参数名，默认为 auth_key；Type C 的签名参数名，默认为 sign
+	SignParam string
+	// Type C 的过期时间参数名，默认为 t
+	ExpiresParam string
+	// 验证失败时回复的状态码，默认为 403
+	DeniedStatus int
+}
+
+func (o CDNSignOptions) enabled() bool {
+	return len(o.Keys) > 0 && o.Keys[0] != ""
+}
+
+func (o CDNSignOptions) signParam() string {
+	if o.SignParam != "" {
+		return o.SignParam
+	}
+	if o.Type == CDNSignTypeC {
+		return defaultCDNSignParamC
+	}
+	return defaultCDNSignParamA
+}
+
+func (o CDNSignOptions) expiresParam() string {
+	if o.ExpiresParam != "" {
+		return o.ExpiresParam
+	}
+	return defaultCDNSignExpiresParam
+}
+
+func cdnSignature(key string, parts ...string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(strings.Join(parts, "-")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func appendQuery(query string, param string) string {
+	if query == "" {
+		return param
+	}
+	return query + "&" + param
+}
+
+// 为 uri（转义后的路径，可以带有查询参数）加上签名
+func (o CDNSignOptions) sign(uri string, now time.Time) string {
+	ttl := o.TTL
+	if ttl <= 0 {
+		ttl = defaultCDNSignTTL
+	}
+	expires := now.Add(ttl).Add(time.Minute - time.Nanosecond).Truncate(time.Minute).Unix()
+	path, query, _ := strings.Cut(uri, "?")
+	key := o.Keys[0]
+	switch o.Type {
+	case CDNSignTypeB:
+		ts := strconv.FormatInt(expires, 10)
+		path = "/" + ts + "/" + cdnSignature(key, path, ts) + path
+	case CDNSignTypeC:
+		ts := strconv.FormatInt(expires, 16)
+		query = appendQuery(query,
+			url.QueryEscape(o.signParam())+"="+cdnSignature(key, path, ts)+
+				"&"+url.QueryEscape(o.expiresParam())+"="+ts)
+	default:
+		ts := strconv.FormatInt(expires, 10)
+		query = appendQuery(query, url.QueryEscape(o.signParam())+"="+
+			strings.Join([]string{ts, defaultCDNSignRand, defaultCDNSignUID, cdnSignature(key, path, ts, defaultCDNSignRand, defaultCDNSignUID)}, "-"))
+	}
+	if query == "" {
+		return path
+	}
+	return path + "?" + query
+}
+
+func (o CDNSignOptions) validSignature(signature string, parts ...string) bool {
+	for _, key := range o.Keys {
+		if key != "" && hmac.Equal([]byte(signature), []byte(cdnSignature(key, parts...))) {
+			return true
+		}
+	}
+	return false
+}
+
+// 验证 r 的签名，对于 Type B 还返回去掉签名前缀之后的（未转义的）路径
+func (o CDNSignOptions) verify(r *http.Request, now time.Time) (path string, ok bool) {
+	path = r.URL.Path
+	rawPath := r.URL.EscapedPath()
+	var ts, signature string
+	var expires int64
+	var err error
+	switch o.Type {
+	case CDNSignTypeB:
+		parts := strings.SplitN(rawPath, "/", 4)
+		if len(parts) < 4 || parts[0] != "" {
+			return path, false
+		}
+		ts, signature, rawPath = parts[1], parts[2], "/"+parts[3]
+		if expires, err = strconv.ParseInt(ts, 10, 64); err != nil {
+			return path, false
+		}
+		if !o.validSignature(signature, rawPath, ts) {
+			return path, false
+		}
+		// 签名前缀只由数字和十六进制字符组成，转义前后长度相同
+		path = path[len(ts)+len(signature)+2:]
+	case CDNSignTypeC:
+		query := r.URL.Query()
+		ts, signature = query.Get(o.expiresParam()), query.Get(o.signParam())
+		if expires, err = strconv.ParseInt(ts, 16, 64); err != nil {
+			return path, false
+		}
+		if !o.validSignature(signature, rawPath, ts) {
+			return path, false
+		}
+	default:
+		parts := strings.Split(r.URL.Query().Get(o.signParam()), "-")
+		if len(parts) != 4 {
+			return path, false
+		}
+		ts, signature = parts[0], parts[3]
+		if expires, err = strconv.ParseInt(ts, 10, 64); err != nil {
+			return path, false
+		}
+		if !o.validSignature(signature, rawPath, ts, parts[1], parts[2]) {
+			return path, false
+		}
+	}
+	return path, now.Unix() <= expires
+}
+
+func (s Server) cdnSignOptions() CDNSignOptions {
+	if s.GetCDNSignOptions == nil {
+		return CDNSignOptions{}
+	}
+	return s.GetCDNSignOptions()
+}
+
+// 对来自 CDN 回源主机的请求验证签名，验证失败时回复 DeniedStatus 并返回 denied 为 true
+//
+// 返回的 path 是用于路由的请求路径，Type B 的签名前缀已被去掉
+func (s Server) checkCDNSignature(w http.ResponseWriter, r *http.Request) (path string, denied bool) {
+	options := s.cdnSignOptions()
+	if !options.enabled() || !util.MatchCDNOriginHost(r, s.GetCDNOriginHosts) {
+		return r.URL.Path, false
+	}
+	path, ok := options.verify(r, time.Now())
+	if ok {
+		return path, false
+	}
+	log.W("CDN 回源请求的签名无效或已过期：", r.RequestURI)
+	status := options.DeniedStatus
+	if status == 0 {
+		status = http.StatusForbidden
+	}
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(status)
+	return path, true
+}
+
+// 重定向到 CDN 时使用的 URI：设置了签名时为加上签名的 r.URL.RequestURI()，否则为 r.RequestURI
+func (s Server) cdnRedirectURI(r *http.Request) string {
+	if !s.cdnSignOptions().enabled() {
+		return r.RequestURI
+	}
+	return s.signCDNURI(r.URL.RequestURI())
+}
+
+// 为 CDN 重定向的 uri 加上签名，没有设置签名时原样返回
+func (s Server) signCDNURI(uri string) string {
+	options := s.cdnSignOptions()
+	if !options.enabled() {
+		return uri
+	}
+	return options.sign(uri, time.Now())
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCDNSignVerify(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 15, 0, time.UTC)
+	tests := []struct {
+		name    string
+		options CDNSignOptions
+		uri     string
+		// 修改签名之后的 URI，为 nil 时不修改
+		tamper   func(signed string) string
+		verifyAt time.Time
+		wantOK   bool
+		wantPath string
+	}{
+		{"A round trip", CDNSignOptions{Keys: []string{"k"}}, "/a/b.js?v=1", nil, now, true, "/a/b.js"},
+		{"B round trip", CDNSignOptions{Keys: []string{"k"}, Type: CDNSignTypeB}, "/a/b.js", nil, now, true, "/a/b.js"},
+		{"C round trip", CDNSignOptions{Keys: []string{"k"}, Type: CDNSignTypeC}, "/a/b.js?v=1", nil, now, true, "/a/b.js"},
+		{"B strips escaped prefix", CDNSignOptions{Keys: []string{"k"}, Type: CDNSignTypeB}, "/%E6%96%87%E4%BB%B6/a%20b.js", nil, now, true, "/文件/a b.js"},
+		{"custom params", CDNSignOptions{Keys: []string{"k"}, Type: CDNSignTypeC, SignParam: "s", ExpiresParam: "e"}, "/x", nil, now, true, "/x"},
+		{"A expired", CDNSignOptions{Keys: []string{"k"}, TTL: time.Minute}, "/x", nil, now.Add(3 * time.Minute), false, "/x"},
+		{"B expired", CDNSignOptions{Keys: []string{"k"}, Type: CDNSignTypeB, TTL: time.Minute}, "/x", nil, now.Add(3 * time.Minute), false, "/x"},
+		{"C expired", CDNSignOptions{Keys: []string{"k"}, Type: CDNSignTypeC, TTL: time.Minute}, "/x", nil, now.Add(3 * time.Minute), false, "/x"},
+		{"expires rounds up to the minute", CDNSignOptions{Keys: []string{"k"}, TTL: time.Minute}, "/x", nil, now.Add(105 * time.Second), true, "/x"},
+		{"A other path", CDNSignOptions{Keys: []string{"k"}}, "/x", func(s string) string { return strings.Replace(s, "/x", "/y", 1) }, now, false, "/y"},
+		{"B other path", CDNSignOptions{Keys: []string{"k"}, Type: CDNSignTypeB}, "/x", func(s string) string { return strings.TrimSuffix(s, "/x") + "/y" }, now, false, ""},
+		{"C extended expiry", CDNSignOptions{Keys: []string{"k"}, Type: CDNSignTypeC}, "/x", func(s string) string { return s + "0" }, now, false, "/x"},
+		{"A missing signature", CDNSignOptions{Keys: []string{"k"}}, "/x", func(string) string { return "/x" }, now, false, "/x"},
+		{"B missing prefix", CDNSignOptions{Keys: []string{"k"}, Type: CDNSignTypeB}, "/x", func(string) string { return "/x" }, now, false, "/x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := tt.options.sign(tt.uri, now)
+			if tt.tamper != nil {
+				signed = tt.tamper(signed)
+			}
+			path, ok := tt.options.verify(httptest.NewRequest("GET", signed, nil), tt.verifyAt)
+			if ok != tt.wantOK {
+				t.Fatalf("verify(%s) = %v, want %v", signed, ok, tt.wantOK)
+			}
+			if tt.wantPath != "" && path != tt.wantPath {
+				t.Errorf("verify(%s) path = %q, want %q", signed, path, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestCDNSignIsStableWithinAMinute(t *testing.T) {
+	for _, signType := range []CDNSignType{CDNSignTypeA, CDNSignTypeB, CDNSignTypeC} {
+		options := CDNSignOptions{Keys: []string{"k"}, Type: signType}
+		now := time.Date(2024, 5, 1, 12, 30, 1, 0, time.UTC)
+		if a, b := options.sign("/x", now), options.sign("/x", now.Add(58*time.Second)); a != b {
+			t.Errorf("type %s: %s != %s", signType, a, b)
+		}
+	}
+}
+
+func TestCDNSignKeyRotation(t *testing.T) {
+	now := time.Now()
+	signed := CDNSignOptions{Keys: []string{"old"}}.sign("/x", now)
+	tests := []struct {
+		name string
+		keys []string
+		want bool
+	}{
+		{"old key still accepted", []string{"new", "old"}, true},
+		{"old key removed", []string{"new"}, false},
+		{"empty key ignored", []string{"new", ""}, false},
+	}
+	for _, tt := range tests {
+		if _, ok := (CDNSignOptions{Keys: tt.keys}).verify(httptest.NewRequest("GET", signed, nil), now); ok != tt.want {
+			t.Errorf("%s: verify() = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+}
+
+func TestCDNSignatureCheckedAfterMaintenanceAndAccessControl(t *testing.T) {
+	tests := []struct {
+		name        string
+		maintenance bool
+		deny        bool
+		wantStatus  int
+	}{
+		{"signature", false, false, http.StatusForbidden},
+		{"maintenance first", true, false, http.StatusServiceUnavailable},
+		{"access control first", false, true, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(nil, nil, func(s Server) {
+				s.GetCDNOriginHosts = func() []string { return []string{"origin.example.com"} }
+				s.GetCDNSignOptions = func() CDNSignOptions { return CDNSignOptions{Keys: []string{"k"}} }
+				s.GetMaintenanceOptions = func() MaintenanceOptions { return MaintenanceOptions{} }
+				if tt.deny {
+					s.GetAccessControl = func() AccessControl {
+						return AccessControl{Deny: []string{"192.0.2.1"}, DeniedStatus: http.StatusNotFound}
+					}
+				}
+			})
+			s.SetMaintenance(tt.maintenance)
+			r := newLocalRequest("GET", "http://origin.example.com/x")
+			r.RemoteAddr = "192.0.2.1:1"
+			w := httptest.NewRecorder()
+			s.Handle(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code == http.StatusForbidden && w.Header().Get("Content-Length") != "0" {
+				t.Errorf("Content-Length = %q, want 0", w.Header().Get("Content-Length"))
+			}
+		})
+	}
+}
+
+func TestCDNRedirectLocation(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		// Location 应当带有的前缀，签名的部分每分钟都会变化
+		wantPrefix string
+	}{
+		{"unsigned keeps the request URI", nil, "//cdn.example.com/a%2Fb/c%2fd?x=1&y"},
+		{"signed", []string{"k"}, "//cdn.example.com/a%2Fb/c%2fd?x=1&y&auth_key="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(nil, nil, func(s Server) {
+				s.GetCDNHost = func() string { return "cdn.example.com" }
+				s.GetCDNOriginHosts = func() []string { return []string{"origin.example.com"} }
+				s.GetCDNSignOptions = func() CDNSignOptions { return CDNSignOptions{Keys: tt.keys} }
+			})
+			r := httptest.NewRequest("GET", "http://www.example.com/a%2Fb/c%2fd?x=1&y", nil)
+			r.RequestURI = "/a%2Fb/c%2fd?x=1&y"
+			w := httptest.NewRecorder()
+			if !s.toCDN(w, r) {
+				t.Fatal("toCDN() = false")
+			}
+			if location := w.Header().Get("Location"); !strings.HasPrefix(location, tt.wantPrefix) || tt.keys == nil && location != tt.wantPrefix {
+				t.Errorf("Location = %q, want prefix %q", location, tt.wantPrefix)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CertificateInfo 描述一张在握手中使用过的证书
+type CertificateInfo struct {
+	Subject  string    `json:"subject"`
+	DNSNames []string  `json:"dnsNames,omitempty"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"notAfter"`
+	// 距离过期的天数，已过期时为负数
+	DaysLeft int `json:"daysLeft"`
+}
+
+// 记录证书选择函数选出的证书，Reload 时清空
+type certificateRecorder struct {
+	lock sync.Mutex
+	// 以证书的 DER 编码为键，证书选择函数每次返回新的 tls.Certificate 时也不会重复
+	certs map[string]*x509.Certificate
+}
+
+func (cr *certificateRecorder) record(cert *tls.Certificate) {
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+	if len(cert.Certificate) == 0 {
+		return
+	}
+	if _, has := cr.certs[string(cert.Certificate[0])]; has {
+		return
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return
+		}
+	}
+	if cr.certs == nil {
+		cr.certs = map[string]*x509.Certificate{}
+	}
+	cr.certs[string(cert.Certificate[0])] = leaf
+}
+
+func (cr *certificateRecorder) reset() {
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+	cr.certs = nil
+}
+
+// Certificates 返回自上次 Reload 以来在握手中使用过的证书，按过期时间排序
+//
+// 证书选择函数是按需选择证书的，因此只有被客户端请求过的证书才会出现在这里
+func (c Container) Certificates() []CertificateInfo {
+	c.certificates.lock.Lock()
+	defer c.certificates.lock.Unlock()
+	now := time.Now()
+	list := make([]CertificateInfo, 0, len(c.certificates.certs))
+	for _, leaf := range c.certificates.certs {
+		list = append(list, CertificateInfo{
+			Subject:  leaf.Subject.String(),
+			DNSNames: leaf.DNSNames,
+			Issuer:   leaf.Issuer.String(),
+			NotAfter: leaf.NotAfter,
+			DaysLeft: int(leaf.NotAfter.Sub(now).Hours() / 24),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].NotAfter.Before(list[j].NotAfter)
+	})
+	return list
+}
@@ -0,0 +1,587 @@
+package config
+
+import (
+	"fmt"
+	"github.com/TelephoneTan/GoHTTPServer/net/http/method"
+	"github.com/TelephoneTan/GoHTTPServer/net/http/server"
+	"github.com/TelephoneTan/GoHTTPServer/types"
+	"github.com/TelephoneTan/GoHTTPServer/util"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Guide 是配置节点可以引用的处理函数集合，配置构建的节点的 PACK 类型为 any
+type Guide = map[method.Method]server.ResourceRequestHandler[any]
+
+// Bindings 提供配置文件中按名称引用的代码对象
+type Bindings struct {
+	// 名称 -> 处理函数，节点的 handler 字段引用；没有 handler 字段时按节点的 name 查找
+	Guides map[string]Guide
+	// 名称 -> 代码定义的节点，节点的 mount 字段引用
+	Nodes map[string]server.ResourceManagerI
+	// 名称 -> 守卫，Server 的 guard 字段引用
+	Guards map[string]func(http.ResponseWriter, *http.Request, *server.PathPack) bool
+	// Container 使用的 HandleFunc，为空时使用 Result.Dispatcher()
+	HandleFunc server.HandleFunc
+	// Container 使用的证书选择函数
+	PickSSLCertFunc server.PickSSLCertFunc
+}
+
+// Result 是根据配置构建的结果
+//
+// Update 会替换 Server 列表，因此通过 Servers、Server 和 Dispatcher 方法读取当前的结果，可以与 Update 并发调用
+type Result struct {
+	Container  server.Container
+	bindings   Bindings
+	current    atomic.Pointer[snapshot]
+	updateLock sync.Mutex
+}
+
+// Servers 返回当前的 Server，按配置中的顺序排列
+func (r *Result) Servers() []server.Server {
+	return util.ShallowCloneSlice(r.current.Load().servers)
+}
+
+// Server 返回当前名为 name 的 Server，没有时返回 nil
+func (r *Result) Server(name string) server.Server {
+	return r.current.Load().named[name]
+}
+
+// Dispatcher 返回当前的 Dispatcher，它按配置中的优先级和默认 Server 分发请求到 Servers
+func (r *Result) Dispatcher() server.Dispatcher {
+	return r.current.Load().dispatcher
+}
+
+func buildCDNSign(cfg *CDNSignConfig, path string, pos position) (func() server.CDNSignOptions, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if len(cfg.Keys) == 0 || cfg.Keys[0] == "" {
+		return nil, pos.errorf(path+".cdnSign.keys", "cdnSign needs at least one key")
+	}
+	options := server.CDNSignOptions{
+		Keys:         cfg.Keys,
+		SignParam:    cfg.SignParam,
+		ExpiresParam: cfg.ExpiresParam,
+		DeniedStatus: cfg.DeniedStatus,
+	}
+	switch strings.ToUpper(cfg.Type) {
+	case "", "A":
+		options.Type = server.CDNSignTypeA
+	case "B":
+		options.Type = server.CDNSignTypeB
+	case "C":
+		options.Type = server.CDNSignTypeC
+	default:
+		return nil, pos.errorf(path+".cdnSign.type", "unknown cdnSign type %q", cfg.Type)
+	}
+	if cfg.TTL != "" {
+		ttl, err := time.ParseDuration(cfg.TTL)
+		if err != nil || ttl <= 0 {
+			return nil, pos.errorf(path+".cdnSign.ttl", "invalid ttl %q", cfg.TTL)
+		}
+		options.TTL = ttl
+	}
+	if status := cfg.DeniedStatus; status != 0 && (status < 400 || status > 599) {
+		return nil, pos.errorf(path+".cdnSign.deniedStatus", "invalid denied status %d", status)
+	}
+	return func() server.CDNSignOptions { return options }, nil
+}
+
+func parseDuration(s string, path string, pos position) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, pos.errorf(path, "invalid duration %q", s)
+	}
+	return d, nil
+}
+
+func validGlob(pattern string) bool {
+	_, err := filepath.Match(pattern, "")
+	return err == nil
+}
+
+func buildCacheRules(cfg []CacheRuleConfig, path string, pos position) (func() []server.CacheRule, error) {
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+	rules := make([]server.CacheRule, 0, len(cfg))
+	for i, rc := range cfg {
+		rulePath := fmt.Sprintf("%s.cache[%d]", path, i)
+		rule := server.CacheRule{
+			Paths:        rc.Paths,
+			Extensions:   rc.Extensions,
+			ContentTypes: rc.ContentTypes,
+			Nodes:        rc.Nodes,
+			Policy: server.CachePolicy{
+				Private:   rc.Private,
+				NoStore:   rc.NoStore,
+				NoCache:   rc.NoCache,
+				Immutable: rc.Immutable,
+				Vary:      rc.Vary,
+			},
+		}
+		var err error
+		if rule.Policy.MaxAge, err = parseDuration(rc.MaxAge, rulePath+".maxAge", pos); err != nil {
+			return nil, err
+		}
+		if rule.Policy.SMaxAge, err = parseDuration(rc.SMaxAge, rulePath+".sMaxAge", pos); err != nil {
+			return nil, err
+		}
+		if rule.Policy.StaleWhileRevalidate, err = parseDuration(rc.StaleWhileRevalidate, rulePath+".staleWhileRevalidate", pos); err != nil {
+			return nil, err
+		}
+		for j, p := range rc.Paths {
+			if !validGlob(p) {
+				return nil, pos.errorf(fmt.Sprintf("%s.paths[%d]", rulePath, j), "invalid pattern %q", p)
+			}
+		}
+		for j, n := range rc.Nodes {
+			if !validGlob(n) {
+				return nil, pos.errorf(fmt.Sprintf("%s.nodes[%d]", rulePath, j), "invalid pattern %q", n)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return func() []server.CacheRule { return rules }, nil
+}
+
+func buildFileCache(cfg *FileCacheConfig, path string, pos position) (server.FileCache, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if cfg.MaxSize < 0 {
+		return nil, pos.errorf(path+".fileCache.maxSize", "invalid size %d", cfg.MaxSize)
+	}
+	if cfg.MaxFileSize < 0 {
+		return nil, pos.errorf(path+".fileCache.maxFileSize", "invalid size %d", cfg.MaxFileSize)
+	}
+	checkInterval, err := parseDuration(cfg.CheckInterval, path+".fileCache.checkInterval", pos)
+	if err != nil {
+		return nil, err
+	}
+	return server.NewFileCache(func(c server.FileCache) {
+		if cfg.MaxSize > 0 {
+			c.GetMaxSize = func() int64 { return cfg.MaxSize }
+		}
+		if cfg.MaxFileSize > 0 {
+			c.GetMaxFileSize = func() int64 { return cfg.MaxFileSize }
+		}
+		if cfg.CheckInterval != "" {
+			c.GetCheckInterval = func() time.Duration { return checkInterval }
+		}
+	}), nil
+}
+
+func buildAccessControl(cfg *AccessControlConfig, path string, pos position) (func() server.AccessControl, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	for i, s := range cfg.Allow {
+		if _, err := util.ParseIPRangeSet(s); err != nil {
+			return nil, pos.errorf(fmt.Sprintf("%s.acl.allow[%d]", path, i), "%v", err)
+		}
+	}
+	for i, s := range cfg.Deny {
+		if _, err := util.ParseIPRangeSet(s); err != nil {
+			return nil, pos.errorf(fmt.Sprintf("%s.acl.deny[%d]", path, i), "%v", err)
+		}
+	}
+	if status := cfg.DeniedStatus; status != 0 && (status < 400 || status > 599) {
+		return nil, pos.errorf(path+".acl.deniedStatus", "invalid denied status %d", status)
+	}
+	ac := server.AccessControl{
+		Allow:        cfg.Allow,
+		Deny:         cfg.Deny,
+		DeniedStatus: cfg.DeniedStatus,
+	}
+	return func() server.AccessControl { return ac }, nil
+}
+
+func buildNode(cfg NodeConfig, path string, bindings Bindings) (server.ResourceManagerI, error) {
+	if cfg.Mount != "" {
+		node, has := bindings.Nodes[cfg.Mount]
+		if !has {
+			return nil, cfg.errorf(path+".mount", "no bound node named %q", cfg.Mount)
+		}
+		return node, nil
+	}
+	if cfg.Param == "" && len(cfg.Words) == 0 {
+		return nil, cfg.errorf(path, "node needs words, param or mount")
+	}
+	if cfg.Param != "" && len(cfg.Words) > 0 {
+		return nil, cfg.errorf(path, "words and param are mutually exclusive")
+	}
+	if cfg.Pattern != "" {
+		if cfg.Param == "" || cfg.CatchAll {
+			return nil, cfg.errorf(path+".pattern", "pattern only applies to single segment param nodes")
+		}
+		if _, err := regexp.Compile(cfg.Pattern); err != nil {
+			return nil, cfg.errorf(path+".pattern", "%v", err)
+		}
+	}
+	var guide Guide
+	handlerName := cfg.Handler
+	if handlerName == "" {
+		handlerName = cfg.Name
+	}
+	if handlerName != "" {
+		g, has := bindings.Guides[handlerName]
+		if !has && cfg.Handler != "" {
+			return nil, cfg.errorf(path+".handler", "no bound handler named %q", cfg.Handler)
+		}
+		guide = g
+	}
+	if cfg.Redirect != nil {
+		if cfg.Redirect.Location == "" {
+			return nil, cfg.errorf(path+".redirect", "redirect needs a location")
+		}
+		if cfg.Redirect.Status == 0 {
+			cfg.Redirect.Status = http.StatusFound
+		}
+		if cfg.Redirect.Status < 300 || cfg.Redirect.Status > 399 {
+			return nil, cfg.errorf(path+".redirect.status", "invalid redirect status %d", cfg.Redirect.Status)
+		}
+	}
+	getAccessControl, err := buildAccessControl(cfg.ACL, path, cfg.position)
+	if err != nil {
+		return nil, err
+	}
+	children := make([]server.ResourceManagerI, 0, len(cfg.Nodes))
+	for i, child := range cfg.Nodes {
+		node, err := buildNode(child, fmt.Sprintf("%s.nodes[%d]", path, i), bindings)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	init := func(rm server.ResourceManager[any]) {
+		if cfg.Homepage != "" {
+			rm.GetHomepageFileName = func() string { return cfg.Homepage }
+		}
+		if cfg.Name != "" {
+			rm.GetRouteName = func() string { return cfg.Name }
+		}
+		if len(cfg.CORS) > 0 {
+			rm.CORSAllowOrigins = func() []string { return cfg.CORS }
+		}
+		if redirect := cfg.Redirect; redirect != nil {
+			rm.GetRedirect = func(*http.Request, server.PathPack) (bool, int, string) {
+				return true, redirect.Status, redirect.Location
+			}
+		}
+		rm.Guide = guide
+		rm.GetAccessControl = getAccessControl
+		rm.Use(children...)
+	}
+	var getRoot func() string
+	if cfg.Root != "" {
+		getRoot = func() string { return cfg.Root }
+	}
+	switch {
+	case cfg.Param != "" && cfg.CatchAll:
+		return server.NewCatchAllResourceManager[any](cfg.Param, getRoot, init), nil
+	case cfg.Param != "":
+		return server.NewParamResourceManager[any](cfg.Param, cfg.Pattern, getRoot, init), nil
+	default:
+		words := types.WordList(cfg.Words)
+		return server.NewResourceManager[any](func() types.WordList { return words }, getRoot, init), nil
+	}
+}
+
+func buildServer(cfg ServerConfig, path string, bindings Bindings) (server.Server, error) {
+	if cfg.Root == "" {
+		return nil, cfg.errorf(path+".root", "server needs a root")
+	}
+	// ips 中可以使用 CIDR、区间和排除项
+	for i, s := range cfg.IPs {
+		if _, err := util.ParseIPRangeSet(s); err != nil {
+			return nil, cfg.errorf(fmt.Sprintf("%s.ips[%d]", path, i), "%v", err)
+		}
+	}
+	for i, s := range cfg.HostPortRanges {
+		if _, err := util.ParsePortSet(s); err != nil {
+			return nil, cfg.errorf(fmt.Sprintf("%s.hostPortRanges[%d]", path, i), "%v", err)
+		}
+	}
+	for i, s := range cfg.IPPortRanges {
+		if _, err := util.ParsePortSet(s); err != nil {
+			return nil, cfg.errorf(fmt.Sprintf("%s.ipPortRanges[%d]", path, i), "%v", err)
+		}
+	}
+	var guard func(http.ResponseWriter, *http.Request, *server.PathPack) bool
+	if cfg.Guard != "" {
+		g, has := bindings.Guards[cfg.Guard]
+		if !has {
+			return nil, cfg.errorf(path+".guard", "no bound guard named %q", cfg.Guard)
+		}
+		guard = g
+	}
+	getAccessControl, err := buildAccessControl(cfg.ACL, path, cfg.position)
+	if err != nil {
+		return nil, err
+	}
+	getCDNSignOptions, err := buildCDNSign(cfg.CDNSign, path, cfg.position)
+	if err != nil {
+		return nil, err
+	}
+	getCacheRules, err := buildCacheRules(cfg.Cache, path, cfg.position)
+	if err != nil {
+		return nil, err
+	}
+	fileCache, err := buildFileCache(cfg.FileCache, path, cfg.position)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]server.ResourceManagerI, 0, len(cfg.Nodes))
+	for i, child := range cfg.Nodes {
+		node, err := buildNode(child, fmt.Sprintf("%s.nodes[%d]", path, i), bindings)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	rootRelative := cfg.RootRelative
+	if rootRelative == "" {
+		rootRelative = "."
+	}
+	s := server.NewServer(
+		func(server.HostPack) string { return cfg.Root },
+		func(server.HostPack) string { return rootRelative },
+		func(s server.Server) {
+			if cfg.hostsSet {
+				s.GetHosts = func() []string { return cfg.Hosts }
+			}
+			if cfg.hostPortsSet {
+				s.GetHostPorts = func() []uint16 { return cfg.HostPorts }
+			}
+			if cfg.ipsSet {
+				s.GetIPRanges = func() []string { return cfg.IPs }
+			}
+			if cfg.ipPortsSet {
+				s.GetIPPorts = func() []uint16 { return cfg.IPPorts }
+			}
+			if cfg.RootFileServer {
+				s.HasRootFileServer = func() bool { return true }
+			}
+			if cfg.CDNHost != "" {
+				s.GetCDNHost = func() string { return cfg.CDNHost }
+			}
+			if len(cfg.HostPortRanges) > 0 {
+				s.GetHostPortRanges = func() []string { return cfg.HostPortRanges }
+			}
+			if len(cfg.IPPortRanges) > 0 {
+				s.GetIPPortRanges = func() []string { return cfg.IPPortRanges }
+			}
+			if cfg.cdnOriginHostsSet {
+				s.GetCDNOriginHosts = func() []string { return cfg.CDNOriginHosts }
+			}
+			s.Guard = guard
+			s.GetAccessControl = getAccessControl
+			s.GetCDNSignOptions = getCDNSignOptions
+			s.GetCacheRules = getCacheRules
+			s.FileCache = fileCache
+			if cfg.Precompressed {
+				s.HasPrecompressedFiles = func() bool { return true }
+			}
+		},
+	)
+	return s.Use(nodes...), nil
+}
+
+func buildServices(cfg *Config) ([]server.Service, error) {
+	services := make([]server.Service, 0, len(cfg.Services))
+	for i, s := range cfg.Services {
+		if s.Address == "" {
+			return nil, s.errorf(fmt.Sprintf("services[%d].address", i), "service needs an address")
+		}
+		network := s.Network
+		if network == "" {
+			network = "tcp"
+		}
+		services = append(services, server.Service{
+			Network: network,
+			Address: s.Address,
+			UseTLS:  s.TLS,
+			UseGzip: s.Gzip,
+		})
+	}
+	return services, nil
+}
+
+// 一次构建得到的、Container 在运行时读取的配置
+type snapshot struct {
+	cfg      *Config
+	services []server.Service
+	servers  []server.Server
+	// Server 名称 -> Server，没有名称的 Server 不在其中
+	named      map[string]server.Server
+	dispatcher server.Dispatcher
+}
+
+func buildDispatcher(cfg *Config, servers []server.Server) server.Dispatcher {
+	return server.NewDispatcher(func(d server.Dispatcher) {
+		for i, sc := range cfg.Servers {
+			if sc.Default {
+				d.Default = servers[i]
+				continue
+			}
+			d.Add(servers[i], sc.Priority)
+		}
+		if status := cfg.UnmatchedStatus; status != 0 {
+			d.GetUnmatchedStatus = func() int { return status }
+		}
+	})
+}
+
+func build(cfg *Config, bindings Bindings) (*snapshot, error) {
+	snap := &snapshot{cfg: cfg, named: map[string]server.Server{}}
+	named := snap.named
+	if status := cfg.UnmatchedStatus; status != 0 && (status < 400 || status > 599) {
+		return nil, cfg.errorf("unmatchedStatus", "invalid unmatched status %d", status)
+	}
+	hasDefault := false
+	for i, sc := range cfg.Servers {
+		path := fmt.Sprintf("servers[%d]", i)
+		if sc.Default {
+			if hasDefault {
+				return nil, sc.errorf(path+".default", "only one server can be the default")
+			}
+			hasDefault = true
+		}
+		s, err := buildServer(sc, path, bindings)
+		if err != nil {
+			return nil, err
+		}
+		if sc.Name != "" {
+			if _, has := named[sc.Name]; has {
+				return nil, sc.errorf(path+".name", "duplicate server name %q", sc.Name)
+			}
+			named[sc.Name] = s
+		}
+		snap.servers = append(snap.servers, s)
+	}
+	services, err := buildServices(cfg)
+	if err != nil {
+		return nil, err
+	}
+	snap.services = services
+	snap.dispatcher = buildDispatcher(cfg, snap.servers)
+	return snap, nil
+}
+
+// Build 根据配置构建 Container 及其 Server
+//
+// Container 的各个 Get* 字段读取 Result 当前的配置，因此 Update 之后调用 Container.Reload 即可使新的配置生效
+func Build(cfg *Config, bindings Bindings) (*Result, error) {
+	snap, err := build(cfg, bindings)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{bindings: bindings}
+	result.current.Store(snap)
+	handleFunc := bindings.HandleFunc
+	if handleFunc == nil {
+		handleFunc = func(w http.ResponseWriter, r *http.Request) {
+			result.current.Load().dispatcher.ServeHTTP(w, r)
+		}
+	}
+	result.Container = server.NewContainer(
+		func() []server.Service { return result.current.Load().services },
+		func() server.HandleFunc { return handleFunc },
+		func() server.PickSSLCertFunc { return bindings.PickSSLCertFunc },
+		func(c server.Container) {
+			c.ShouldListenOnDefaultPorts = func() bool {
+				if listen := result.current.Load().cfg.ListenOnDefaultPorts; listen != nil {
+					return *listen
+				}
+				return true
+			}
+			c.GetCDNOriginHosts = func() []string {
+				if hosts := result.current.Load().cfg.CDNOriginHosts; len(hosts) > 0 {
+					return hosts
+				}
+				return nil
+			}
+			c.GetSafeHTTPHeaderKeys = func() []string {
+				if keys := result.current.Load().cfg.SafeHTTPHeaderKeys; len(keys) > 0 {
+					return keys
+				}
+				return nil
+			}
+		},
+	)
+	return result, nil
+}
+
+// Update 使用新的配置更新 Result
+//
+// 与已有 Server 同名（没有名称时同序号）的 Server 原地替换配置，已有的 Server 对象保持不变，
+// 处理中的请求继续使用旧的配置直到结束；服务列表等 Container 配置在下次 Container.Reload 时生效。
+// 配置有错误时 Result 保持不变
+func (r *Result) Update(cfg *Config) error {
+	r.updateLock.Lock()
+	defer r.updateLock.Unlock()
+	snap, err := build(cfg, r.bindings)
+	if err != nil {
+		return err
+	}
+	old := r.current.Load()
+	for i, sc := range cfg.Servers {
+		var existing server.Server
+		if sc.Name != "" {
+			existing = old.named[sc.Name]
+		} else if i < len(old.cfg.Servers) && old.cfg.Servers[i].Name == "" {
+			existing = old.servers[i]
+		}
+		if existing != nil {
+			snap.servers[i] = existing.Replace(snap.servers[i])
+			if sc.Name != "" {
+				snap.named[sc.Name] = snap.servers[i]
+			}
+		}
+	}
+	// 替换后的 Server 对象已经变化，需要重新构建 Dispatcher
+	snap.dispatcher = buildDispatcher(cfg, snap.servers)
+	r.current.Store(snap)
+	return nil
+}
+
+// Load 读取配置文件并构建 Container 及其 Server，根据扩展名判断格式（.yaml/.yml、.json、.toml）
+//
+// Container.Reload 时会重新读取配置文件
+func Load(filePath string, bindings Bindings) (*Result, error) {
+	cfg, err := ParseFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	result, err := Build(cfg, bindings)
+	if err != nil {
+		if e, ok := err.(*Error); ok {
+			e.File = filePath
+		}
+		return nil, err
+	}
+	result.Container.OnReload = func() error {
+		cfg, err := ParseFile(filePath)
+		if err != nil {
+			return err
+		}
+		if err := result.Update(cfg); err != nil {
+			if e, ok := err.(*Error); ok {
+				e.File = filePath
+			}
+			return err
+		}
+		return nil
+	}
+	return result, nil
+}
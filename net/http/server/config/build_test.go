@@ -0,0 +1,70 @@
+package config
+
+import (
+	"sync"
+	"testing"
+)
+
+func mustParse(t *testing.T, data string) *Config {
+	t.Helper()
+	cfg, err := Parse([]byte(data), YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestResultUpdate(t *testing.T) {
+	result, err := Build(mustParse(t, "servers:\n  - name: www\n    root: www\n  - root: other\n"), Bindings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	www := result.Server("www")
+	if www == nil || len(result.Servers()) != 2 {
+		t.Fatalf("Build() servers = %v", result.Servers())
+	}
+	tests := []struct {
+		name        string
+		data        string
+		wantServers int
+		wantErr     bool
+	}{
+		{"add server", "servers:\n  - name: www\n    root: www2\n  - root: other\n  - name: api\n    root: api\n", 3, false},
+		{"invalid config keeps result", "servers:\n  - name: www\n", 3, true},
+		{"remove server", "servers:\n  - name: www\n    root: www3\n", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Update 与读取并发进行，在 -race 下检查
+			var wg sync.WaitGroup
+			stop := make(chan struct{})
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						_ = result.Servers()
+						_ = result.Server("www")
+						_ = result.Dispatcher()
+					}
+				}
+			}()
+			err := result.Update(mustParse(t, tt.data))
+			close(stop)
+			wg.Wait()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Update() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := len(result.Servers()); got != tt.wantServers {
+				t.Errorf("len(Servers()) = %d, want %d", got, tt.wantServers)
+			}
+			// 同名的 Server 原地替换配置，对象保持不变
+			if result.Server("www") != www {
+				t.Error("Server(\"www\") changed identity")
+			}
+		})
+	}
+}
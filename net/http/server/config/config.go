@@ -0,0 +1,422 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Format int
+
+const (
+	YAML Format = iota
+	JSON
+	TOML
+)
+
+// FormatOf 根据文件扩展名判断配置文件格式，无法判断时视为 YAML
+func FormatOf(filePath string) Format {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json":
+		return JSON
+	case ".toml":
+		return TOML
+	default:
+		return YAML
+	}
+}
+
+// Error 是配置错误，尽可能指出错误在文件中的位置
+type Error struct {
+	File   string
+	Line   int
+	Column int
+	// 出错的配置项，例如 servers[0].nodes[1].words
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	var sb strings.Builder
+	if e.File != "" {
+		sb.WriteString(e.File + ":")
+	}
+	if e.Line > 0 {
+		sb.WriteString(fmt.Sprintf("%d:", e.Line))
+		if e.Column > 0 {
+			sb.WriteString(fmt.Sprintf("%d:", e.Column))
+		}
+	}
+	if sb.Len() > 0 {
+		sb.WriteString(" ")
+	}
+	if e.Path != "" {
+		sb.WriteString(e.Path + ": ")
+	}
+	sb.WriteString(e.Message)
+	return sb.String()
+}
+
+func errorAt(node *yaml.Node, path string, format string, a ...any) *Error {
+	e := &Error{Path: path, Message: fmt.Sprintf(format, a...)}
+	if node != nil {
+		e.Line, e.Column = node.Line, node.Column
+	}
+	return e
+}
+
+// 检查映射中是否有未知的键，用于发现拼写错误
+func checkKeys(node *yaml.Node, path string, allowed ...string) error {
+	if node.Kind != yaml.MappingNode {
+		return errorAt(node, path, "expected a mapping")
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		known := false
+		for _, a := range allowed {
+			if key.Value == a {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return errorAt(key, path, "unknown key %q", key.Value)
+		}
+	}
+	return nil
+}
+
+// 位置信息，在解码时记录
+type position struct {
+	node *yaml.Node
+}
+
+func (p position) errorf(path string, format string, a ...any) *Error {
+	return errorAt(p.node, path, format, a...)
+}
+
+// Aliases 是节点的别名列表，对应 types.WordList
+//
+// 可以是单个字符串或字符串列表，每个字符串是一个别名，别名中的单词以空白分隔，例如 "user info"
+type Aliases [][]string
+
+func (a *Aliases) UnmarshalYAML(value *yaml.Node) error {
+	var list []string
+	switch value.Kind {
+	case yaml.ScalarNode:
+		list = []string{value.Value}
+	case yaml.SequenceNode:
+		if err := value.Decode(&list); err != nil {
+			return err
+		}
+	default:
+		return errorAt(value, "", "words must be a string or a list of strings")
+	}
+	for _, alias := range list {
+		*a = append(*a, strings.Fields(alias))
+	}
+	return nil
+}
+
+type RedirectConfig struct {
+	Status   int    `yaml:"status"`
+	Location string `yaml:"location"`
+}
+
+// AccessControlConfig 对应 server.AccessControl
+type AccessControlConfig struct {
+	Allow        []string `yaml:"allow"`
+	Deny         []string `yaml:"deny"`
+	DeniedStatus int      `yaml:"deniedStatus"`
+}
+
+func (a *AccessControlConfig) UnmarshalYAML(value *yaml.Node) error {
+	if err := checkKeys(value, "acl", "allow", "deny", "deniedStatus"); err != nil {
+		return err
+	}
+	type plain AccessControlConfig
+	return value.Decode((*plain)(a))
+}
+
+// CDNSignConfig 对应 server.CDNSignOptions
+type CDNSignConfig struct {
+	Keys []string `yaml:"keys"`
+	// A、B 或 C，默认为 A
+	Type string `yaml:"type"`
+	// 签名的有效期，例如 30m，默认为 1h
+	TTL          string `yaml:"ttl"`
+	SignParam    string `yaml:"signParam"`
+	ExpiresParam string `yaml:"expiresParam"`
+	DeniedStatus int    `yaml:"deniedStatus"`
+}
+
+func (c *CDNSignConfig) UnmarshalYAML(value *yaml.Node) error {
+	if err := checkKeys(value, "cdnSign", "keys", "type", "ttl", "signParam", "expiresParam", "deniedStatus"); err != nil {
+		return err
+	}
+	type plain CDNSignConfig
+	return value.Decode((*plain)(c))
+}
+
+// CacheRuleConfig 对应 server.CacheRule，时长的格式如 1h、30m
+type CacheRuleConfig struct {
+	Paths                []string `yaml:"paths"`
+	Extensions           []string `yaml:"extensions"`
+	ContentTypes         []string `yaml:"contentTypes"`
+	Nodes                []string `yaml:"nodes"`
+	Private              bool     `yaml:"private"`
+	NoStore              bool     `yaml:"noStore"`
+	NoCache              bool     `yaml:"noCache"`
+	MaxAge               string   `yaml:"maxAge"`
+	SMaxAge              string   `yaml:"sMaxAge"`
+	Immutable            bool     `yaml:"immutable"`
+	StaleWhileRevalidate string   `yaml:"staleWhileRevalidate"`
+	Vary                 []string `yaml:"vary"`
+}
+
+func (c *CacheRuleConfig) UnmarshalYAML(value *yaml.Node) error {
+	if err := checkKeys(value, "cache rule", "paths", "extensions", "contentTypes", "nodes", "private", "noStore",
+		"noCache", "maxAge", "sMaxAge", "immutable", "staleWhileRevalidate", "vary"); err != nil {
+		return err
+	}
+	type plain CacheRuleConfig
+	return value.Decode((*plain)(c))
+}
+
+// FileCacheConfig 对应 server.FileCache，大小以字节为单位
+type FileCacheConfig struct {
+	MaxSize     int64 `yaml:"maxSize"`
+	MaxFileSize int64 `yaml:"maxFileSize"`
+	// 检查文件是否变化的间隔，例如 5s，默认为 1s
+	CheckInterval string `yaml:"checkInterval"`
+}
+
+func (c *FileCacheConfig) UnmarshalYAML(value *yaml.Node) error {
+	if err := checkKeys(value, "fileCache", "maxSize", "maxFileSize", "checkInterval"); err != nil {
+		return err
+	}
+	type plain FileCacheConfig
+	return value.Decode((*plain)(c))
+}
+
+type NodeConfig struct {
+	position `yaml:"-"`
+	Words    Aliases `yaml:"words"`
+	// 参数节点的参数名，与 words 互斥
+	Param string `yaml:"param"`
+	// 参数值的约束（正则表达式）
+	Pattern string `yaml:"pattern"`
+	// 为 true 时 param 是通配节点
+	CatchAll bool `yaml:"catchAll"`
+	// 节点名，同时作为路由名，并在没有指定 handler 时用于查找 Bindings.Guides
+	Name     string          `yaml:"name"`
+	Root     string          `yaml:"root"`
+	Homepage string          `yaml:"homepage"`
+	Redirect *RedirectConfig `yaml:"redirect"`
+	CORS     []string        `yaml:"cors"`
+	// 按客户端 IP 的访问控制，对该节点及其所有子节点生效
+	ACL *AccessControlConfig `yaml:"acl"`
+	// 引用 Bindings.Guides 中的处理函数
+	Handler string `yaml:"handler"`
+	// 引用 Bindings.Nodes 中代码定义的节点，指定时其他字段均被忽略
+	Mount string       `yaml:"mount"`
+	Nodes []NodeConfig `yaml:"nodes"`
+}
+
+func (n *NodeConfig) UnmarshalYAML(value *yaml.Node) error {
+	if err := checkKeys(value, "node", "words", "param", "pattern", "catchAll", "name", "root",
+		"homepage", "redirect", "cors", "acl", "handler", "mount", "nodes"); err != nil {
+		return err
+	}
+	type plain NodeConfig
+	if err := value.Decode((*plain)(n)); err != nil {
+		return err
+	}
+	n.node = value
+	return nil
+}
+
+type ServerConfig struct {
+	position       `yaml:"-"`
+	Name           string   `yaml:"name"`
+	Root           string   `yaml:"root"`
+	RootRelative   string   `yaml:"rootRelative"`
+	Hosts          []string `yaml:"hosts"`
+	HostPorts      []uint16 `yaml:"hostPorts"`
+	IPs            []string `yaml:"ips"`
+	IPPorts        []uint16 `yaml:"ipPorts"`
+	HostPortRanges []string `yaml:"hostPortRanges"`
+	IPPortRanges   []string `yaml:"ipPortRanges"`
+	RootFileServer bool     `yaml:"rootFileServer"`
+	CDNHost        string   `yaml:"cdnHost"`
+	CDNOriginHosts []string `yaml:"cdnOriginHosts"`
+	// CDN 重定向 URL 的签名设置
+	CDNSign *CDNSignConfig `yaml:"cdnSign"`
+	// 缓存规则，按顺序使用第一条匹配的规则
+	Cache []CacheRuleConfig `yaml:"cache"`
+	// 文件服务器的内存缓存
+	FileCache *FileCacheConfig `yaml:"fileCache"`
+	// 客户端接受时发送预压缩的 .br 或 .gz 文件
+	Precompressed bool   `yaml:"precompressed"`
+	Guard         string `yaml:"guard"`
+	// 按客户端 IP 的访问控制
+	ACL *AccessControlConfig `yaml:"acl"`
+	// 分发时的优先级，越大越先尝试
+	Priority int `yaml:"priority"`
+	// 为 true 时作为默认 Server，所有 Server 都不处理请求时使用，最多只能有一个
+	Default           bool         `yaml:"default"`
+	Nodes             []NodeConfig `yaml:"nodes"`
+	hostsSet          bool
+	hostPortsSet      bool
+	ipsSet            bool
+	ipPortsSet        bool
+	cdnOriginHostsSet bool
+}
+
+// 记录列表字段是否出现过：没有出现表示不过滤，出现但为空表示全部拒绝，与代码中的 Get* 函数语义一致
+func hasKey(node *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ServerConfig) UnmarshalYAML(value *yaml.Node) error {
+	if err := checkKeys(value, "server", "name", "root", "rootRelative", "hosts", "hostPorts", "ips",
+		"ipPorts", "hostPortRanges", "ipPortRanges", "rootFileServer", "cdnHost", "cdnOriginHosts", "cdnSign", "cache", "fileCache", "precompressed", "guard", "acl", "priority", "default", "nodes"); err != nil {
+		return err
+	}
+	type plain ServerConfig
+	if err := value.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	s.node = value
+	s.hostsSet = hasKey(value, "hosts")
+	s.hostPortsSet = hasKey(value, "hostPorts")
+	s.ipsSet = hasKey(value, "ips")
+	s.ipPortsSet = hasKey(value, "ipPorts")
+	s.cdnOriginHostsSet = hasKey(value, "cdnOriginHosts")
+	return nil
+}
+
+type ServiceConfig struct {
+	position `yaml:"-"`
+	Network  string `yaml:"network"`
+	Address  string `yaml:"address"`
+	TLS      bool   `yaml:"tls"`
+	Gzip     bool   `yaml:"gzip"`
+}
+
+func (s *ServiceConfig) UnmarshalYAML(value *yaml.Node) error {
+	if err := checkKeys(value, "service", "network", "address", "tls", "gzip"); err != nil {
+		return err
+	}
+	type plain ServiceConfig
+	if err := value.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	s.node = value
+	return nil
+}
+
+type Config struct {
+	position             `yaml:"-"`
+	Services             []ServiceConfig `yaml:"services"`
+	ListenOnDefaultPorts *bool           `yaml:"listenOnDefaultPorts"`
+	CDNOriginHosts       []string        `yaml:"cdnOriginHosts"`
+	SafeHTTPHeaderKeys   []string        `yaml:"safeHTTPHeaderKeys"`
+	Servers              []ServerConfig  `yaml:"servers"`
+	// 所有 Server 都不处理请求时回复的状态码，默认为 404
+	UnmatchedStatus int `yaml:"unmatchedStatus"`
+}
+
+func (c *Config) UnmarshalYAML(value *yaml.Node) error {
+	if err := checkKeys(value, "", "services", "listenOnDefaultPorts", "cdnOriginHosts",
+		"safeHTTPHeaderKeys", "servers", "unmatchedStatus"); err != nil {
+		return err
+	}
+	type plain Config
+	if err := value.Decode((*plain)(c)); err != nil {
+		return err
+	}
+	c.node = value
+	return nil
+}
+
+// 将 yaml 的错误转换为 Error
+func convertYAMLError(err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var te *yaml.TypeError
+	if errors.As(err, &te) && len(te.Errors) > 0 {
+		// 形如：line 3: cannot unmarshal !!str `abc` into uint16
+		msg := te.Errors[0]
+		result := &Error{Message: msg}
+		if _, scanErr := fmt.Sscanf(msg, "line %d:", &result.Line); scanErr == nil {
+			result.Message = strings.TrimSpace(msg[strings.IndexRune(msg, ':')+1:])
+		}
+		return result
+	}
+	result := &Error{Message: err.Error()}
+	if _, scanErr := fmt.Sscanf(err.Error(), "yaml: line %d:", &result.Line); scanErr == nil {
+		msg := strings.TrimPrefix(err.Error(), "yaml: ")
+		result.Message = strings.TrimSpace(msg[strings.IndexRune(msg, ':')+1:])
+	}
+	return result
+}
+
+// Parse 解析配置内容
+//
+// 错误会尽可能指出行号和列号；TOML 中内联表里的配置项出错时指出的是外层键的位置
+func Parse(data []byte, format Format) (*Config, error) {
+	var root yaml.Node
+	switch format {
+	case TOML:
+		node, err := parseTOML(data)
+		if err != nil {
+			return nil, err
+		}
+		root = *node
+	case JSON:
+		// JSON 是 YAML 的子集，但 YAML 不允许用制表符缩进；JSON 字符串中不会出现未转义的制表符，因此可以直接替换
+		data = bytes.ReplaceAll(data, []byte("\t"), []byte(" "))
+		fallthrough
+	default:
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil, convertYAMLError(err)
+		}
+	}
+	cfg := &Config{}
+	if root.Kind == 0 { // 空文件
+		return cfg, nil
+	}
+	if err := root.Decode(cfg); err != nil {
+		return nil, convertYAMLError(err)
+	}
+	return cfg, nil
+}
+
+// ParseFile 读取并解析配置文件，根据扩展名判断格式
+func ParseFile(filePath string) (*Config, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(data, FormatOf(filePath))
+	if err != nil {
+		var e *Error
+		if errors.As(err, &e) {
+			e.File = filePath
+		}
+		return nil, err
+	}
+	return cfg, nil
+}
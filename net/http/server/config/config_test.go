@@ -0,0 +1,98 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseErrorPosition(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     Format
+		data       string
+		wantLine   int
+		wantColumn int
+		// 错误信息中应当包含的内容
+		wantMessage string
+	}{
+		{"yaml unknown key", YAML, "servers:\n  - root: www\n    hots: [a.com]\n", 3, 5, `unknown key "hots"`},
+		{"yaml type error", YAML, "servers:\n  - root: www\n    hostPorts: [abc]\n", 3, 0, "cannot unmarshal"},
+		{"yaml syntax error", YAML, "unmatchedStatus: 404\n  servers: []\n", 2, 0, "mapping values are not allowed"},
+		{"json unknown key", JSON, "{\n\t\"servers\": [\n\t\t{\"root\": \"www\", \"hots\": []}\n\t]\n}\n", 3, 19, `unknown key "hots"`},
+		{"toml syntax error", TOML, "[[servers]]\nroot = \"www\"\nhosts = [\n", 3, 10, "unexpected EOF"},
+		{"toml unknown top-level key", TOML, "unmatchedStatus = 404\nlisten = true\n", 2, 1, `unknown key "listen"`},
+		{"toml unknown key in array table", TOML, "[[servers]]\nroot = \"www\"\n\n[[servers]]\nroot = \"api\"\n  hots = [\"a.com\"]\n", 6, 3, `unknown key "hots"`},
+		{"toml unknown key in nested array table", TOML, "[[servers]]\nroot = \"www\"\n\n[[servers.nodes]]\nwords = \"a\"\n\n[[servers.nodes]]\nwords = \"b\"\nnmae = \"x\"\n", 9, 1, `unknown key "nmae"`},
+		{"toml unknown key in sub-table", TOML, "[[servers]]\nroot = \"www\"\n\n[servers.acl]\nallow = [\"10.0.0.0/8\"]\ndenny = []\n", 6, 1, `unknown key "denny"`},
+		{"toml unknown key after multi-line array", TOML, "[[servers]]\nhosts = [\n  \"a.com\",\n  \"[b]\",\n]\nroot = \"www\"\nhots = []\n", 7, 1, `unknown key "hots"`},
+		{"toml unknown key after multi-line string", TOML, "[[servers]]\nroot = \"\"\"\nhots = 1\n\"\"\"\nhots = []\n", 5, 1, `unknown key "hots"`},
+		{"toml unknown key in inline table", TOML, "[[servers]]\nroot = \"www\"\nnodes = [{ words = \"a\", nmae = \"x\" }]\n", 3, 1, `unknown key "nmae"`},
+		{"toml type error", TOML, "[[servers]]\nroot = \"www\"\nhostPorts = [\"abc\"]\n", 3, 0, "cannot unmarshal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data), tt.format)
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("Parse() error = %v, want *Error", err)
+			}
+			if e.Line != tt.wantLine || tt.wantColumn != 0 && e.Column != tt.wantColumn {
+				t.Errorf("Parse() error at %d:%d, want %d:%d (%v)", e.Line, e.Column, tt.wantLine, tt.wantColumn, e)
+			}
+			if !strings.Contains(e.Message, tt.wantMessage) {
+				t.Errorf("Parse() error = %q, want it to contain %q", e.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	data := `
+unmatchedStatus = 410
+
+[[services]]
+network = "tcp"
+address = ":8080"
+
+[[servers]]
+name = "www"
+root = "www"
+hosts = ["a.com", "b.com"]
+hostPorts = [80, 443]
+
+[[servers.nodes]]
+words = ["static", "assets"]
+root = "static"
+
+[[servers.nodes.nodes]]
+param = "id"
+pattern = "[0-9]+"
+
+[servers.acl]
+deny = ["10.0.0.1"]
+`
+	cfg, err := Parse([]byte(data), TOML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.UnmatchedStatus != 410 || len(cfg.Services) != 1 || cfg.Services[0].Address != ":8080" {
+		t.Errorf("top level = %+v", cfg)
+	}
+	if len(cfg.Servers) != 1 {
+		t.Fatalf("servers = %+v", cfg.Servers)
+	}
+	s := cfg.Servers[0]
+	if s.Name != "www" || len(s.Hosts) != 2 || len(s.HostPorts) != 2 || s.HostPorts[1] != 443 || !s.hostsSet || s.ipsSet {
+		t.Errorf("server = %+v", s)
+	}
+	if s.ACL == nil || len(s.ACL.Deny) != 1 {
+		t.Errorf("acl = %+v", s.ACL)
+	}
+	if len(s.Nodes) != 1 || len(s.Nodes[0].Words) != 2 || len(s.Nodes[0].Nodes) != 1 || s.Nodes[0].Nodes[0].Param != "id" {
+		t.Fatalf("nodes = %+v", s.Nodes)
+	}
+	if line := s.Nodes[0].Nodes[0].node.Line; line != 18 {
+		t.Errorf("nested node position = line %d, want 18", line)
+	}
+}
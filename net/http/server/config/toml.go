@@ -0,0 +1,290 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 键在 TOML 文件中的位置
+type tomlPosition struct {
+	line   int
+	column int
+}
+
+// TOML 中各个键的位置，键为配置项路径，例如 servers[0].nodes[1].words
+//
+// toml.MetaData 不提供键的位置，因此逐行扫描：记录表头（[a.b]、[[a.b]]）和键值对（a.b = ...）所在的位置，
+// 跨行的数组、内联表和多行字符串会被跳过。内联表中的键没有单独的位置，使用外层键的位置
+type tomlPositions map[string]tomlPosition
+
+func joinTOMLPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// 解析行首的键，返回键的各部分和键之后的剩余部分
+func scanTOMLKey(s string) (parts []string, rest string, ok bool) {
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return nil, "", false
+		}
+		switch s[0] {
+		case '"', '\'':
+			end := 1
+			for end < len(s) && s[end] != s[0] {
+				if s[0] == '"' && s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, "", false
+			}
+			part := s[1:end]
+			if s[0] == '"' {
+				if unquoted, err := strconv.Unquote(s[:end+1]); err == nil {
+					part = unquoted
+				}
+			}
+			parts = append(parts, part)
+			s = s[end+1:]
+		default:
+			end := 0
+			for end < len(s) && (s[end] >= 'a' && s[end] <= 'z' || s[end] >= 'A' && s[end] <= 'Z' ||
+				s[end] >= '0' && s[end] <= '9' || s[end] == '_' || s[end] == '-') {
+				end++
+			}
+			if end == 0 {
+				return nil, "", false
+			}
+			parts = append(parts, s[:end])
+			s = s[end:]
+		}
+		s = strings.TrimLeft(s, " \t")
+		if !strings.HasPrefix(s, ".") {
+			return parts, s, true
+		}
+		s = s[1:]
+	}
+}
+
+// 跨行值的扫描状态
+type tomlValueScanner struct {
+	// 未闭合的 [ 和 { 的数量
+	depth int
+	// 未闭合的多行字符串的分隔符
+	multiline string
+}
+
+// 扫描一行中的值，返回值是否在此行之后继续
+func (v *tomlValueScanner) scan(line string) bool {
+	for i := 0; i < len(line); i++ {
+		if v.multiline != "" {
+			if strings.HasPrefix(line[i:], v.multiline) {
+				i += len(v.multiline) - 1
+				v.multiline = ""
+			} else if v.multiline == `"""` && line[i] == '\\' {
+				i++
+			}
+			continue
+		}
+		switch c := line[i]; c {
+		case '#':
+			return v.depth > 0
+		case '[', '{':
+			v.depth++
+		case ']', '}':
+			v.depth--
+		case '"', '\'':
+			if delim := strings.Repeat(string(c), 3); strings.HasPrefix(line[i:], delim) {
+				v.multiline = delim
+				i += 2
+				continue
+			}
+			for i++; i < len(line) && line[i] != c; i++ {
+				if c == '"' && line[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+	return v.depth > 0 || v.multiline != ""
+}
+
+func scanTOMLPositions(data string) tomlPositions {
+	positions := tomlPositions{}
+	record := func(path string, line int, column int) {
+		if _, has := positions[path]; !has {
+			positions[path] = tomlPosition{line: line, column: column}
+		}
+	}
+	// 数组表的路径 -> 当前元素的下标
+	arrayTables := map[string]int{}
+	// 将表头中的键解析为带下标的路径
+	resolve := func(parts []string) string {
+		path := ""
+		for _, part := range parts {
+			path = joinTOMLPath(path, part)
+			if i, has := arrayTables[path]; has {
+				path += fmt.Sprintf("[%d]", i)
+			}
+		}
+		return path
+	}
+	table := ""
+	var value tomlValueScanner
+	inValue := false
+	for i, line := range strings.Split(data, "\n") {
+		if inValue {
+			inValue = value.scan(line)
+			continue
+		}
+		trimmed := strings.TrimLeft(line, " \t")
+		column := len(line) - len(trimmed) + 1
+		switch {
+		case strings.HasPrefix(trimmed, "[["):
+			parts, rest, ok := scanTOMLKey(trimmed[2:])
+			if !ok || !strings.HasPrefix(rest, "]]") {
+				continue
+			}
+			array := resolve(parts[:len(parts)-1])
+			array = joinTOMLPath(array, parts[len(parts)-1])
+			if _, has := arrayTables[array]; has {
+				arrayTables[array]++
+			} else {
+				arrayTables[array] = 0
+			}
+			record(array, i+1, column)
+			table = fmt.Sprintf("%s[%d]", array, arrayTables[array])
+			record(table, i+1, column)
+		case strings.HasPrefix(trimmed, "["):
+			parts, rest, ok := scanTOMLKey(trimmed[1:])
+			if !ok || !strings.HasPrefix(rest, "]") {
+				continue
+			}
+			table = resolve(parts)
+			record(table, i+1, column)
+		default:
+			parts, rest, ok := scanTOMLKey(trimmed)
+			if !ok || !strings.HasPrefix(rest, "=") {
+				continue
+			}
+			path := table
+			for _, part := range parts {
+				path = joinTOMLPath(path, part)
+				record(path, i+1, column)
+			}
+			value = tomlValueScanner{}
+			inValue = value.scan(rest[1:])
+		}
+	}
+	return positions
+}
+
+// 查找路径的位置，没有时使用最近的上级路径的位置
+func (p tomlPositions) find(path string) tomlPosition {
+	for {
+		if pos, has := p[path]; has {
+			return pos
+		}
+		cut := strings.LastIndexAny(path, ".[")
+		if cut <= 0 {
+			return tomlPosition{}
+		}
+		path = path[:cut]
+	}
+}
+
+// 将 TOML 的值转换为 yaml.Node，节点的位置为其键在 TOML 文件中的位置
+func (p tomlPositions) node(value any, path string) (*yaml.Node, error) {
+	pos := p.find(path)
+	node := &yaml.Node{Line: pos.line, Column: pos.column}
+	scalar := func(tag string, v string) (*yaml.Node, error) {
+		node.Kind, node.Tag, node.Value = yaml.ScalarNode, tag, v
+		return node, nil
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		// 按在文件中出现的顺序排列，使报告的第一个错误与文件中的顺序一致
+		sort.SliceStable(keys, func(i, j int) bool {
+			a, b := p.find(joinTOMLPath(path, keys[i])), p.find(joinTOMLPath(path, keys[j]))
+			if a != b {
+				return a.line < b.line || a.line == b.line && a.column < b.column
+			}
+			return keys[i] < keys[j]
+		})
+		for _, key := range keys {
+			keyPath := joinTOMLPath(path, key)
+			keyPos := p.find(keyPath)
+			child, err := p.node(v[key], keyPath)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key, Line: keyPos.line, Column: keyPos.column},
+				child)
+		}
+		return node, nil
+	case []map[string]any:
+		list := make([]any, len(v))
+		for i := range v {
+			list[i] = v[i]
+		}
+		return p.node(list, path)
+	case []any:
+		node.Kind, node.Tag = yaml.SequenceNode, "!!seq"
+		for i, item := range v {
+			child, err := p.node(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case string:
+		return scalar("!!str", v)
+	case bool:
+		return scalar("!!bool", strconv.FormatBool(v))
+	case int64:
+		return scalar("!!int", strconv.FormatInt(v, 10))
+	case float64:
+		return scalar("!!float", strconv.FormatFloat(v, 'g', -1, 64))
+	case time.Time:
+		return scalar("!!timestamp", v.Format(time.RFC3339Nano))
+	case fmt.Stringer:
+		// 本地日期和时间
+		return scalar("!!str", v.String())
+	}
+	return nil, &Error{Line: pos.line, Column: pos.column, Path: path, Message: fmt.Sprintf("unsupported TOML value %T", value)}
+}
+
+// 解析 TOML 并转换为 yaml.Node，以便与 YAML 和 JSON 共用解码和校验逻辑
+func parseTOML(data []byte) (*yaml.Node, error) {
+	var raw map[string]any
+	if _, err := toml.Decode(string(data), &raw); err != nil {
+		var pe toml.ParseError
+		if errors.As(err, &pe) {
+			return nil, &Error{Line: pe.Position.Line, Column: pe.Position.Col, Message: pe.Message}
+		}
+		return nil, &Error{Message: err.Error()}
+	}
+	root, err := scanTOMLPositions(string(data)).node(raw, "")
+	if err != nil {
+		return nil, err
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}, nil
+}
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"github.com/TelephoneTan/GoHTTPGzipServer/gzip"
 	"github.com/TelephoneTan/GoHTTPServer/util"
 	httpUtil "github.com/TelephoneTan/GoHTTPServer/util/http"
@@ -9,15 +11,29 @@ import (
 	"golang.org/x/net/idna"
 	"net"
 	"net/http"
+	"os"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+const defaultShutdownTimeout = 30 * time.Second
+
 type Service struct {
 	Network string
 	Address string
 	UseTLS  bool
 	UseGzip bool
+	// 如果不为空，则该服务使用此 Handler，而不是 Container.GetHandleFunc 提供的 HandleFunc，
+	// 用于提供管理服务，例如 Metrics.Service
+	Handler http.Handler
+	// 如果不为空，则 UseTLS 的服务使用此 TLS 配置，而不是 Container.GetPickSSLCertFunc 提供的证书，
+	// 例如要求客户端证书的管理服务
+	TLSConfig *tls.Config
+	// 如果为 true，则就绪检查不要求该服务正在监听
+	Optional bool
 }
 
 type PickSSLCertFunc = func(info *tls.ClientHelloInfo) (*tls.Certificate, error)
@@ -30,7 +46,39 @@ type _Container struct {
 	ShouldListenOnDefaultPorts func() bool
 	GetCDNOriginHosts          func() []string
 	GetSafeHTTPHeaderKeys      func() []string
-	wg                         sync.WaitGroup
+	// 错误上报钩子，HandlePanic 处理本 Container 内发生的错误时会调用
+	ErrorHooks ErrorHooks
+	// 访问日志，记录所有请求
+	AccessLog AccessLog
+	// 指标统计，统计所有请求
+	Metrics Metrics
+	// 追踪导出器，不为空时解析并传播 traceparent/tracestate，并导出各处理阶段的 Span；traceparent 没有设置 sampled 标志时不导出
+	SpanExporter SpanExporter
+	// 请求 ID 使用的头部，默认为 X-Request-ID
+	GetRequestIDHeader func() string
+	// 可信对端的 IP、CIDR 或区间，来自可信对端或可信代理的请求会沿用其携带的请求 ID，否则总是生成新的请求 ID
+	GetRequestIDTrustedPeers func() []string
+	// 可信代理的 IP、CIDR 或区间，来自可信代理的请求会根据转发头部还原客户端 IP、协议和主机名，见 Effective
+	GetTrustedProxies func() []string
+	// 存活、就绪和健康检查接口，为空时不提供
+	Health Health
+	// Reload 时首先调用，返回错误时放弃本次 Reload
+	OnReload func() error
+	// 为 true 时收到 SIGHUP 信号后调用 Reload（仅限类 Unix 系统）
+	ShouldReloadOnSIGHUP func() bool
+	// 停止服务时等待处理中的请求结束的最长时间，超时后强制关闭连接，默认为 30 秒
+	GetShutdownTimeout func() time.Duration
+	wg                 sync.WaitGroup
+	reloadLock         sync.Mutex
+	running            map[string]*runningService
+	// 应当运行的服务 -> 是否为就绪所必需
+	desired      map[string]bool
+	pickSSL      atomic.Pointer[PickSSLCertFunc]
+	certificates certificateRecorder
+	// 可信代理和请求 ID 可信对端的查找结构
+	trustedProxySet  matcherCache[util.IPRangeSet]
+	requestIDPeerSet matcherCache[util.IPRangeSet]
+	draining         atomic.Bool
 }
 type Container = *_Container
 
@@ -50,89 +98,439 @@ func (c Container) await() {
 	c.wg.Wait()
 }
 
-func (c Container) goHttp(service Service, pickSSLCertFunc PickSSLCertFunc, handler http.Handler) {
+// 运行中的服务
+type runningService struct {
+	service Service
+	// 是否真正启用了 TLS：没有证书时 UseTLS 的服务以 HTTP 运行
+	tls      bool
+	server   *http.Server
+	listener *switchableTLSListener
+	handler  *swappableHandler
+	stopped  atomic.Bool
+	// 当前打开的连接数
+	connections atomic.Int64
+}
+
+// 可以原子地替换的 Handler，替换后新的请求使用新的 Handler，处理中的请求不受影响
+type swappableHandler struct {
+	handler atomic.Pointer[http.Handler]
+}
+
+func (h *swappableHandler) set(handler http.Handler) {
+	h.handler.Store(&handler)
+}
+
+func (h *swappableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*h.handler.Load()).ServeHTTP(w, r)
+}
+
+// 可以切换 TLS 设置的监听，新的连接使用当前的设置，设置为 nil 时不启用 TLS
+type switchableTLSListener struct {
+	net.Listener
+	config atomic.Pointer[tls.Config]
+}
+
+func (l *switchableTLSListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if config := l.config.Load(); config != nil {
+		return tls.Server(conn, config), nil
+	}
+	return conn, nil
+}
+
+func serviceKey(service Service) string {
+	return service.Network + " " + service.Address
+}
+
+// 设置服务的 TLS、Gzip 和 Handler，新的连接使用新的设置，已有的连接不受影响；返回 TLS 或 Gzip 设置是否发生了变化
+func (c Container) configure(rs *runningService, service Service, useTLS bool) (changed bool) {
+	changed = rs.service.Network == "" || rs.tls != useTLS ||
+		rs.service.UseGzip != service.UseGzip || rs.service.TLSConfig != service.TLSConfig
+	if changed && service.UseTLS && !useTLS {
+		log.W("【警告】没有 SSL 证书，【", serviceKey(service), "】上的 SSL/TLS 功能不会被启用")
+	}
+	var tlsConfig *tls.Config
+	if useTLS {
+		tlsConfig = service.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{GetCertificate: c.pickSSLCert}
+		}
+	}
+	rs.listener.config.Store(tlsConfig)
+	handler := service.Handler
+	if service.UseGzip {
+		handler = keepAcceptEncoding(&gzip.Handler{Handler: handler})
+	}
+	rs.handler.set(handler)
+	rs.service, rs.tls = service, useTLS
+	return changed
+}
+
+func serviceTag(useTLS bool) string {
+	if useTLS {
+		return "【HTTPS】"
+	}
+	return "【HTTP】"
+}
+
+func (c Container) goHttp(service Service, useTLS bool) (*runningService, error) {
+	rs := &runningService{handler: &swappableHandler{}}
+	rs.server = &http.Server{
+		//这里注意啦：
+		//
+		//请求中一般不会包含大量数据，因此可以设置较小的请求读取超时
+		//
+		//但是，回复中可能会包含大量数据，因此必须设置较大的回复写入超时
+		WriteTimeout: 120 * time.Second,
+		ReadTimeout:  30 * time.Second,
+		Handler:      rs.handler,
+		ConnState: func(_ net.Conn, state http.ConnState) {
+			switch state {
+			case http.StateNew:
+				rs.connections.Add(1)
+			case http.StateHijacked, http.StateClosed:
+				rs.connections.Add(-1)
+			}
+		},
+	}
+	if c.draining.Load() {
+		rs.server.SetKeepAlivesEnabled(false)
+	}
+	tag := serviceTag(useTLS)
+	netAddr := serviceKey(service)
+	if service.Network == "unix" {
+		removeStaleSocket(service.Address)
+	}
+	listener, e := net.Listen(service.Network, service.Address)
+	if e != nil {
+		log.E(tag, netAddr, " ×")
+		log.E(e)
+		return nil, e
+	}
+	rs.listener = &switchableTLSListener{Listener: listener}
+	c.configure(rs, service, useTLS)
+	log.S(tag, netAddr, " √")
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
-		if service.UseGzip {
-			handler = &gzip.Handler{Handler: handler}
-		}
-		var e error
-		server := http.Server{
-			//这里注意啦：
-			//
-			//请求中一般不会包含大量数据，因此可以设置较小的请求读取超时
-			//
-			//但是，回复中可能会包含大量数据，因此必须设置较大的回复写入超时
-			WriteTimeout: 120 * time.Second,
-			ReadTimeout:  30 * time.Second,
-			Handler:      handler,
-		}
-		var listener net.Listener
-		var tag string
-		netAddr := service.Network + " " + service.Address
-		if service.UseTLS && pickSSLCertFunc != nil {
-			tag = "【HTTPS】"
-			listener, e = tls.Listen(service.Network, service.Address, &tls.Config{GetCertificate: pickSSLCertFunc})
-		} else {
-			if service.UseTLS {
-				log.W("【警告】没有 SSL 证书，【", netAddr, "】上的 SSL/TLS 功能不会被启用")
-			}
-			tag = "【HTTP】"
-			listener, e = net.Listen(service.Network, service.Address)
-		}
-		if e == nil {
-			log.S(tag, netAddr, " √")
-			e = server.Serve(listener)
-		} else {
-			log.E(tag, netAddr, " ×")
+		e := rs.server.Serve(rs.listener)
+		if rs.stopped.Load() {
+			log.I(serviceTag(rs.listener.config.Load() != nil), netAddr, " 已停止")
+			return
 		}
 		log.E(e)
 	}()
+	return rs, nil
 }
 
-func (c Container) Boot() {
-	{ // 设置最大文件数
-		setrlimit()
+func (c Container) shutdownTimeout() time.Duration {
+	if c.GetShutdownTimeout == nil {
+		return defaultShutdownTimeout
 	}
-	handler := http.NewServeMux()
+	return c.GetShutdownTimeout()
+}
+
+// 优雅地停止服务：立即关闭监听，处理中的请求在后台继续处理直到结束，超过 shutdownTimeout 时强制关闭连接
+//
+// 被劫持的连接（例如 WebSocket）不受管理，需要由劫持者自行关闭
+func (c Container) stop(rs *runningService) {
+	rs.stopped.Store(true)
+	_ = rs.listener.Close()
+	timeout := c.shutdownTimeout()
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := rs.server.Shutdown(ctx); err != nil {
+			log.W(serviceKey(rs.service), " 处理中的请求在 ", timeout, " 内没有结束，强制关闭连接")
+			_ = rs.server.Close()
+		}
+	}()
+}
+
+// 上次运行遗留的 Unix 套接字文件会导致监听失败
+//
+// 只删除连接被拒绝的套接字文件；仍有进程在监听时保留，此时监听会报告地址已被占用
+func removeStaleSocket(address string) {
+	if info, err := os.Lstat(address); err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	conn, err := net.DialTimeout("unix", address, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		_ = os.Remove(address)
+	}
+}
+
+// 使用当前生效的证书选择函数，并记录选出的证书
+func (c Container) pickSSLCert(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	pickSSL := c.pickSSL.Load()
+	if pickSSL == nil || *pickSSL == nil {
+		return nil, errors.New("no SSL certificate")
+	}
+	cert, err := (*pickSSL)(info)
+	if err == nil && cert != nil {
+		c.certificates.record(cert)
+	}
+	return cert, err
+}
+
+// 为请求附加 requestState，并兜底处理未被 Server 捕获的错误
+func (c Container) serve(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, state := ensureRequestState(r)
+		state.container = c
+		effective := resolveForwarded(r, c.trustedProxies())
+		state.effective = &effective
+		w = state.trackResponse(w)
+		state.assignRequestID(w, r, c.requestIDHeader(), c.trustRequestIDPeer(r))
+		c.Metrics.begin("")
+		defer c.Metrics.end("")
+		defer c.Metrics.record(r, state)
+		defer c.AccessLog.log(r, state)
+		defer state.endTrace(state.startTrace(w, r, c.SpanExporter))
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				HandlePanic(w, r, p)
+			}
+		}()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// 根据当前的配置得到应当运行的服务，Handler 均已填充
+func (c Container) desiredServices(pickSSL PickSSLCertFunc) []Service {
+	mux := http.NewServeMux()
 	var hf HandleFunc
 	if c.GetHandleFunc != nil {
 		hf = c.GetHandleFunc()
 	}
 	if hf != nil {
-		handler.HandleFunc("/", hf)
-	}
-	var pickSSL PickSSLCertFunc
-	if c.GetPickSSLCertFunc != nil {
-		pickSSL = c.GetPickSSLCertFunc()
+		mux.HandleFunc("/", hf)
 	}
+	c.Health.register(c, mux)
+	handler := c.serve(mux)
+	var services []Service
 	if c.GetServices != nil {
 		for _, service := range c.GetServices() {
-			c.goHttp(service, pickSSL, handler)
+			if service.Handler == nil {
+				service.Handler = handler
+			}
+			services = append(services, service)
 		}
 	}
 	if c.ShouldListenOnDefaultPorts == nil || c.ShouldListenOnDefaultPorts() {
 		httpHandler := handler
 		if pickSSL != nil {
-			httpHandler = http.NewServeMux()
-			httpHandler.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
-				if util.MatchCDNOriginHost(request, c.GetCDNOriginHosts) ||
+			httpMux := http.NewServeMux()
+			c.Health.register(c, httpMux)
+			httpHandler = httpMux
+			httpMux.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
+				// 可信代理已经以 HTTPS 接受了请求时不需要重定向
+				effective := resolveForwarded(request, c.trustedProxies())
+				if effective.Scheme == "https" ||
+					util.MatchCDNOriginHost(request, c.GetCDNOriginHosts) ||
 					util.MatchSafeHTTPHeaderKey(request, c.GetSafeHTTPHeaderKeys) {
 					handler.ServeHTTP(writer, request)
 					return
 				}
-				host, _ := idna.ToASCII(request.Host)
+				host, _ := idna.ToASCII(effective.Host)
 				httpUtil.SetLocation(writer, "https://"+host+request.RequestURI)
 				writer.WriteHeader(http.StatusTemporaryRedirect)
 			})
 		}
-		// HTTP
-		c.goHttp(Service{Network: "tcp4", Address: "0.0.0.0:80", UseTLS: false, UseGzip: true}, pickSSL, httpHandler)
-		c.goHttp(Service{Network: "tcp6", Address: "[::]:80", UseTLS: false, UseGzip: true}, pickSSL, httpHandler)
-		// HTTPS
-		c.goHttp(Service{Network: "tcp4", Address: "0.0.0.0:443", UseTLS: true, UseGzip: true}, pickSSL, handler)
-		c.goHttp(Service{Network: "tcp6", Address: "[::]:443", UseTLS: true, UseGzip: true}, pickSSL, handler)
+		services = append(services,
+			// HTTP
+			Service{Network: "tcp4", Address: "0.0.0.0:80", UseTLS: false, UseGzip: true, Handler: httpHandler},
+			Service{Network: "tcp6", Address: "[::]:80", UseTLS: false, UseGzip: true, Handler: httpHandler},
+			// HTTPS
+			Service{Network: "tcp4", Address: "0.0.0.0:443", UseTLS: true, UseGzip: true, Handler: handler},
+			Service{Network: "tcp6", Address: "[::]:443", UseTLS: true, UseGzip: true, Handler: handler},
+		)
+	}
+	return services
+}
+
+// 使运行中的服务与当前的配置一致
+//
+// 新增的服务开始监听，移除的服务停止监听并在处理完已有请求后关闭，
+// 已有的服务在原有的监听上原地替换 TLS、Gzip 设置和 Handler，已经建立的连接保持原来的 TLS 设置；
+// 新增的服务监听失败时返回错误，其余服务不受影响
+func (c Container) apply() error {
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+	if c.draining.Load() {
+		return errors.New("container is draining")
+	}
+	var pickSSL PickSSLCertFunc
+	if c.GetPickSSLCertFunc != nil {
+		pickSSL = c.GetPickSSLCertFunc()
+	}
+	c.pickSSL.Store(&pickSSL)
+	c.certificates.reset()
+	if c.running == nil {
+		c.running = map[string]*runningService{}
+	}
+	var errs []error
+	if err := c.Health.validate(); err != nil {
+		log.E(err)
+		errs = append(errs, err)
+	}
+	desired := map[string]bool{}
+	for _, service := range c.desiredServices(pickSSL) {
+		key := serviceKey(service)
+		if _, has := desired[key]; has {
+			continue
+		}
+		desired[key] = !service.Optional
+		useTLS := service.UseTLS && (pickSSL != nil || service.TLSConfig != nil)
+		if rs, has := c.running[key]; has {
+			// 在原有的监听上切换，不需要重新监听，因此不会因为地址被占用等原因失去服务
+			if c.configure(rs, service, useTLS) {
+				log.I(serviceTag(useTLS), key, " 的设置已更新，新的连接使用新的设置")
+			}
+			continue
+		}
+		rs, err := c.goHttp(service, useTLS)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		c.running[key] = rs
+	}
+	for key, rs := range c.running {
+		if _, has := desired[key]; !has {
+			c.stop(rs)
+			delete(c.running, key)
+		}
+	}
+	c.desired = desired
+	return errors.Join(errs...)
+}
+
+// Reload 重新读取配置并使其生效，不需要重启进程
+//
+// 首先调用 OnReload（例如重新加载配置文件），然后重新读取 GetServices、GetHandleFunc、GetPickSSLCertFunc 等字段，
+// 按照 apply 的规则增删或修改服务，处理中的请求继续使用旧的配置直到结束
+func (c Container) Reload() error {
+	if c.OnReload != nil {
+		if err := c.OnReload(); err != nil {
+			return err
+		}
+	}
+	return c.apply()
+}
+
+func (c Container) Boot() {
+	{ // 设置最大文件数
+		setrlimit()
+	}
+	_ = c.apply()
+	if c.ShouldReloadOnSIGHUP != nil && c.ShouldReloadOnSIGHUP() {
+		c.watchSIGHUP()
 	}
 	c.await()
 }
+
+// ListenerInfo 描述一个运行中的服务
+type ListenerInfo struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
+	// 是否真正启用了 TLS
+	TLS  bool `json:"tls"`
+	Gzip bool `json:"gzip"`
+	// listening 或 draining
+	State       string `json:"state"`
+	Connections int64  `json:"connections"`
+}
+
+// Listeners 返回所有运行中的服务，按网络和地址排序
+func (c Container) Listeners() []ListenerInfo {
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+	state := "listening"
+	if c.draining.Load() {
+		state = "draining"
+	}
+	list := make([]ListenerInfo, 0, len(c.running))
+	for _, rs := range c.running {
+		list = append(list, ListenerInfo{
+			Network:     rs.service.Network,
+			Address:     rs.service.Address,
+			TLS:         rs.tls,
+			Gzip:        rs.service.UseGzip,
+			State:       state,
+			Connections: rs.connections.Load(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Network != list[j].Network {
+			return list[i].Network < list[j].Network
+		}
+		return list[i].Address < list[j].Address
+	})
+	return list
+}
+
+// Drain 开始优雅停机
+//
+// 立即进入停机状态：此后不再接受 Reload，连接在当前请求结束后关闭而不再保持；
+// 等待 grace 之后停止所有服务，处理中的请求处理完成（最多再等待 GetShutdownTimeout）后 Boot 返回
+func (c Container) Drain(grace time.Duration) {
+	if !c.draining.CompareAndSwap(false, true) {
+		return
+	}
+	c.reloadLock.Lock()
+	for _, rs := range c.running {
+		rs.server.SetKeepAlivesEnabled(false)
+	}
+	c.reloadLock.Unlock()
+	log.I("开始优雅停机，", grace, " 后停止所有服务")
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		time.Sleep(grace)
+		c.reloadLock.Lock()
+		defer c.reloadLock.Unlock()
+		for key, rs := range c.running {
+			c.stop(rs)
+			delete(c.running, key)
+		}
+	}()
+}
+
+// Draining 返回是否已经开始优雅停机
+func (c Container) Draining() bool {
+	return c.draining.Load()
+}
+
+// 各个就绪所必需的服务是否正在监听
+func (c Container) serviceStatus() []HealthCheckResult {
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+	list := make([]HealthCheckResult, 0, len(c.desired))
+	for key, required := range c.desired {
+		if !required {
+			continue
+		}
+		result := HealthCheckResult{Name: key, OK: c.running[key] != nil}
+		if !result.OK {
+			result.Error = "not listening"
+		}
+		list = append(list, result)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
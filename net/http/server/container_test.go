@@ -0,0 +1,204 @@
+package server
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 停止 Container 的所有服务并等待结束
+func stopContainer(c Container) {
+	c.Drain(0)
+	c.await()
+}
+
+func TestApplySwitchesSettingsInPlace(t *testing.T) {
+	// 只用于得到自签名证书和信任该证书的客户端
+	certServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer certServer.Close()
+	transport := certServer.Client().Transport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+	transport.DisableCompression = true
+	client := &http.Client{Transport: transport}
+
+	services := []Service{{Network: "tcp", Address: "127.0.0.1:0"}}
+	c := NewContainer(
+		func() []Service { return services },
+		func() HandleFunc {
+			return func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write([]byte("hello")) }
+		},
+		nil,
+		func(c Container) {
+			c.ShouldListenOnDefaultPorts = func() bool { return false }
+		},
+	)
+	defer stopContainer(c)
+	steps := []struct {
+		name     string
+		gzip     bool
+		tls      bool
+		wantGzip bool
+	}{
+		{"plain", false, false, false},
+		{"enable gzip", true, false, true},
+		{"enable TLS", true, true, true},
+		{"disable gzip", false, true, false},
+		{"disable TLS", false, false, false},
+	}
+	var addr net.Addr
+	for _, step := range steps {
+		services[0].UseGzip = step.gzip
+		services[0].UseTLS = step.tls
+		services[0].TLSConfig = nil
+		if step.tls {
+			services[0].TLSConfig = &tls.Config{Certificates: certServer.TLS.Certificates}
+		}
+		if err := c.apply(); err != nil {
+			t.Fatalf("%s: apply() = %v", step.name, err)
+		}
+		rs := c.running[serviceKey(services[0])]
+		if rs == nil {
+			t.Fatalf("%s: service is not running", step.name)
+		}
+		if addr == nil {
+			addr = rs.listener.Addr()
+		} else if rs.listener.Addr().String() != addr.String() {
+			t.Fatalf("%s: listener moved from %s to %s", step.name, addr, rs.listener.Addr())
+		}
+		scheme := "http"
+		if step.tls {
+			scheme = "https"
+		}
+		req, _ := http.NewRequest("GET", scheme+"://"+addr.String()+"/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if gotGzip := resp.Header.Get("Content-Encoding") == "gzip"; gotGzip != step.wantGzip {
+			t.Errorf("%s: gzip = %v, want %v", step.name, gotGzip, step.wantGzip)
+		}
+		if info := c.Listeners(); len(info) != 1 || info[0].TLS != step.tls || info[0].Gzip != step.gzip {
+			t.Errorf("%s: Listeners() = %+v", step.name, info)
+		}
+	}
+}
+
+func TestApplyReportsListenError(t *testing.T) {
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer occupied.Close()
+	services := []Service{{Network: "tcp", Address: "127.0.0.1:0"}}
+	c := NewContainer(func() []Service { return services }, nil, nil, func(c Container) {
+		c.ShouldListenOnDefaultPorts = func() bool { return false }
+	})
+	defer stopContainer(c)
+	if err := c.apply(); err != nil {
+		t.Fatal(err)
+	}
+	services = append(services, Service{Network: "tcp", Address: occupied.Addr().String()})
+	if err := c.apply(); err == nil {
+		t.Error("apply() = nil, want the listen error")
+	}
+	if info := c.Listeners(); len(info) != 1 || info[0].Address != "127.0.0.1:0" {
+		t.Errorf("Listeners() = %+v, want only the existing service", info)
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	tests := []struct {
+		name string
+		// 在 path 上创建文件，返回清理函数
+		create      func(t *testing.T, path string) func()
+		wantRemoved bool
+	}{
+		{"live socket", func(t *testing.T, path string) func() {
+			l, err := net.Listen("unix", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return func() { _ = l.Close() }
+		}, false},
+		{"stale socket", func(t *testing.T, path string) func() {
+			l, err := net.Listen("unix", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			l.(*net.UnixListener).SetUnlinkOnClose(false)
+			_ = l.Close()
+			return func() {}
+		}, true},
+		{"regular file", func(t *testing.T, path string) func() {
+			if err := os.WriteFile(path, nil, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			return func() {}
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "s.sock")
+			defer tt.create(t, path)()
+			removeStaleSocket(path)
+			_, err := os.Lstat(path)
+			if removed := os.IsNotExist(err); removed != tt.wantRemoved {
+				t.Errorf("removed = %v, want %v", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestDrainForceClosesAfterShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	services := []Service{{Network: "tcp", Address: "127.0.0.1:0"}}
+	c := NewContainer(
+		func() []Service { return services },
+		func() HandleFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				select {
+				case <-release:
+				case <-r.Context().Done():
+				}
+			}
+		},
+		nil,
+		func(c Container) {
+			c.ShouldListenOnDefaultPorts = func() bool { return false }
+			c.GetShutdownTimeout = func() time.Duration { return 50 * time.Millisecond }
+		},
+	)
+	if err := c.apply(); err != nil {
+		t.Fatal(err)
+	}
+	addr := c.running[serviceKey(services[0])].listener.Addr().String()
+	go func() {
+		resp, err := http.Get("http://" + addr + "/")
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+	<-started
+	done := make(chan struct{})
+	go func() {
+		stopContainer(c)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain did not finish after the shutdown timeout")
+	}
+}
@@ -4,6 +4,8 @@ package server
 
 import (
 	"github.com/TelephoneTan/GoLog/log"
+	"os"
+	"os/signal"
 	"syscall"
 )
 
@@ -15,3 +17,16 @@ func setrlimit() {
 		log.SF("已将 最大文件数 限制设为：%d", limit)
 	}
 }
+
+func (c Container) watchSIGHUP() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			log.I("收到 SIGHUP，重新加载配置")
+			if err := c.Reload(); err != nil {
+				log.E("重新加载配置失败：", err)
+			}
+		}
+	}()
+}
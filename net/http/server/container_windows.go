@@ -1,3 +1,5 @@
 package server
 
 func setrlimit() {}
+
+func (c Container) watchSIGHUP() {}
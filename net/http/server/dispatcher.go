@@ -0,0 +1,208 @@
+package server
+
+import (
+	"golang.org/x/net/idna"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type dispatchEntry struct {
+	server   Server
+	priority int
+	// 加入的顺序，优先级相同时先加入的先尝试
+	order int
+}
+
+// 主机索引：普通主机名 -> 依次尝试的 Server，其中已经合并了需要逐个匹配的 Server
+type dispatchIndex struct {
+	generation uint64
+	exact      map[string][]Server
+	// 没有设置 GetHosts 或者使用了通配、后缀、正则形式的 Server
+	fallback []Server
+}
+
+type _Dispatcher struct {
+	// 所有 Server 都不处理请求时使用的 Server，可以为空；同时通过 Add 加入时也只在最后尝试
+	Default Server
+	// 包括 Default 在内的所有 Server 都不处理请求时回复的状态码，默认为 404，
+	// 也可以使用 421（http.StatusMisdirectedRequest）告知客户端此连接不服务于该主机
+	GetUnmatchedStatus func() int
+	lock               sync.Mutex
+	entries            []dispatchEntry
+	order              int
+	index              atomic.Pointer[dispatchIndex]
+}
+
+// Dispatcher 根据主机名将请求分发给多个 Server
+//
+// 请求依次交给各个 Server，直到某个 Server 处理了请求：优先级高的先尝试，优先级相同时先加入的先尝试。
+// 只有普通主机名的 Server 按主机名建立索引，查找的时间复杂度为 O(1)，不会尝试主机名不匹配的 Server。
+//
+// 索引在 Server 被 Reconfigure 时自动重建；如果 GetHosts 在没有 Reconfigure 的情况下返回了不同的主机名，需要调用 Refresh
+type Dispatcher = *_Dispatcher
+
+func NewDispatcher(init ...func(Dispatcher)) Dispatcher {
+	d := &_Dispatcher{}
+	if len(init) > 0 {
+		init[0](d)
+	}
+	return d
+}
+
+// Add 加入 Server，priority 为优先级，默认为 0
+func (d Dispatcher) Add(s Server, priority ...int) Dispatcher {
+	entry := dispatchEntry{server: s}
+	if len(priority) > 0 {
+		entry.priority = priority[0]
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	entry.order = d.order
+	d.order++
+	d.entries = append(d.entries, entry)
+	d.index.Store(nil)
+	return d
+}
+
+// Remove 移除 Server
+func (d Dispatcher) Remove(s Server) Dispatcher {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	entries := d.entries[:0:0]
+	for _, entry := range d.entries {
+		if entry.server != s {
+			entries = append(entries, entry)
+		}
+	}
+	d.entries = entries
+	d.index.Store(nil)
+	return d
+}
+
+// Set 以 servers 替换所有 Server，优先级均为 0
+func (d Dispatcher) Set(servers ...Server) Dispatcher {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.entries = nil
+	for _, s := range servers {
+		d.entries = append(d.entries, dispatchEntry{server: s, order: d.order})
+		d.order++
+	}
+	d.index.Store(nil)
+	return d
+}
+
+// Refresh 重新读取各 Server 的 GetHosts 并重建索引
+func (d Dispatcher) Refresh() {
+	d.index.Store(nil)
+}
+
+// 主机名在索引中的形式，与 matchHost 的比较方式一致
+func normalizeHost(host string) (string, bool) {
+	host, err := idna.ToUnicode(host)
+	if err != nil || host == "" {
+		return "", false
+	}
+	return strings.ToLower(withoutBrackets(host)), true
+}
+
+// 可以建立索引的主机名，Server 不能建立索引时返回 false
+func exactHosts(s Server) ([]string, bool) {
+	s = s.current()
+	if s.GetHosts == nil {
+		return nil, false
+	}
+	hosts := s.GetHosts()
+	keys := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if isHostPattern(host) {
+			return nil, false
+		}
+		if key, ok := normalizeHost(host); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, true
+}
+
+func (d Dispatcher) buildIndex() *dispatchIndex {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	index := &dispatchIndex{generation: serverGeneration.Load(), exact: map[string][]Server{}}
+	entries := append([]dispatchEntry(nil), d.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].priority != entries[j].priority {
+			return entries[i].priority > entries[j].priority
+		}
+		return entries[i].order < entries[j].order
+	})
+	hostsOf := make([]map[string]bool, len(entries))
+	for i, entry := range entries {
+		keys, ok := exactHosts(entry.server)
+		if !ok {
+			continue
+		}
+		hostsOf[i] = map[string]bool{}
+		for _, key := range keys {
+			hostsOf[i][key] = true
+			index.exact[key] = nil
+		}
+	}
+	for i, entry := range entries {
+		if hostsOf[i] == nil {
+			index.fallback = append(index.fallback, entry.server)
+		}
+		for key := range index.exact {
+			if hostsOf[i] == nil || hostsOf[i][key] {
+				index.exact[key] = append(index.exact[key], entry.server)
+			}
+		}
+	}
+	return index
+}
+
+// 应当依次尝试的 Server
+func (d Dispatcher) candidates(r *http.Request) []Server {
+	index := d.index.Load()
+	if index == nil || index.generation != serverGeneration.Load() {
+		index = d.buildIndex()
+		d.index.Store(index)
+	}
+	if host := Effective(r).Host; host != "" {
+		if key, ok := normalizeHost(extractHost(host)); ok {
+			if servers, has := index.exact[key]; has {
+				return servers
+			}
+		}
+	}
+	return index.fallback
+}
+
+func (d Dispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, s := range d.candidates(r) {
+		// Default 同时被加入时只在最后尝试一次
+		if s == d.Default {
+			continue
+		}
+		if s.Handle(w, r) {
+			return
+		}
+	}
+	if d.Default != nil && d.Default.Handle(w, r) {
+		return
+	}
+	statusCode := http.StatusNotFound
+	if d.GetUnmatchedStatus != nil {
+		statusCode = d.GetUnmatchedStatus()
+	}
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(statusCode)
+}
+
+// HandleFunc 返回可以用作 Container.GetHandleFunc 返回值的 HandleFunc
+func (d Dispatcher) HandleFunc() HandleFunc {
+	return d.ServeHTTP
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 测试用的 Server，处理请求时在回复头部中写上自己的名字
+func newNamedServer(name string, hosts ...string) Server {
+	return NewServer(nil, nil, func(s Server) {
+		if hosts != nil {
+			s.GetHosts = func() []string { return hosts }
+		}
+		s.Guard = func(w http.ResponseWriter, _ *http.Request, _ *PathPack) bool {
+			w.Header().Set("X-Server", name)
+			w.WriteHeader(http.StatusNoContent)
+			return true
+		}
+	})
+}
+
+func TestDispatcher(t *testing.T) {
+	exact := newNamedServer("exact", "a.com", "www.a.com")
+	exactLow := newNamedServer("exactLow", "a.com")
+	suffix := newNamedServer("suffix", ".b.com")
+	regex := newNamedServer("regex", "~^c[0-9]+\\.com$")
+	other := newNamedServer("other", "d.com")
+	def := newNamedServer("default")
+	tests := []struct {
+		name string
+		// 依次加入的 Server 及其优先级
+		servers        []Server
+		priorities     []int
+		def            Server
+		unmatched      int
+		host           string
+		wantServer     string
+		wantStatus     int
+		wantCandidates []Server
+	}{
+		{"exact host", []Server{exact, suffix}, []int{0, 0}, nil, 0, "A.com", "exact", http.StatusNoContent, []Server{exact, suffix}},
+		{"exact host with port", []Server{exact}, []int{0}, nil, 0, "www.a.com:8080", "exact", http.StatusNoContent, []Server{exact}},
+		{"same priority keeps order", []Server{exactLow, exact}, []int{0, 0}, nil, 0, "a.com", "exactLow", http.StatusNoContent, []Server{exactLow, exact}},
+		{"higher priority first", []Server{exactLow, exact}, []int{0, 1}, nil, 0, "a.com", "exact", http.StatusNoContent, []Server{exact, exactLow}},
+		{"suffix host", []Server{exact, suffix}, []int{0, 0}, nil, 0, "x.b.com", "suffix", http.StatusNoContent, []Server{suffix}},
+		{"regex in fallback", []Server{other, regex}, []int{0, 0}, nil, 0, "c42.com", "regex", http.StatusNoContent, []Server{regex}},
+		{"exact index skips other hosts", []Server{exact, other, suffix}, []int{0, 0, 0}, nil, 0, "d.com", "other", http.StatusNoContent, []Server{other, suffix}},
+		{"unmatched", []Server{exact, suffix}, []int{0, 0}, nil, 0, "e.com", "", http.StatusNotFound, []Server{suffix}},
+		{"unmatched status", []Server{exact}, []int{0}, nil, http.StatusMisdirectedRequest, "e.com", "", http.StatusMisdirectedRequest, nil},
+		{"default", []Server{exact}, []int{0}, def, http.StatusMisdirectedRequest, "e.com", "default", http.StatusNoContent, nil},
+		{"default is tried last even when added", []Server{def, exact}, []int{10, 0}, def, 0, "a.com", "exact", http.StatusNoContent, []Server{def, exact}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDispatcher(func(d Dispatcher) {
+				d.Default = tt.def
+				if tt.unmatched != 0 {
+					d.GetUnmatchedStatus = func() int { return tt.unmatched }
+				}
+			})
+			for i, s := range tt.servers {
+				d.Add(s, tt.priorities[i])
+			}
+			r := newLocalRequest("GET", "http://"+tt.host+"/")
+			candidates := d.candidates(r)
+			if len(candidates) != len(tt.wantCandidates) {
+				t.Fatalf("candidates = %d servers, want %d", len(candidates), len(tt.wantCandidates))
+			}
+			for i := range candidates {
+				if candidates[i] != tt.wantCandidates[i] {
+					t.Errorf("candidates[%d] is not the expected server", i)
+				}
+			}
+			w := httptest.NewRecorder()
+			d.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus || w.Header().Get("X-Server") != tt.wantServer {
+				t.Errorf("served by %q with %d, want %q with %d", w.Header().Get("X-Server"), w.Code, tt.wantServer, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestDispatcherRebuildsIndex(t *testing.T) {
+	hosts := []string{"a.com"}
+	s := NewServer(nil, nil, func(s Server) {
+		s.GetHosts = func() []string { return hosts }
+		s.Guard = func(w http.ResponseWriter, _ *http.Request, _ *PathPack) bool {
+			w.WriteHeader(http.StatusNoContent)
+			return true
+		}
+	})
+	d := NewDispatcher().Add(s)
+	serve := func(host string) int {
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, newLocalRequest("GET", "http://"+host+"/"))
+		return w.Code
+	}
+	if code := serve("a.com"); code != http.StatusNoContent {
+		t.Fatalf("a.com = %d", code)
+	}
+	hosts = []string{"b.com"}
+	// 没有 Refresh 时仍然使用旧的索引
+	if code := serve("b.com"); code != http.StatusNotFound {
+		t.Errorf("b.com before Refresh = %d, want 404", code)
+	}
+	d.Refresh()
+	if code := serve("b.com"); code != http.StatusNoContent {
+		t.Errorf("b.com after Refresh = %d, want 204", code)
+	}
+	d.Remove(s)
+	if code := serve("b.com"); code != http.StatusNotFound {
+		t.Errorf("b.com after Remove = %d, want 404", code)
+	}
+}
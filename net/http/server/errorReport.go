@@ -0,0 +1,245 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/TelephoneTan/GoLog/log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PanicEvent 描述一次被 HandlePanic 处理的错误
+type PanicEvent struct {
+	Time       time.Time `json:"time"`
+	ErrorID    string    `json:"errorID"`
+	RequestID  string    `json:"requestID"`
+	Code       string    `json:"code"`
+	HTTPCode   int       `json:"httpCode"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Host       string    `json:"host"`
+	Paths      *PathPack `json:"paths,omitempty"`
+	StackTrace string    `json:"stackTrace"`
+	// 调用栈指纹，去除了地址、偏移量等易变信息，相同位置的错误指纹相同
+	Fingerprint string `json:"fingerprint"`
+	// panic 参数的字符串形式
+	Panic      string `json:"panic"`
+	PanicValue any    `json:"-"`
+	// 回复已经开始发送，连接被中止而不是回复错误状态码
+	Aborted bool `json:"aborted"`
+	// 自上次上报以来因去重而未上报的同指纹事件数量
+	Suppressed int `json:"suppressed"`
+}
+
+// ErrorReporter 用于接收错误事件，它会在独立的 goroutine 中被调用
+type ErrorReporter = func(event PanicEvent)
+
+type ErrorHookOptions struct {
+	// 采样率，取值范围 (0, 1]，0 视为 1，即全部上报
+	SampleRate float64
+	// 去重窗口，同一指纹的事件在窗口内只上报一次，0 表示不去重
+	DedupWindow time.Duration
+}
+
+type errorHook struct {
+	reporter ErrorReporter
+	options  ErrorHookOptions
+	// 采样使用的随机数，取值范围 [0, 1)
+	random func() float64
+	lock   sync.Mutex
+	// 指纹 -> 上次上报时间
+	lastReported map[string]time.Time
+	// 指纹 -> 被抑制的次数
+	suppressed map[string]int
+}
+
+type _ErrorHooks struct {
+	lock  sync.RWMutex
+	hooks []*errorHook
+}
+
+// ErrorHooks 是错误上报钩子的注册表，可以设置在 Server 和 Container 上
+type ErrorHooks = *_ErrorHooks
+
+func NewErrorHooks(init ...func(ErrorHooks)) ErrorHooks {
+	h := &_ErrorHooks{}
+	if len(init) > 0 {
+		init[0](h)
+	}
+	return h
+}
+
+func (h ErrorHooks) Register(reporter ErrorReporter, options ...ErrorHookOptions) ErrorHooks {
+	hook := &errorHook{
+		reporter:     reporter,
+		random:       rand.Float64,
+		lastReported: map[string]time.Time{},
+		suppressed:   map[string]int{},
+	}
+	if len(options) > 0 {
+		hook.options = options[0]
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.hooks = append(h.hooks, hook)
+	return h
+}
+
+// 判断事件是否需要上报，需要的话返回补充了 Suppressed 的事件
+func (hook *errorHook) admit(event PanicEvent) (PanicEvent, bool) {
+	if rate := hook.options.SampleRate; rate > 0 && rate < 1 && hook.random() >= rate {
+		return event, false
+	}
+	window := hook.options.DedupWindow
+	if window <= 0 {
+		return event, true
+	}
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	if last, has := hook.lastReported[event.Fingerprint]; has && event.Time.Sub(last) < window {
+		hook.suppressed[event.Fingerprint]++
+		return event, false
+	}
+	if len(hook.lastReported) > 1000 { // 清理过期的指纹，避免无限增长
+		for fp, last := range hook.lastReported {
+			if event.Time.Sub(last) >= window {
+				delete(hook.lastReported, fp)
+				delete(hook.suppressed, fp)
+			}
+		}
+	}
+	hook.lastReported[event.Fingerprint] = event.Time
+	event.Suppressed = hook.suppressed[event.Fingerprint]
+	delete(hook.suppressed, event.Fingerprint)
+	return event, true
+}
+
+func (h ErrorHooks) report(event PanicEvent) {
+	if h == nil {
+		return
+	}
+	h.lock.RLock()
+	hooks := h.hooks
+	h.lock.RUnlock()
+	for _, hook := range hooks {
+		if e, ok := hook.admit(event); ok {
+			go func(reporter ErrorReporter) {
+				defer func() {
+					if p := recover(); p != nil {
+						log.E("错误上报钩子发生了错误：", p)
+					}
+				}()
+				reporter(e)
+			}(hook.reporter)
+		}
+	}
+}
+
+// 计算调用栈指纹：只保留函数名和文件行号，去除 goroutine 编号、参数地址和偏移量
+func stackFingerprint(stackTrace string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(stackTrace, "\n") {
+		switch {
+		case line == "", strings.HasPrefix(line, "goroutine "):
+			continue
+		case strings.HasPrefix(line, "\t"):
+			if i := strings.LastIndex(line, " +0x"); i != -1 {
+				line = line[:i]
+			}
+		default:
+			if i := strings.LastIndex(line, "("); i != -1 {
+				line = line[:i]
+			}
+		}
+		sb.WriteString(strings.TrimSpace(line))
+		sb.WriteString("\n")
+	}
+	sum := sha1.Sum([]byte(sb.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+func newPanicEvent(r *http.Request, id string, code string, statusCode int, stackTrace []byte, panicArgument any) PanicEvent {
+	event := PanicEvent{
+		Time:        time.Now(),
+		ErrorID:     id,
+		RequestID:   RequestID(r),
+		Code:        code,
+		HTTPCode:    statusCode,
+		Method:      r.Method,
+		URL:         r.URL.String(),
+		Host:        r.Host,
+		StackTrace:  string(stackTrace),
+		Fingerprint: stackFingerprint(string(stackTrace)),
+		Panic:       fmt.Sprint(panicArgument),
+		PanicValue:  panicArgument,
+	}
+	if state := getRequestState(r); state != nil && state.paths != nil {
+		paths := state.paths.Clone()
+		event.Paths = &paths
+	}
+	return event
+}
+
+// 将事件上报给请求所属的 Server 和 Container 上注册的钩子
+func reportPanic(r *http.Request, event PanicEvent) {
+	state := getRequestState(r)
+	if state == nil {
+		return
+	}
+	if state.server != nil {
+		state.server.ErrorHooks.report(event)
+	}
+	if state.container != nil {
+		state.container.ErrorHooks.report(event)
+	}
+}
+
+// NewHTTPErrorReporter 以 JSON 格式将事件 POST 到指定地址，例如本地的收集器
+func NewHTTPErrorReporter(url string, client *http.Client) ErrorReporter {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return func(event PanicEvent) {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.E("错误事件序列化失败：", err)
+			return
+		}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.E("错误事件上报失败：", err)
+			return
+		}
+		_ = resp.Body.Close()
+	}
+}
+
+// NewFileErrorReporter 以 JSON Lines 格式将事件追加写入指定文件
+func NewFileErrorReporter(filePath string) ErrorReporter {
+	var lock sync.Mutex
+	return func(event PanicEvent) {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.E("错误事件序列化失败：", err)
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		f, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.E("错误事件写入失败：", err)
+			return
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		_, _ = f.Write(append(body, '\n'))
+	}
+}
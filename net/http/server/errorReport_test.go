@@ -0,0 +1,243 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+const testStackTrace = `goroutine 7 [running]:
+main.handler(0xc000123456, 0x1)
+	/src/main.go:12 +0x1d
+net/http.HandlerFunc.ServeHTTP(0xc000010000?, {0x7a1b20, 0xc0000aa000}, 0xc0000b0000)
+	/usr/local/go/src/net/http/server.go:2136 +0x29
+`
+
+// 依次返回 values 中的值，用于替换采样使用的随机数
+func fixedRandom(values ...float64) func() float64 {
+	return func() float64 {
+		value := values[0]
+		values = values[1:]
+		return value
+	}
+}
+
+// 注册一个把事件发送到通道的钩子，random 为空时使用默认的随机数
+func newTestErrorHooks(options ErrorHookOptions, random func() float64) (ErrorHooks, chan PanicEvent) {
+	events := make(chan PanicEvent, 16)
+	hooks := NewErrorHooks().Register(func(event PanicEvent) {
+		events <- event
+	}, options)
+	if random != nil {
+		hooks.hooks[0].random = random
+	}
+	return hooks, events
+}
+
+// 等待 n 个事件被上报，并确认没有更多事件
+func receiveEvents(t *testing.T, events chan PanicEvent, n int) []PanicEvent {
+	t.Helper()
+	var received []PanicEvent
+	for len(received) < n {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		case <-time.After(time.Second):
+			t.Fatalf("received %d events, want %d", len(received), n)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %+v", event)
+	case <-time.After(20 * time.Millisecond):
+	}
+	return received
+}
+
+func TestErrorHookSampling(t *testing.T) {
+	tests := []struct {
+		name   string
+		rate   float64
+		random []float64
+		want   []bool
+	}{
+		{name: "zero rate reports all", rate: 0, want: []bool{true, true, true}},
+		{name: "full rate reports all", rate: 1, want: []bool{true, true, true}},
+		{name: "half rate", rate: 0.5, random: []float64{0.1, 0.5, 0.9, 0.49}, want: []bool{true, false, false, true}},
+		{name: "small rate", rate: 0.01, random: []float64{0.005, 0.02}, want: []bool{true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			random := func() float64 {
+				t.Fatal("random should not be used")
+				return 0
+			}
+			if tt.random != nil {
+				random = fixedRandom(tt.random...)
+			}
+			hooks, _ := newTestErrorHooks(ErrorHookOptions{SampleRate: tt.rate}, random)
+			for i, want := range tt.want {
+				if _, got := hooks.hooks[0].admit(PanicEvent{Fingerprint: "a"}); got != want {
+					t.Errorf("event %d: admit = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorHookDedup(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	type step struct {
+		after       time.Duration
+		fingerprint string
+		admit       bool
+		suppressed  int
+	}
+	tests := []struct {
+		name   string
+		window time.Duration
+		steps  []step
+	}{
+		{
+			name:   "no window",
+			window: 0,
+			steps: []step{
+				{0, "a", true, 0},
+				{time.Second, "a", true, 0},
+				{time.Second, "a", true, 0},
+			},
+		},
+		{
+			name:   "suppressed within window",
+			window: time.Minute,
+			steps: []step{
+				{0, "a", true, 0},
+				{time.Second, "a", false, 0},
+				{59 * time.Second, "a", false, 0},
+				{time.Minute, "a", true, 2},
+				{time.Minute + time.Second, "a", false, 0},
+				{3 * time.Minute, "a", true, 1},
+			},
+		},
+		{
+			name:   "fingerprints are independent",
+			window: time.Minute,
+			steps: []step{
+				{0, "a", true, 0},
+				{time.Second, "b", true, 0},
+				{2 * time.Second, "a", false, 0},
+				{3 * time.Second, "b", false, 0},
+				{4 * time.Second, "b", false, 0},
+				{time.Minute, "a", true, 1},
+				{time.Minute + time.Second, "b", true, 2},
+			},
+		},
+		{
+			name:   "window counts from last report",
+			window: time.Minute,
+			steps: []step{
+				{0, "a", true, 0},
+				{50 * time.Second, "a", false, 0},
+				{100 * time.Second, "a", true, 1},
+				{150 * time.Second, "a", false, 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hooks, _ := newTestErrorHooks(ErrorHookOptions{DedupWindow: tt.window}, nil)
+			for i, s := range tt.steps {
+				event, admitted := hooks.hooks[0].admit(PanicEvent{Time: start.Add(s.after), Fingerprint: s.fingerprint})
+				if admitted != s.admit {
+					t.Fatalf("step %d: admit = %v, want %v", i, admitted, s.admit)
+				}
+				if admitted && event.Suppressed != s.suppressed {
+					t.Errorf("step %d: Suppressed = %d, want %d", i, event.Suppressed, s.suppressed)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorHooksReport(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	hooks, events := newTestErrorHooks(ErrorHookOptions{DedupWindow: time.Minute}, nil)
+	// 出错的钩子不影响其他钩子
+	hooks.Register(func(event PanicEvent) {
+		panic("reporter failed")
+	})
+	for _, after := range []time.Duration{0, time.Second, 2 * time.Second, time.Minute} {
+		hooks.report(PanicEvent{Time: start.Add(after), ErrorID: after.String(), Fingerprint: "a"})
+	}
+	received := receiveEvents(t, events, 2)
+	got := map[string]int{}
+	for _, event := range received {
+		got[event.ErrorID] = event.Suppressed
+	}
+	want := map[string]int{"0s": 0, "1m0s": 2}
+	if len(got) != len(want) || got["0s"] != want["0s"] || got["1m0s"] != want["1m0s"] {
+		t.Errorf("reported %v, want %v", got, want)
+	}
+
+	var nilHooks ErrorHooks
+	nilHooks.report(PanicEvent{})
+}
+
+func TestStackFingerprint(t *testing.T) {
+	base := stackFingerprint(testStackTrace)
+	tests := []struct {
+		name  string
+		stack string
+		same  bool
+	}{
+		{
+			name: "different goroutine, arguments and offsets",
+			stack: `goroutine 42 [running]:
+main.handler(0xc000999999, 0x2)
+	/src/main.go:12 +0x2f
+net/http.HandlerFunc.ServeHTTP(0xc000020000?, {0x7a1b20, 0xc0000bb000}, 0xc0000c0000)
+	/usr/local/go/src/net/http/server.go:2136 +0x44
+
+`,
+			same: true,
+		},
+		{
+			name: "different line",
+			stack: `goroutine 7 [running]:
+main.handler(0xc000123456, 0x1)
+	/src/main.go:13 +0x1d
+net/http.HandlerFunc.ServeHTTP(0xc000010000?, {0x7a1b20, 0xc0000aa000}, 0xc0000b0000)
+	/usr/local/go/src/net/http/server.go:2136 +0x29
+`,
+			same: false,
+		},
+		{
+			name: "different function",
+			stack: `goroutine 7 [running]:
+main.otherHandler(0xc000123456, 0x1)
+	/src/main.go:12 +0x1d
+net/http.HandlerFunc.ServeHTTP(0xc000010000?, {0x7a1b20, 0xc0000aa000}, 0xc0000b0000)
+	/usr/local/go/src/net/http/server.go:2136 +0x29
+`,
+			same: false,
+		},
+		{
+			name: "missing frame",
+			stack: `goroutine 7 [running]:
+main.handler(0xc000123456, 0x1)
+	/src/main.go:12 +0x1d
+`,
+			same: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stackFingerprint(tt.stack)
+			if (got == base) != tt.same {
+				t.Errorf("stackFingerprint = %s, base %s, want same = %v", got, base, tt.same)
+			}
+			if len(got) != 16 {
+				t.Errorf("stackFingerprint length = %d, want 16", len(got))
+			}
+		})
+	}
+}
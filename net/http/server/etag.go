@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/TelephoneTan/GoHTTPServer/net/http/header"
+	"github.com/TelephoneTan/GoLog/log"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+const (
+	defaultETagMaxFileSize = 64 << 20
+	maxETagCacheEntries    = 1 << 16
+)
+
+// 用于缓存 ETag 的文件标识，文件内容改变后大小或修改时间会随之改变
+type fileKey struct {
+	dev uint64
+	ino uint64
+	// 无法获取 inode 号时使用路径
+	path    string
+	size    int64
+	modTime int64
+}
+
+func newFileKey(filePath string, info os.FileInfo) fileKey {
+	key := fileKey{size: info.Size(), modTime: info.ModTime().UnixNano()}
+	if dev, ino, ok := fileID(info); ok {
+		key.dev, key.ino = dev, ino
+	} else {
+		key.path = filePath
+	}
+	return key
+}
+
+type etagEntry struct {
+	once sync.Once
+	etag string
+	err  error
+}
+
+// 文件标识 -> ETag，同一个文件同时只会被计算一次
+type etagCache struct {
+	lock    sync.Mutex
+	entries map[fileKey]*etagEntry
+}
+
+var fileETags = &etagCache{}
+
+func (c *etagCache) get(key fileKey, compute func() (string, error)) (string, error) {
+	c.lock.Lock()
+	entry, has := c.entries[key]
+	if !has {
+		if c.entries == nil {
+			c.entries = map[fileKey]*etagEntry{}
+		}
+		if len(c.entries) >= maxETagCacheEntries {
+			// 随机淘汰四分之一，被替换的文件的旧条目不会再被访问
+			for k := range c.entries {
+				delete(c.entries, k)
+				if len(c.entries) < maxETagCacheEntries*3/4 {
+					break
+				}
+			}
+		}
+		entry = &etagEntry{}
+		c.entries[key] = entry
+	}
+	c.lock.Unlock()
+	entry.once.Do(func() {
+		entry.etag, entry.err = compute()
+	})
+	if entry.err != nil {
+		// 出错的结果不缓存
+		c.lock.Lock()
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+		}
+		c.lock.Unlock()
+	}
+	return entry.etag, entry.err
+}
+
+// 根据内容计算强 ETag
+func hashETag(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, nil
+}
+
+func (s Server) etagMaxFileSize() int64 {
+	if s.GetETagMaxFileSize == nil {
+		return defaultETagMaxFileSize
+	}
+	return s.GetETagMaxFileSize()
+}
+
+// 为文件设置 ETag 头部，http.ServeContent 据此处理 If-None-Match、If-Match 和 If-Range
+//
+// 计算 ETag 会读取文件内容，但 http.ServeContent 总是先定位到开头再读取。
+// 回复经过压缩（例如 gzip.Handler 设置了 Content-Encoding，或者发送的是预压缩文件）时使用弱 ETag，因为压缩结果不一定逐字节相同
+func (s Server) setFileETag(w http.ResponseWriter, file *servedFile) {
+	if file.info.Size() > s.etagMaxFileSize() {
+		return
+	}
+	etag := file.etag
+	if etag == "" {
+		var err error
+		etag, err = fileETags.get(newFileKey(file.path, file.info), func() (string, error) {
+			return hashETag(file.content)
+		})
+		if err != nil {
+			log.EF("计算文件 (%s) 的 ETag 失败：%v", file.path, err)
+			return
+		}
+	}
+	if w.Header().Get(header.ContentEncoding) != "" {
+		etag = "W/" + etag
+	}
+	w.Header().Set(header.ETag, etag)
+}
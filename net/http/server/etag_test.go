@@ -0,0 +1,111 @@
+package server
+
+import (
+	"errors"
+	"github.com/TelephoneTan/GoHTTPGzipServer/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestETagCacheComputesOnce(t *testing.T) {
+	var cache etagCache
+	var computed atomic.Int32
+	release := make(chan struct{})
+	key := fileKey{path: "/a", size: 1}
+	var wg sync.WaitGroup
+	etags := make([]string, 32)
+	for i := range etags {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			etags[i], _ = cache.get(key, func() (string, error) {
+				computed.Add(1)
+				<-release
+				return `"x"`, nil
+			})
+		}(i)
+	}
+	close(release)
+	wg.Wait()
+	if n := computed.Load(); n != 1 {
+		t.Errorf("computed %d times, want 1", n)
+	}
+	for i, etag := range etags {
+		if etag != `"x"` {
+			t.Fatalf("etags[%d] = %q", i, etag)
+		}
+	}
+	// 出错的结果不缓存
+	other := fileKey{path: "/b"}
+	if _, err := cache.get(other, func() (string, error) { return "", errors.New("read error") }); err == nil {
+		t.Fatal("get() error = nil")
+	}
+	if etag, err := cache.get(other, func() (string, error) { return `"y"`, nil }); err != nil || etag != `"y"` {
+		t.Errorf("get() after error = %q, %v", etag, err)
+	}
+}
+
+func TestFileETag(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.css")
+	if err := os.WriteFile(file, []byte(strings.Repeat("a{}", 100)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(nil, nil)
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.HandleFile(w, r, file, false)
+	})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/app.css", nil))
+	strong := w.Header().Get("ETag")
+	if !strings.HasPrefix(strong, `"`) {
+		t.Fatalf("ETag = %q, want a strong ETag", strong)
+	}
+	weak := "W/" + strong
+	tests := []struct {
+		name       string
+		gzip       bool
+		header     map[string]string
+		wantStatus int
+		wantETag   string
+	}{
+		{"plain", false, nil, http.StatusOK, strong},
+		{"If-None-Match matches", false, map[string]string{"If-None-Match": strong}, http.StatusNotModified, strong},
+		{"If-None-Match weak matches", false, map[string]string{"If-None-Match": weak}, http.StatusNotModified, strong},
+		{"If-None-Match any", false, map[string]string{"If-None-Match": "*"}, http.StatusNotModified, strong},
+		{"If-None-Match other", false, map[string]string{"If-None-Match": `"other"`}, http.StatusOK, strong},
+		{"If-Match matches", false, map[string]string{"If-Match": strong}, http.StatusOK, strong},
+		{"If-Match other", false, map[string]string{"If-Match": `"other"`}, http.StatusPreconditionFailed, strong},
+		{"gzip uses weak ETag", true, nil, http.StatusOK, weak},
+		{"gzip If-None-Match weak", true, map[string]string{"If-None-Match": weak}, http.StatusNotModified, weak},
+		{"gzip If-None-Match strong", true, map[string]string{"If-None-Match": strong}, http.StatusNotModified, weak},
+		// If-Match 使用强比较，弱 ETag 不匹配
+		{"gzip If-Match", true, map[string]string{"If-Match": weak}, http.StatusPreconditionFailed, weak},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handler
+			r := httptest.NewRequest("GET", "/app.css", nil)
+			if tt.gzip {
+				h = &gzip.Handler{Handler: handler}
+				r.Header.Set("Accept-Encoding", "gzip")
+			}
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusPreconditionFailed && w.Header().Get("ETag") != tt.wantETag {
+				t.Errorf("ETag = %q, want %q", w.Header().Get("ETag"), tt.wantETag)
+			}
+		})
+	}
+}
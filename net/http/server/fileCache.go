@@ -0,0 +1,247 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFileCacheMaxSize       = 64 << 20
+	defaultFileCacheMaxFileSize   = 1 << 20
+	defaultFileCacheCheckInterval = time.Second
+)
+
+type fileCacheEntry struct {
+	path string
+	// 为空表示文件不存在，只用于预压缩文件，见 Server.openVariant
+	info    os.FileInfo
+	content []byte
+	etag    string
+	// 上一次确认文件没有变化的时间
+	checked time.Time
+	element *list.Element
+}
+
+type _FileCache struct {
+	// 缓存内容的总大小上限（字节），默认为 64 MiB
+	GetMaxSize func() int64
+	// 可以缓存的最大文件大小（字节），默认为 1 MiB，更大的文件总是从磁盘读取
+	GetMaxFileSize func() int64
+	// 命中时距离上一次检查超过此时长则重新检查文件的大小和修改时间，默认为 1 秒，为 0 时每次命中都检查
+	GetCheckInterval func() time.Duration
+	lock             sync.Mutex
+	entries          map[string]*fileCacheEntry
+	// 最近使用的在前
+	lru  *list.List
+	size int64
+	// 记录为不存在的文件数
+	missing   int
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// FileCache 是文件服务器的内存缓存，按路径缓存文件的内容和元数据，超过容量时淘汰最久没有使用的文件
+//
+// 设置在 Server.FileCache 上，预压缩的 .br 和 .gz 文件按各自的路径缓存，不存在的预压缩文件也会被记住，与其他文件一样按检查间隔重新检查；
+// 预压缩文件的查找不计入命中和未命中。
+// 缓存键是文件服务器拼接出的路径，不解析符号链接，因此经由不同路径（例如符号链接）访问的同一个文件会各自缓存一份，
+// 符号链接被改为指向其他文件时，也要等到检查时发现大小或修改时间变化才会更新。
+// 文件的变化通过大小和修改时间发现，检查间隔内的变化不会被发现
+type FileCache = *_FileCache
+
+func NewFileCache(init ...func(FileCache)) FileCache {
+	c := &_FileCache{
+		entries: map[string]*fileCacheEntry{},
+		lru:     list.New(),
+	}
+	if len(init) > 0 {
+		init[0](c)
+	}
+	return c
+}
+
+// FileCacheStats 是 FileCache 的统计数据
+type FileCacheStats struct {
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	Evictions uint64  `json:"evictions"`
+	Entries   int     `json:"entries"`
+	Size      int64   `json:"size"`
+	HitRatio  float64 `json:"hitRatio"`
+}
+
+func (c FileCache) Stats() FileCacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	stats := FileCacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   len(c.entries) - c.missing,
+		Size:      c.size,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRatio = float64(c.hits) / float64(total)
+	}
+	return stats
+}
+
+// WritePrometheus 以 Prometheus 文本格式输出统计数据
+func (c FileCache) WritePrometheus(w io.Writer) {
+	stats := c.Stats()
+	_, _ = fmt.Fprintf(w, "# HELP http_file_cache_hits_total Number of file server lookups served from memory.\n# TYPE http_file_cache_hits_total counter\nhttp_file_cache_hits_total %d\n", stats.Hits)
+	_, _ = fmt.Fprintf(w, "# HELP http_file_cache_misses_total Number of file server lookups that read from disk.\n# TYPE http_file_cache_misses_total counter\nhttp_file_cache_misses_total %d\n", stats.Misses)
+	_, _ = fmt.Fprintf(w, "# HELP http_file_cache_evictions_total Number of files evicted from the cache.\n# TYPE http_file_cache_evictions_total counter\nhttp_file_cache_evictions_total %d\n", stats.Evictions)
+	_, _ = fmt.Fprintf(w, "# HELP http_file_cache_entries Number of cached files.\n# TYPE http_file_cache_entries gauge\nhttp_file_cache_entries %d\n", stats.Entries)
+	_, _ = fmt.Fprintf(w, "# HELP http_file_cache_size_bytes Total size of cached files.\n# TYPE http_file_cache_size_bytes gauge\nhttp_file_cache_size_bytes %d\n", stats.Size)
+	_, _ = fmt.Fprintf(w, "# HELP http_file_cache_hit_ratio Ratio of lookups served from memory.\n# TYPE http_file_cache_hit_ratio gauge\nhttp_file_cache_hit_ratio %s\n", formatFloat(stats.HitRatio))
+}
+
+func (c FileCache) maxSize() int64 {
+	if c.GetMaxSize == nil {
+		return defaultFileCacheMaxSize
+	}
+	return c.GetMaxSize()
+}
+
+func (c FileCache) maxFileSize() int64 {
+	if c.GetMaxFileSize == nil {
+		return defaultFileCacheMaxFileSize
+	}
+	return c.GetMaxFileSize()
+}
+
+func (c FileCache) checkInterval() time.Duration {
+	if c.GetCheckInterval == nil {
+		return defaultFileCacheCheckInterval
+	}
+	return c.GetCheckInterval()
+}
+
+func sameFile(a os.FileInfo, b os.FileInfo) bool {
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime()) && a.Mode() == b.Mode()
+}
+
+// 检查结果是否与缓存一致：记录为不存在的文件仍然不存在，或者存在的文件没有变化
+func (entry *fileCacheEntry) unchanged(info os.FileInfo, err error) bool {
+	if entry.info == nil {
+		return errors.Is(err, fs.ErrNotExist)
+	}
+	return err == nil && sameFile(info, entry.info)
+}
+
+func (c FileCache) remove(entry *fileCacheEntry) {
+	c.lru.Remove(entry.element)
+	delete(c.entries, entry.path)
+	c.size -= int64(len(entry.content))
+	if entry.info == nil {
+		c.missing--
+	}
+}
+
+func (c FileCache) add(entry *fileCacheEntry) {
+	if existing, has := c.entries[entry.path]; has {
+		c.remove(existing)
+	}
+	entry.element = c.lru.PushFront(entry)
+	c.entries[entry.path] = entry
+	c.size += int64(len(entry.content))
+	if entry.info == nil {
+		c.missing++
+	}
+	for c.size > c.maxSize() {
+		oldest := c.lru.Back().Value.(*fileCacheEntry)
+		c.remove(oldest)
+		c.evictions++
+	}
+}
+
+// 查找缓存的文件，文件已经变化时视为没有命中
+func (c FileCache) get(filePath string) (*fileCacheEntry, bool) {
+	entry, hit := c.lookup(filePath)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if hit {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return entry, hit
+}
+
+// 与 get 相同，但不计入命中和未命中
+func (c FileCache) lookup(filePath string) (*fileCacheEntry, bool) {
+	c.lock.Lock()
+	entry, has := c.entries[filePath]
+	if !has {
+		c.lock.Unlock()
+		return nil, false
+	}
+	fresh := time.Since(entry.checked) < c.checkInterval()
+	c.lock.Unlock()
+	if !fresh {
+		// 在锁外检查文件，以免阻塞其他请求
+		info, err := os.Stat(filePath)
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		if !entry.unchanged(info, err) {
+			if c.entries[filePath] == entry {
+				c.remove(entry)
+			}
+			return nil, false
+		}
+		entry.checked = time.Now()
+	} else {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+	}
+	if c.entries[filePath] == entry {
+		c.lru.MoveToFront(entry.element)
+	}
+	return entry, true
+}
+
+// 读取已打开的文件 f 并加入缓存，文件太大或不是普通文件时返回 false
+func (c FileCache) put(filePath string, info os.FileInfo, f io.Reader) (*fileCacheEntry, bool) {
+	if !info.Mode().IsRegular() || info.Size() > c.maxFileSize() || info.Size() > c.maxSize() {
+		return nil, false
+	}
+	content := make([]byte, info.Size())
+	if _, err := io.ReadFull(f, content); err != nil {
+		return nil, false
+	}
+	etag, err := hashETag(bytes.NewReader(content))
+	if err != nil {
+		return nil, false
+	}
+	entry := &fileCacheEntry{path: filePath, info: info, content: content, etag: etag, checked: time.Now()}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.add(entry)
+	return entry, true
+}
+
+// 记住 filePath 不存在
+func (c FileCache) putMissing(filePath string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.add(&fileCacheEntry{path: filePath, checked: time.Now()})
+}
+
+// Purge 清空缓存
+func (c FileCache) Purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = map[string]*fileCacheEntry{}
+	c.lru.Init()
+	c.size = 0
+	c.missing = 0
+}
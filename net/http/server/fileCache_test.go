@@ -0,0 +1,155 @@
+package server
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c", "d", "big"} {
+		size := 10
+		if name == "big" {
+			size = 30
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Repeat(name[:1], size)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache := NewFileCache(func(c FileCache) {
+		c.GetMaxSize = func() int64 { return 30 }
+		c.GetMaxFileSize = func() int64 { return 20 }
+		c.GetCheckInterval = func() time.Duration { return time.Hour }
+	})
+	s := NewServer(nil, nil, func(s Server) { s.FileCache = cache })
+	steps := []struct {
+		// 依次打开的文件
+		open        string
+		wantCached  []string
+		wantMissing []string
+	}{
+		{"a", []string{"a"}, nil},
+		{"b", []string{"a", "b"}, nil},
+		{"c", []string{"a", "b", "c"}, nil},
+		// 命中使 a 成为最近使用的文件
+		{"a", []string{"a", "b", "c"}, nil},
+		// 超过容量时淘汰最久没有使用的 b
+		{"d", []string{"a", "c", "d"}, []string{"b"}},
+		// 太大的文件不缓存，也不淘汰其他文件
+		{"big", []string{"a", "c", "d"}, []string{"big"}},
+	}
+	for _, step := range steps {
+		file, err := s.openFile(filepath.Join(dir, step.open))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.close()
+		for _, name := range step.wantCached {
+			if _, has := cache.entries[filepath.Join(dir, name)]; !has {
+				t.Errorf("after opening %s: %s is not cached", step.open, name)
+			}
+		}
+		for _, name := range step.wantMissing {
+			if _, has := cache.entries[filepath.Join(dir, name)]; has {
+				t.Errorf("after opening %s: %s is cached", step.open, name)
+			}
+		}
+	}
+	stats := cache.Stats()
+	if stats.Evictions != 1 || stats.Size != 30 || stats.Entries != 3 || stats.Hits != 1 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestFileCacheNoticesChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a")
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewFileCache(func(c FileCache) {
+		c.GetCheckInterval = func() time.Duration { return 0 }
+	})
+	s := NewServer(nil, nil, func(s Server) { s.FileCache = cache })
+	read := func() string {
+		file, err := s.openFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.close()
+		buf := make([]byte, file.info.Size())
+		_, _ = file.content.Read(buf)
+		return string(buf)
+	}
+	if got := read(); got != "old" {
+		t.Fatalf("read() = %q", got)
+	}
+	if err := os.WriteFile(path, []byte("newer"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); got != "newer" {
+		t.Errorf("read() after change = %q, want newer", got)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.openFile(path); err == nil {
+		t.Error("openFile() after removal = nil error")
+	}
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Errorf("Stats() after removal = %+v", stats)
+	}
+}
+
+func TestFileCacheWithPrecompressedFiles(t *testing.T) {
+	tests := []struct {
+		name          string
+		checkInterval time.Duration
+		// 请求之间新建的 .br 文件是否会被发现
+		wantNewVariant bool
+	}{
+		{"missing variants are remembered", time.Hour, false},
+		{"missing variants are checked again", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "app.js")
+			if err := os.WriteFile(source, []byte("source"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			cache := NewFileCache(func(c FileCache) {
+				c.GetCheckInterval = func() time.Duration { return tt.checkInterval }
+			})
+			s := NewServer(nil, nil, func(s Server) {
+				s.FileCache = cache
+				s.HasPrecompressedFiles = func() bool { return true }
+			})
+			serve := func() string {
+				r := httptest.NewRequest("GET", "/app.js", nil)
+				r.Header.Set("Accept-Encoding", "br, gzip")
+				w := httptest.NewRecorder()
+				s.HandleFile(w, r, source, false)
+				return w.Header().Get("Content-Encoding")
+			}
+			for i := 0; i < 5; i++ {
+				if encoding := serve(); encoding != "" {
+					t.Fatalf("Content-Encoding = %q without variants", encoding)
+				}
+			}
+			// 只有原文件计入命中和未命中
+			if stats := cache.Stats(); stats.Hits != 4 || stats.Misses != 1 || stats.Entries != 1 {
+				t.Errorf("Stats() = %+v, want 4 hits, 1 miss and 1 entry", stats)
+			}
+			if err := os.WriteFile(source+".br", []byte("brotli"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if got := serve() == "br"; got != tt.wantNewVariant {
+				t.Errorf("new variant served = %v, want %v", got, tt.wantNewVariant)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package server
+
+import "os"
+
+// 这些系统上 os.FileInfo 不提供 inode 号，只能使用路径标识文件
+func fileID(os.FileInfo) (dev uint64, ino uint64, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,18 @@
+//go:build !windows && !plan9
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// 文件所在的设备号和 inode 号
+func fileID(info os.FileInfo) (dev uint64, ino uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	//goland:noinspection GoRedundantConversion
+	return uint64(st.Dev), uint64(st.Ino), true
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"github.com/TelephoneTan/GoHTTPServer/util"
+	"github.com/TelephoneTan/GoLog/log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// EffectiveRequest 是请求在客户端看来的样子
+//
+// 请求来自可信代理（见 Container.GetTrustedProxies）时，根据 Forwarded 或 X-Forwarded-For/Proto/Host/Port 头部还原，
+// 否则就是连接本身的信息
+type EffectiveRequest struct {
+	ClientIP net.IP
+	// http 或 https
+	Scheme string
+	// 与 Host 头部的形式相同，可能带有端口
+	Host string
+	// 是否应用了可信代理的转发头部
+	Forwarded bool
+}
+
+// Origin 返回 scheme://host 形式的源，省略协议的默认端口
+func (e EffectiveRequest) Origin() string {
+	host := e.Host
+	if _, port := extractPort(host); host != "" &&
+		(e.Scheme == "https" && port == "443" || e.Scheme == "http" && port == "80") {
+		host = extractHost(host)
+	}
+	return e.Scheme + "://" + host
+}
+
+func directRequest(r *http.Request) EffectiveRequest {
+	e := EffectiveRequest{ClientIP: util.RemoteIP(r.RemoteAddr), Scheme: "http", Host: r.Host}
+	if r.TLS != nil {
+		e.Scheme = "https"
+	}
+	return e
+}
+
+// Effective 返回请求的 EffectiveRequest，没有经过 Container 的请求总是使用连接本身的信息
+func Effective(r *http.Request) EffectiveRequest {
+	if state := getRequestState(r); state != nil && state.effective != nil {
+		return *state.effective
+	}
+	return directRequest(r)
+}
+
+// 按照 RFC 7239 拆分 Forwarded 头部，每个元素是一个参数表，参数名为小写
+func parseForwarded(values []string) []map[string]string {
+	var elements []map[string]string
+	for _, value := range values {
+		element := map[string]string{}
+		for len(value) > 0 {
+			value = strings.TrimLeft(value, " \t;")
+			if value == "" {
+				break
+			}
+			if value[0] == ',' {
+				elements = append(elements, element)
+				element = map[string]string{}
+				value = value[1:]
+				continue
+			}
+			eq := strings.IndexByte(value, '=')
+			if eq == -1 {
+				break
+			}
+			key := strings.ToLower(strings.TrimSpace(value[:eq]))
+			value = value[eq+1:]
+			var v string
+			if strings.HasPrefix(value, `"`) {
+				var sb strings.Builder
+				i := 1
+				for ; i < len(value) && value[i] != '"'; i++ {
+					if value[i] == '\\' && i+1 < len(value) {
+						i++
+					}
+					sb.WriteByte(value[i])
+				}
+				v = sb.String()
+				if i < len(value) { // 跳过结尾的引号
+					i++
+				}
+				value = value[i:]
+			} else {
+				end := strings.IndexAny(value, ";,")
+				if end == -1 {
+					end = len(value)
+				}
+				v = strings.TrimSpace(value[:end])
+				value = value[end:]
+			}
+			element[key] = v
+		}
+		elements = append(elements, element)
+	}
+	return elements
+}
+
+func validScheme(scheme string) (string, bool) {
+	scheme = strings.ToLower(strings.TrimSpace(scheme))
+	return scheme, scheme == "http" || scheme == "https"
+}
+
+func validHost(host string) bool {
+	return host != "" && !strings.ContainsAny(host, " \t/\\@?#")
+}
+
+// 逗号分隔的多个头部值中最右边的一个，即离本服务最近的代理添加的值
+func lastHeaderValue(r *http.Request, key string) string {
+	values := r.Header.Values(key)
+	if len(values) == 0 {
+		return ""
+	}
+	parts := strings.Split(values[len(values)-1], ",")
+	return strings.TrimSpace(parts[len(parts)-1])
+}
+
+func resolveForwarded(r *http.Request, proxies util.IPRangeSet) EffectiveRequest {
+	e := directRequest(r)
+	if !proxies.Contains(e.ClientIP) {
+		return e
+	}
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		// 从右向左，即从最近的代理开始，直到遇到不可信的地址
+		elements := parseForwarded(values)
+		for i := len(elements) - 1; i >= 0; i-- {
+			element := elements[i]
+			// for 参数可能带有端口，也可能是 unknown 或混淆的标识符
+			ip := util.RemoteIP(element["for"])
+			if ip != nil {
+				e.ClientIP = ip
+			}
+			if scheme, ok := validScheme(element["proto"]); ok {
+				e.Scheme = scheme
+			}
+			if host := element["host"]; validHost(host) {
+				e.Host = host
+			}
+			e.Forwarded = true
+			if ip == nil || !proxies.Contains(ip) {
+				break
+			}
+		}
+		return e
+	}
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := util.RemoteIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		e.ClientIP = ip
+		e.Forwarded = true
+		if !proxies.Contains(ip) {
+			break
+		}
+	}
+	if scheme, ok := validScheme(lastHeaderValue(r, "X-Forwarded-Proto")); ok {
+		e.Scheme = scheme
+		e.Forwarded = true
+	}
+	if host := lastHeaderValue(r, "X-Forwarded-Host"); validHost(host) {
+		e.Host = host
+		e.Forwarded = true
+	}
+	if port := lastHeaderValue(r, "X-Forwarded-Port"); port != "" && e.Host != "" {
+		if _, err := strconv.ParseUint(port, 10, 16); err == nil {
+			e.Host = extractHost(e.Host) + ":" + port
+			e.Forwarded = true
+		}
+	}
+	return e
+}
+
+func (c Container) trustedProxies() util.IPRangeSet {
+	if c.GetTrustedProxies == nil {
+		return util.IPRangeSet{}
+	}
+	proxies := c.GetTrustedProxies()
+	return c.trustedProxySet.get(listKey(nil).strings(proxies), func() util.IPRangeSet {
+		set, err := util.ParseIPRangeSet(proxies...)
+		if err != nil {
+			log.E("可信代理列表有误：", err)
+		}
+		return set
+	})
+}
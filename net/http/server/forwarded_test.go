@@ -0,0 +1,134 @@
+package server
+
+import (
+	"crypto/tls"
+	"github.com/TelephoneTan/GoHTTPServer/util"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseForwarded(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []map[string]string
+	}{
+		{"single element", []string{"for=192.0.2.60;proto=http;by=203.0.113.43"},
+			[]map[string]string{{"for": "192.0.2.60", "proto": "http", "by": "203.0.113.43"}}},
+		{"case insensitive keys", []string{"For=192.0.2.60; PROTO=https"},
+			[]map[string]string{{"for": "192.0.2.60", "proto": "https"}}},
+		{"multiple elements", []string{"for=192.0.2.43, for=198.51.100.17"},
+			[]map[string]string{{"for": "192.0.2.43"}, {"for": "198.51.100.17"}}},
+		{"multiple headers", []string{"for=192.0.2.43", "for=198.51.100.17;host=a.com"},
+			[]map[string]string{{"for": "192.0.2.43"}, {"for": "198.51.100.17", "host": "a.com"}}},
+		{"quoted IPv6 with port", []string{`for="[2001:db8:cafe::17]:4711"`},
+			[]map[string]string{{"for": "[2001:db8:cafe::17]:4711"}}},
+		{"quoted separators", []string{`for="a,b;c";host=x.com`},
+			[]map[string]string{{"for": "a,b;c", "host": "x.com"}}},
+		{"escaped quote", []string{`for="a\"b"`},
+			[]map[string]string{{"for": `a"b`}}},
+		{"unterminated quote", []string{`for="192.0.2.1`},
+			[]map[string]string{{"for": "192.0.2.1"}}},
+		{"missing value stops", []string{"for=192.0.2.1;garbage"},
+			[]map[string]string{{"for": "192.0.2.1"}}},
+		{"empty", []string{""}, []map[string]string{{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseForwarded(tt.values); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseForwarded(%q) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveForwarded(t *testing.T) {
+	proxies, err := util.ParseIPRangeSet("10.0.0.0/8", "::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		tls        bool
+		header     map[string]string
+		want       EffectiveRequest
+	}{
+		{"untrusted peer ignores headers", "192.0.2.1:1", false,
+			map[string]string{"X-Forwarded-For": "198.51.100.1", "Forwarded": "for=198.51.100.2;proto=https"},
+			EffectiveRequest{ClientIP: net.ParseIP("192.0.2.1"), Scheme: "http", Host: "example.com"}},
+		{"direct TLS", "192.0.2.1:1", true, nil,
+			EffectiveRequest{ClientIP: net.ParseIP("192.0.2.1"), Scheme: "https", Host: "example.com"}},
+		{"trusted peer without headers", "10.0.0.1:1", false, nil,
+			EffectiveRequest{ClientIP: net.ParseIP("10.0.0.1"), Scheme: "http", Host: "example.com"}},
+		{"forwarded", "10.0.0.1:1", false,
+			map[string]string{"Forwarded": "for=198.51.100.1;proto=https;host=a.com"},
+			EffectiveRequest{ClientIP: net.ParseIP("198.51.100.1"), Scheme: "https", Host: "a.com", Forwarded: true}},
+		{"forwarded skips trusted hops", "10.0.0.1:1", false,
+			map[string]string{"Forwarded": `for=203.0.113.9, for=198.51.100.1, for="10.0.0.2:80"`},
+			EffectiveRequest{ClientIP: net.ParseIP("198.51.100.1"), Scheme: "http", Host: "example.com", Forwarded: true}},
+		{"forwarded stops at unknown", "10.0.0.1:1", false,
+			map[string]string{"Forwarded": "for=198.51.100.1, for=unknown;proto=https"},
+			EffectiveRequest{ClientIP: net.ParseIP("10.0.0.1"), Scheme: "https", Host: "example.com", Forwarded: true}},
+		{"forwarded IPv6", "[::1]:1", false,
+			map[string]string{"Forwarded": `for="[2001:db8::1]:4711"`},
+			EffectiveRequest{ClientIP: net.ParseIP("2001:db8::1"), Scheme: "http", Host: "example.com", Forwarded: true}},
+		{"forwarded ignores invalid proto and host", "10.0.0.1:1", false,
+			map[string]string{"Forwarded": "for=198.51.100.1;proto=ftp;host=a.com/evil"},
+			EffectiveRequest{ClientIP: net.ParseIP("198.51.100.1"), Scheme: "http", Host: "example.com", Forwarded: true}},
+		{"forwarded wins over X-Forwarded", "10.0.0.1:1", false,
+			map[string]string{"Forwarded": "for=198.51.100.1", "X-Forwarded-For": "198.51.100.2", "X-Forwarded-Proto": "https"},
+			EffectiveRequest{ClientIP: net.ParseIP("198.51.100.1"), Scheme: "http", Host: "example.com", Forwarded: true}},
+		{"X-Forwarded-For skips trusted hops", "10.0.0.1:1", false,
+			map[string]string{"X-Forwarded-For": "203.0.113.9, 198.51.100.1, 10.0.0.2"},
+			EffectiveRequest{ClientIP: net.ParseIP("198.51.100.1"), Scheme: "http", Host: "example.com", Forwarded: true}},
+		{"X-Forwarded-For stops at garbage", "10.0.0.1:1", false,
+			map[string]string{"X-Forwarded-For": "198.51.100.1, garbage, 10.0.0.2"},
+			EffectiveRequest{ClientIP: net.ParseIP("10.0.0.2"), Scheme: "http", Host: "example.com", Forwarded: true}},
+		{"X-Forwarded proto, host and port", "10.0.0.1:1", false,
+			map[string]string{"X-Forwarded-Proto": "HTTPS", "X-Forwarded-Host": "a.com:8080", "X-Forwarded-Port": "8443"},
+			EffectiveRequest{ClientIP: net.ParseIP("10.0.0.1"), Scheme: "https", Host: "a.com:8443", Forwarded: true}},
+		{"X-Forwarded uses the nearest value", "10.0.0.1:1", false,
+			map[string]string{"X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "evil.com, a.com"},
+			EffectiveRequest{ClientIP: net.ParseIP("10.0.0.1"), Scheme: "http", Host: "a.com", Forwarded: true}},
+		{"invalid X-Forwarded-Port", "10.0.0.1:1", false,
+			map[string]string{"X-Forwarded-Port": "99999"},
+			EffectiveRequest{ClientIP: net.ParseIP("10.0.0.1"), Scheme: "http", Host: "example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://example.com/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			got := resolveForwarded(r, proxies)
+			if !got.ClientIP.Equal(tt.want.ClientIP) || got.Scheme != tt.want.Scheme || got.Host != tt.want.Host || got.Forwarded != tt.want.Forwarded {
+				t.Errorf("resolveForwarded() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveRequestOrigin(t *testing.T) {
+	tests := []struct {
+		scheme, host string
+		want         string
+	}{
+		{"https", "a.com:443", "https://a.com"},
+		{"http", "a.com:80", "http://a.com"},
+		{"https", "a.com:80", "https://a.com:80"},
+		{"http", "a.com", "http://a.com"},
+		{"https", "[::1]:443", "https://[::1]"},
+	}
+	for _, tt := range tests {
+		if got := (EffectiveRequest{Scheme: tt.scheme, Host: tt.host}).Origin(); got != tt.want {
+			t.Errorf("Origin(%s, %s) = %s, want %s", tt.scheme, tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLivenessPath       = "/livez"
+	defaultReadinessPath      = "/readyz"
+	defaultHealthPath         = "/healthz"
+	defaultHealthCheckTimeout = 5 * time.Second
+)
+
+// HealthCheck 检查应用的某项依赖，返回错误表示检查不通过，ctx 在超时后被取消
+type HealthCheck = func(ctx context.Context) error
+
+type HealthCheckOptions struct {
+	// 超时时间，0 视为 5 秒
+	Timeout time.Duration
+	// 为 true 时该检查也用于存活检查，否则只用于就绪检查
+	Liveness bool
+}
+
+type healthCheck struct {
+	name    string
+	check   HealthCheck
+	options HealthCheckOptions
+}
+
+type _Health struct {
+	// 存活检查路径，默认为 /livez
+	LivenessPath string
+	// 就绪检查路径，默认为 /readyz
+	ReadinessPath string
+	// 完整的健康检查路径，默认为 /healthz，结果与就绪检查相同
+	HealthPath string
+	lock       sync.RWMutex
+	checks     []*healthCheck
+}
+
+// Health 为 Container 提供存活、就绪和健康检查接口，设置在 Container.Health 上
+//
+// 这些接口由 Container 直接处理，不经过 Server 的主机匹配。
+// 就绪要求所有非 Optional 的服务都在监听、Container 没有开始优雅停机、并且所有就绪检查都通过；
+// 存活只要求所有标记为 Liveness 的检查通过。回复为 JSON 格式的检查明细，不通过时状态码为 503
+//
+// 路径为空时不提供对应的接口。存活检查的路径不能与其他路径相同，各路径也不能为 /，否则 Container 启动或重新加载时返回错误，冲突的接口不注册
+type Health = *_Health
+
+func NewHealth(init ...func(Health)) Health {
+	h := &_Health{
+		LivenessPath:  defaultLivenessPath,
+		ReadinessPath: defaultReadinessPath,
+		HealthPath:    defaultHealthPath,
+	}
+	if len(init) > 0 {
+		init[0](h)
+	}
+	return h
+}
+
+// Register 注册名为 name 的检查，同名的检查会被替换
+func (h Health) Register(name string, check HealthCheck, options ...HealthCheckOptions) Health {
+	hc := &healthCheck{name: name, check: check}
+	if len(options) > 0 {
+		hc.options = options[0]
+	}
+	if hc.options.Timeout <= 0 {
+		hc.options.Timeout = defaultHealthCheckTimeout
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for i, existing := range h.checks {
+		if existing.name == name {
+			h.checks[i] = hc
+			return h
+		}
+	}
+	h.checks = append(h.checks, hc)
+	return h
+}
+
+// HealthCheckResult 是一项检查的结果
+type HealthCheckResult struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// HealthReport 是健康检查接口的回复
+type HealthReport struct {
+	OK       bool                `json:"ok"`
+	Draining bool                `json:"draining,omitempty"`
+	Services []HealthCheckResult `json:"services,omitempty"`
+	Checks   []HealthCheckResult `json:"checks"`
+}
+
+func (hc *healthCheck) run(ctx context.Context) (result HealthCheckResult) {
+	start := time.Now()
+	result.Name = hc.name
+	ctx, cancel := context.WithTimeout(ctx, hc.options.Timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("panic: %v", p)
+			}
+		}()
+		done <- hc.check(ctx)
+	}()
+	var err error
+	// 检查函数可能不理会 ctx，因此不能只等待它返回
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %v", hc.options.Timeout)
+		}
+	}
+	result.OK = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Duration = time.Since(start).String()
+	return result
+}
+
+// 并发执行检查，结果按名称排序
+func (h Health) runChecks(ctx context.Context, liveness bool) []HealthCheckResult {
+	h.lock.RLock()
+	checks := h.checks
+	h.lock.RUnlock()
+	results := make([]HealthCheckResult, 0, len(checks))
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for _, hc := range checks {
+		if liveness && !hc.options.Liveness {
+			continue
+		}
+		wg.Add(1)
+		go func(hc *healthCheck) {
+			defer wg.Done()
+			result := hc.run(ctx)
+			lock.Lock()
+			defer lock.Unlock()
+			results = append(results, result)
+		}(hc)
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+func (h Health) report(c Container, r *http.Request, liveness bool) HealthReport {
+	report := HealthReport{OK: true, Checks: h.runChecks(r.Context(), liveness)}
+	for _, result := range report.Checks {
+		report.OK = report.OK && result.OK
+	}
+	if liveness {
+		return report
+	}
+	report.Draining = c.Draining()
+	report.Services = c.serviceStatus()
+	for _, result := range report.Services {
+		report.OK = report.OK && result.OK
+	}
+	report.OK = report.OK && !report.Draining
+	return report
+}
+
+func (h Health) handler(c Container, liveness bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := h.report(c, r, liveness)
+		statusCode := http.StatusOK
+		if !report.OK {
+			statusCode = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, statusCode, report)
+	}
+}
+
+type healthPath struct {
+	name     string
+	path     string
+	liveness bool
+}
+
+func (h Health) paths() []healthPath {
+	return []healthPath{
+		{"LivenessPath", h.LivenessPath, true},
+		{"ReadinessPath", h.ReadinessPath, false},
+		{"HealthPath", h.HealthPath, false},
+	}
+}
+
+// 检查各接口的路径：存活检查与就绪检查的路径相同或者路径为 / 时返回错误，HealthPath 可以与 ReadinessPath 相同
+func (h Health) validate() error {
+	if h == nil {
+		return nil
+	}
+	seen := map[string]healthPath{}
+	for _, p := range h.paths() {
+		if p.path == "" {
+			continue
+		}
+		if p.path == "/" {
+			return fmt.Errorf("health: %s must not be /", p.name)
+		}
+		if other, has := seen[p.path]; has && other.liveness != p.liveness {
+			return fmt.Errorf("health: %s and %s are both %q", other.name, p.name, p.path)
+		}
+		seen[p.path] = p
+	}
+	return nil
+}
+
+// 在 mux 上注册检查接口，重复的路径只注册第一个，路径为 / 的不注册，见 validate
+func (h Health) register(c Container, mux *http.ServeMux) {
+	if h == nil {
+		return
+	}
+	registered := map[string]bool{"/": true}
+	for _, p := range h.paths() {
+		if p.path == "" || registered[p.path] {
+			continue
+		}
+		registered[p.path] = true
+		mux.Handle(p.path, h.handler(c, p.liveness))
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthRegister(t *testing.T) {
+	failing := func(context.Context) error { return errors.New("down") }
+	tests := []struct {
+		name      string
+		liveness  string
+		readiness string
+		health    string
+		wantErr   bool
+		// 各路径期望的状态码，404 表示没有注册
+		want map[string]int
+	}{
+		{"defaults", "/livez", "/readyz", "/healthz", false,
+			map[string]int{"/livez": http.StatusOK, "/readyz": http.StatusServiceUnavailable, "/healthz": http.StatusServiceUnavailable}},
+		{"health same as readiness", "/livez", "/ready", "/ready", false,
+			map[string]int{"/livez": http.StatusOK, "/ready": http.StatusServiceUnavailable}},
+		{"liveness same as readiness", "/check", "/check", "", true,
+			map[string]int{"/check": http.StatusOK}},
+		{"all the same", "/check", "/check", "/check", true,
+			map[string]int{"/check": http.StatusOK}},
+		{"root path", "/", "/readyz", "", true,
+			map[string]int{"/": http.StatusNotFound, "/readyz": http.StatusServiceUnavailable}},
+		{"empty paths", "", "", "", false,
+			map[string]int{"/livez": http.StatusNotFound, "/readyz": http.StatusNotFound}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHealth(func(h Health) {
+				h.LivenessPath = tt.liveness
+				h.ReadinessPath = tt.readiness
+				h.HealthPath = tt.health
+			}).Register("db", failing)
+			if err := h.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+			c := NewContainer(func() []Service { return nil }, nil, nil, func(c Container) {
+				c.ShouldListenOnDefaultPorts = func() bool { return false }
+			})
+			mux := http.NewServeMux()
+			mux.HandleFunc("/", http.NotFound)
+			h.register(c, mux)
+			for path, wantStatus := range tt.want {
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+				if w.Code != wantStatus {
+					t.Errorf("GET %s = %d, want %d", path, w.Code, wantStatus)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"github.com/TelephoneTan/GoLog/log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 判断 GetHosts 中的一项是否为主机名模式：~ 开头的正则、*. 开头的单级通配或 . 开头的后缀，其余都是普通主机名
+func isHostPattern(host string) bool {
+	return strings.HasPrefix(host, "~") || strings.HasPrefix(host, ".") || strings.HasPrefix(host, "*.")
+}
+
+// 编译好的主机名正则，GetHosts 每次都会返回同样的模式，因此缓存起来避免每个请求都重新编译
+var hostRegexps sync.Map
+
+func compileHostRegexp(pattern string) *regexp.Regexp {
+	if re, has := hostRegexps.Load(pattern); has {
+		return re.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile("(?i)^(?:" + pattern + ")$")
+	if err != nil {
+		log.E("主机名正则 ", pattern, " 有误：", err)
+	}
+	// 错误的正则也缓存起来（为 nil），避免重复报错
+	hostRegexps.Store(pattern, re)
+	return re
+}
+
+func matchHostRegexp(host string, pattern string) (matched bool, tenant string) {
+	re := compileHostRegexp(pattern)
+	if re == nil {
+		return false, ""
+	}
+	groups := re.FindStringSubmatch(host)
+	if groups == nil {
+		return false, ""
+	}
+	if i := re.SubexpIndex("tenant"); i > 0 {
+		tenant = groups[i]
+	} else if len(groups) > 1 {
+		tenant = groups[1]
+	}
+	return true, strings.ToLower(tenant)
+}
+
+// suffix 以 . 开头，host 必须在 suffix 之前还有非空的部分
+func matchHostSuffix(host string, suffix string) (matched bool, tenant string) {
+	if len(host) <= len(suffix) {
+		return false, ""
+	}
+	split := len(host) - len(suffix)
+	if !strings.EqualFold(host[split:], suffix) {
+		return false, ""
+	}
+	return true, strings.ToLower(host[:split])
+}
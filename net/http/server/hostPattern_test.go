@@ -0,0 +1,72 @@
+package server
+
+import "testing"
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		name        string
+		hosts       []string
+		host        string
+		wantMatched bool
+		wantPattern string
+		wantTenant  string
+	}{
+		{"no hosts configured", nil, "any.example.com", true, "", ""},
+		{"empty host", []string{"example.com"}, "", false, "", ""},
+		{"exact", []string{"example.com"}, "EXAMPLE.com", true, "example.com", ""},
+		{"exact mismatch", []string{"example.com"}, "www.example.com", false, "", ""},
+		{"IPv6 literal", []string{"[::1]"}, "[::1]", true, "[::1]", ""},
+		{"punycode host", []string{"例子.测试"}, "xn--fsqu00a.xn--0zwm56d", true, "例子.测试", ""},
+		{"wildcard single label", []string{"*.example.com"}, "Shop.example.com", true, "*.example.com", "shop"},
+		{"wildcard multiple labels", []string{"*.example.com"}, "a.b.example.com", false, "", ""},
+		{"wildcard apex", []string{"*.example.com"}, "example.com", false, "", ""},
+		{"suffix apex", []string{".example.com"}, "example.com", true, ".example.com", ""},
+		{"suffix multiple labels", []string{".example.com"}, "a.b.example.com", true, ".example.com", "a.b"},
+		{"suffix not on label boundary", []string{".example.com"}, "badexample.com", false, "", ""},
+		{"regex named tenant", []string{`~(?P<tenant>[a-z]+)-(eu|us)\.example\.com`}, "acme-eu.example.com", true, `~(?P<tenant>[a-z]+)-(eu|us)\.example\.com`, "acme"},
+		{"regex first group", []string{`~([a-z]+)\.example\.com`}, "ACME.example.com", true, `~([a-z]+)\.example\.com`, "acme"},
+		{"regex anchored", []string{`~example\.com`}, "www.example.com", false, "", ""},
+		{"invalid regex skipped", []string{`~(`, "example.com"}, "example.com", true, "example.com", ""},
+		{"first matching pattern wins", []string{".example.com", "*.example.com"}, "a.example.com", true, ".example.com", "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var getHosts func() []string
+			if tt.hosts != nil {
+				hosts := tt.hosts
+				getHosts = func() []string { return hosts }
+			}
+			matched, pattern, tenant := matchHost(tt.host, getHosts)
+			if matched != tt.wantMatched || pattern != tt.wantPattern || tenant != tt.wantTenant {
+				t.Errorf("matchHost(%q) = (%v, %q, %q), want (%v, %q, %q)",
+					tt.host, matched, pattern, tenant, tt.wantMatched, tt.wantPattern, tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestPrimaryHost(t *testing.T) {
+	tests := []struct {
+		name  string
+		hosts []string
+		want  string
+	}{
+		{"no hosts", nil, ""},
+		{"first plain host", []string{"www.example.com", "example.com"}, "www.example.com"},
+		{"skips patterns", []string{"", `~.*\.example\.com`, "*.example.com", ".example.com", "example.com"}, "example.com"},
+		{"only patterns", []string{"*.example.com"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(nil, nil, func(s Server) {
+				if tt.hosts != nil {
+					hosts := tt.hosts
+					s.GetHosts = func() []string { return hosts }
+				}
+			})
+			if got := s.primaryHost(); got != tt.want {
+				t.Errorf("primaryHost() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
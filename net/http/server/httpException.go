@@ -0,0 +1,146 @@
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// 生成错误 ID，格式为：E#纳秒时间戳#随机数
+func newErrorID() string {
+	return fmt.Sprintf("E#%v#%v", time.Now().UnixNano(), rand.Int())
+}
+
+// _HTTPException 是 Exception 的标准实现
+//
+// * 构造时自动生成错误 ID 并记录调用栈
+//
+// * 可以包装一个底层 error，支持 errors.Is 和 errors.As
+//
+// * 可以附带额外的回复头部
+type _HTTPException struct {
+	httpCode   int
+	code       string
+	id         string
+	tipZH      string
+	stackTrace string
+	cause      error
+	header     http.Header
+}
+
+type HTTPException = *_HTTPException
+
+func NewException(httpCode int, code string, tipZH string, init ...func(HTTPException)) HTTPException {
+	if code == "" {
+		code = http.StatusText(httpCode)
+	}
+	e := &_HTTPException{
+		httpCode:   httpCode,
+		code:       code,
+		id:         newErrorID(),
+		tipZH:      tipZH,
+		stackTrace: string(debug.Stack()),
+		header:     http.Header{},
+	}
+	if len(init) > 0 {
+		init[0](e)
+	}
+	return e
+}
+
+// BadRequest 400
+func BadRequest(code string, tipZH string) HTTPException {
+	return NewException(http.StatusBadRequest, code, tipZH)
+}
+
+// Unauthorized 401
+func Unauthorized(code string, tipZH string) HTTPException {
+	return NewException(http.StatusUnauthorized, code, tipZH)
+}
+
+// NotFound 404
+func NotFound(code string, tipZH string) HTTPException {
+	return NewException(http.StatusNotFound, code, tipZH)
+}
+
+// Conflict 409
+func Conflict(code string, tipZH string) HTTPException {
+	return NewException(http.StatusConflict, code, tipZH)
+}
+
+// TooManyRequests 429
+func TooManyRequests(code string, tipZH string) HTTPException {
+	return NewException(http.StatusTooManyRequests, code, tipZH)
+}
+
+// WithCause 设置被包装的底层 error
+func (e HTTPException) WithCause(cause error) HTTPException {
+	e.cause = cause
+	return e
+}
+
+// WithHeader 添加一个额外的回复头部
+func (e HTTPException) WithHeader(key string, value string) HTTPException {
+	e.header.Add(key, value)
+	return e
+}
+
+// WithID 覆盖自动生成的错误 ID
+func (e HTTPException) WithID(id string) HTTPException {
+	e.id = id
+	return e
+}
+
+func (e HTTPException) StackTrace() string {
+	return e.stackTrace
+}
+
+func (e HTTPException) Code() string {
+	return e.code
+}
+
+func (e HTTPException) ID() string {
+	return e.id
+}
+
+func (e HTTPException) HTTPCode() int {
+	return e.httpCode
+}
+
+func (e HTTPException) SetHeader(w http.ResponseWriter) {
+	for key, values := range e.header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+}
+
+func (e HTTPException) TipZH() string {
+	return e.tipZH
+}
+
+func (e HTTPException) Error() string {
+	s := fmt.Sprintf("%d %s", e.httpCode, e.code)
+	if e.tipZH != "" {
+		s += ": " + e.tipZH
+	}
+	if e.cause != nil {
+		s += ": " + e.cause.Error()
+	}
+	return s
+}
+
+func (e HTTPException) Unwrap() error {
+	return e.cause
+}
+
+// Is 认为 HTTP 状态码和错误码都相同的两个 HTTPException 是同一种错误
+func (e HTTPException) Is(target error) bool {
+	t, ok := target.(HTTPException)
+	if !ok || t == nil {
+		return false
+	}
+	return t.httpCode == e.httpCode && t.code == e.code
+}
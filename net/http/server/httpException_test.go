@@ -0,0 +1,130 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var _ Exception = NewException(http.StatusBadRequest, "", "")
+
+func TestExceptionConstructors(t *testing.T) {
+	tests := []struct {
+		name      string
+		exception HTTPException
+		httpCode  int
+		code      string
+		tipZH     string
+		message   string
+	}{
+		{"BadRequest", BadRequest("invalid_name", "名称无效"), http.StatusBadRequest, "invalid_name", "名称无效", "400 invalid_name: 名称无效"},
+		{"Unauthorized", Unauthorized("no_token", ""), http.StatusUnauthorized, "no_token", "", "401 no_token"},
+		{"NotFound", NotFound("no_user", "用户不存在"), http.StatusNotFound, "no_user", "用户不存在", "404 no_user: 用户不存在"},
+		{"Conflict", Conflict("exists", ""), http.StatusConflict, "exists", "", "409 exists"},
+		{"TooManyRequests", TooManyRequests("slow_down", ""), http.StatusTooManyRequests, "slow_down", "", "429 slow_down"},
+		{"default code", NewException(http.StatusForbidden, "", ""), http.StatusForbidden, "Forbidden", "", "403 Forbidden"},
+		{"with cause", NotFound("no_file", "").WithCause(fs.ErrNotExist), http.StatusNotFound, "no_file", "", "404 no_file: file does not exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.exception
+			if e.HTTPCode() != tt.httpCode {
+				t.Errorf("HTTPCode = %d, want %d", e.HTTPCode(), tt.httpCode)
+			}
+			if e.Code() != tt.code {
+				t.Errorf("Code = %q, want %q", e.Code(), tt.code)
+			}
+			if e.TipZH() != tt.tipZH {
+				t.Errorf("TipZH = %q, want %q", e.TipZH(), tt.tipZH)
+			}
+			if e.Error() != tt.message {
+				t.Errorf("Error = %q, want %q", e.Error(), tt.message)
+			}
+			if !strings.Contains(e.StackTrace(), "TestExceptionConstructors") {
+				t.Errorf("StackTrace does not contain the caller:\n%s", e.StackTrace())
+			}
+		})
+	}
+}
+
+func TestExceptionID(t *testing.T) {
+	format := regexp.MustCompile(`^E#\d+#\d+$`)
+	a, b := BadRequest("a", ""), BadRequest("a", "")
+	for _, e := range []HTTPException{a, b} {
+		if !format.MatchString(e.ID()) {
+			t.Errorf("ID = %q, want E#<nanoseconds>#<random>", e.ID())
+		}
+	}
+	if a.ID() == b.ID() {
+		t.Errorf("two exceptions share the ID %q", a.ID())
+	}
+	if got := a.WithID("custom").ID(); got != "custom" {
+		t.Errorf("WithID: ID = %q, want custom", got)
+	}
+	initialized := NewException(http.StatusTeapot, "teapot", "", func(e HTTPException) {
+		e.WithID("from-init")
+	})
+	if initialized.ID() != "from-init" {
+		t.Errorf("init: ID = %q, want from-init", initialized.ID())
+	}
+}
+
+func TestExceptionMatching(t *testing.T) {
+	cause := errors.New("database is down")
+	e := Conflict("exists", "已存在").WithCause(cause)
+	wrapped := fmt.Errorf("creating user: %w", e)
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{"same code", e, Conflict("exists", ""), true},
+		{"wrapped same code", wrapped, Conflict("exists", "其他提示"), true},
+		{"different code", e, Conflict("other", ""), false},
+		{"different status", e, BadRequest("exists", ""), false},
+		{"cause", e, cause, true},
+		{"wrapped cause", wrapped, cause, true},
+		{"unrelated", e, fs.ErrNotExist, false},
+		{"nil exception target", e, HTTPException(nil), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("errors.Is = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var target HTTPException
+	if !errors.As(wrapped, &target) || target != e {
+		t.Errorf("errors.As = %v, want the wrapped exception", target)
+	}
+	if errors.Unwrap(e) != cause {
+		t.Errorf("Unwrap = %v, want %v", errors.Unwrap(e), cause)
+	}
+	if errors.Unwrap(BadRequest("a", "")) != nil {
+		t.Error("Unwrap without cause should be nil")
+	}
+}
+
+func TestExceptionSetHeader(t *testing.T) {
+	e := TooManyRequests("slow_down", "").
+		WithHeader("Retry-After", "30").
+		WithHeader("Vary", "Origin").
+		WithHeader("Vary", "Cookie")
+	w := httptest.NewRecorder()
+	w.Header().Set("Vary", "Accept")
+	e.SetHeader(w)
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	if got := strings.Join(w.Header().Values("Vary"), ","); got != "Accept,Origin,Cookie" {
+		t.Errorf("Vary = %q, want Accept,Origin,Cookie", got)
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"crypto/subtle"
+	"github.com/TelephoneTan/GoHTTPServer/net/http/header"
+	"github.com/TelephoneTan/GoHTTPServer/net/http/method"
+	"github.com/TelephoneTan/GoHTTPServer/net/mime"
+	"github.com/TelephoneTan/GoHTTPServer/util"
+	"github.com/TelephoneTan/GoLog/log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaintenanceOptions 是维护模式的设置
+type MaintenanceOptions struct {
+	// 通过 Retry-After 头部告知客户端多久之后重试，为 0 时不发送
+	RetryAfter time.Duration
+	// 维护页面的 HTML 内容
+	Page string
+	// 维护页面文件的路径，不为空时优先于 Page
+	PageFile string
+	// 不受维护模式影响的客户端 IP、CIDR 或区间，格式与 util.IPRangeSet 相同
+	AllowIPs []string
+	// 携带此 Cookie（且值为 BypassCookieValue）的请求不受维护模式影响
+	BypassCookieName  string
+	BypassCookieValue string
+	// 携带此头部（且值为 BypassHeaderValue）的请求不受维护模式影响
+	BypassHeaderName  string
+	BypassHeaderValue string
+	// 不受维护模式影响的路径，例如健康检查路径 /healthz；以 / 结尾时匹配该路径下的所有路径
+	BypassPaths []string
+}
+
+func secretEqual(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// 开启维护模式时加载好的设置，维护页面文件和允许的 IP 只在开启时读取和解析一次
+type loadedMaintenance struct {
+	options  MaintenanceOptions
+	page     []byte
+	allowIPs util.IPRangeSet
+}
+
+func loadMaintenance(options MaintenanceOptions) *loadedMaintenance {
+	loaded := &loadedMaintenance{options: options, page: []byte(options.Page)}
+	if options.PageFile != "" {
+		if page, err := os.ReadFile(options.PageFile); err == nil {
+			loaded.page = page
+		} else {
+			log.E("读取维护页面失败：", err)
+		}
+	}
+	var err error
+	if loaded.allowIPs, err = util.ParseIPRangeSet(options.AllowIPs...); err != nil {
+		log.E("维护模式的 AllowIPs 有误：", err)
+	}
+	return loaded
+}
+
+func (m *loadedMaintenance) bypass(r *http.Request) bool {
+	o := m.options
+	for _, p := range o.BypassPaths {
+		if r.URL.Path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(r.URL.Path, p) {
+			return true
+		}
+	}
+	if o.BypassHeaderName != "" && o.BypassHeaderValue != "" &&
+		secretEqual(r.Header.Get(o.BypassHeaderName), o.BypassHeaderValue) {
+		return true
+	}
+	if o.BypassCookieName != "" && o.BypassCookieValue != "" {
+		if cookie, err := r.Cookie(o.BypassCookieName); err == nil && secretEqual(cookie.Value, o.BypassCookieValue) {
+			return true
+		}
+	}
+	return !m.allowIPs.Empty() && m.allowIPs.Contains(Effective(r).ClientIP)
+}
+
+// 维护模式下回复 503，返回 false 表示请求不受维护模式影响
+func (s Server) replyMaintenance(w http.ResponseWriter, r *http.Request) bool {
+	m := s.switches.maintenanceSettings.Load()
+	if m == nil {
+		m = loadMaintenance(MaintenanceOptions{})
+	}
+	if m.bypass(r) {
+		return false
+	}
+	if m.options.RetryAfter > 0 {
+		seconds := (m.options.RetryAfter + time.Second - 1) / time.Second
+		w.Header().Set(header.RetryAfter, strconv.FormatInt(int64(seconds), 10))
+	}
+	w.Header().Set(header.CacheControl, "no-store")
+	if len(m.page) > 0 {
+		w.Header().Set(header.ContentType, mime.HTMLUTF8)
+	}
+	w.Header().Set(header.ContentLength, strconv.Itoa(len(m.page)))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if method.Parse(r.Method) != method.HEAD {
+		_, _ = w.Write(m.page)
+	}
+	return true
+}
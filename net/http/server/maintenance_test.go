@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMaintenance(t *testing.T) {
+	pageFile := filepath.Join(t.TempDir(), "maintenance.html")
+	if err := os.WriteFile(pageFile, []byte("<p>down</p>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	options := MaintenanceOptions{
+		RetryAfter:        90 * time.Second,
+		Page:              "unused",
+		PageFile:          pageFile,
+		AllowIPs:          []string{"10.0.0.0/8", "!10.0.0.5"},
+		BypassHeaderName:  "X-Bypass",
+		BypassHeaderValue: "secret",
+		BypassPaths:       []string{"/healthz", "/static/"},
+	}
+	s := NewServer(nil, nil, func(s Server) {
+		s.GetMaintenanceOptions = func() MaintenanceOptions { return options }
+		s.Guard = func(w http.ResponseWriter, _ *http.Request, _ *PathPack) bool {
+			w.WriteHeader(http.StatusNoContent)
+			return true
+		}
+	})
+	s.SetMaintenance(true)
+	// 开启之后修改设置和页面文件不会生效，直到再次调用 SetMaintenance(true)
+	options.BypassPaths = nil
+	if err := os.WriteFile(pageFile, []byte("changed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		remoteAddr string
+		header     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"blocked", "GET", "/", "192.168.0.1:1", "", http.StatusServiceUnavailable, "<p>down</p>"},
+		{"blocked HEAD", "HEAD", "/", "192.168.0.1:1", "", http.StatusServiceUnavailable, ""},
+		{"allowed IP", "GET", "/", "10.1.2.3:1", "", http.StatusNoContent, ""},
+		{"excluded IP", "GET", "/", "10.0.0.5:1", "", http.StatusServiceUnavailable, "<p>down</p>"},
+		{"bypass header", "GET", "/", "192.168.0.1:1", "secret", http.StatusNoContent, ""},
+		{"wrong bypass header", "GET", "/", "192.168.0.1:1", "guess", http.StatusServiceUnavailable, "<p>down</p>"},
+		{"bypass path", "GET", "/healthz", "192.168.0.1:1", "", http.StatusNoContent, ""},
+		{"bypass path prefix", "GET", "/static/app.js", "192.168.0.1:1", "", http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newLocalRequest(tt.method, "http://example.com"+tt.target)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				r.Header.Set("X-Bypass", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.Handle(w, r)
+			if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody {
+				t.Errorf("status = %d, body = %q, want %d, %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+			if tt.wantStatus == http.StatusServiceUnavailable && w.Header().Get("Retry-After") != "90" {
+				t.Errorf("Retry-After = %q, want 90", w.Header().Get("Retry-After"))
+			}
+		})
+	}
+
+	s.SetMaintenance(true)
+	w := httptest.NewRecorder()
+	s.Handle(w, newLocalRequest("GET", "http://example.com/healthz"))
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "changed" {
+		t.Errorf("after reloading: status = %d, body = %q", w.Code, w.Body.String())
+	}
+	s.SetMaintenance(false)
+	w = httptest.NewRecorder()
+	s.Handle(w, newLocalRequest("GET", "http://example.com/"))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("after turning off: status = %d", w.Code)
+	}
+}
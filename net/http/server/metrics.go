@@ -0,0 +1,255 @@
+package server
+
+import (
+	"fmt"
+	"github.com/TelephoneTan/GoHTTPServer/net/http/header"
+	"github.com/TelephoneTan/GoHTTPServer/net/http/method"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var defaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+var defaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000, 100000000}
+
+type metricLabels struct {
+	host        string
+	node        string
+	method      string
+	statusClass string
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+type requestMetric struct {
+	count    uint64
+	panics   uint64
+	duration *histogram
+	size     *histogram
+}
+
+type _Metrics struct {
+	// 延迟直方图的桶（秒）
+	LatencyBuckets []float64
+	// 回复大小直方图的桶（字节）
+	SizeBuckets []float64
+	// 不为空时一并输出文件缓存的统计数据
+	FileCache FileCache
+	lock      sync.Mutex
+	requests  map[metricLabels]*requestMetric
+	inFlight  map[string]int64
+}
+
+// Metrics 统计请求数、延迟、进行中请求数、回复大小和错误数，并以 Prometheus 文本格式输出
+//
+// 标签包括：host（处理该请求的 Server 的 GetHosts 中被匹配的项，例如 *.example.com；未被任何 Server 处理或 Server 不限制主机时为空）、
+// node（处理该请求的节点链，每个节点为其 WordList.Join()）、method 以及 status_class（例如 2xx）
+//
+// 可以设置在 Server 和 Container 上，Server 上的 Metrics 只统计被该 Server 处理的请求；
+// 同一个 Metrics 同时设置在 Container 和它的 Server 上时，每个请求只由 Container 统计一次
+type Metrics = *_Metrics
+
+func NewMetrics(init ...func(Metrics)) Metrics {
+	m := &_Metrics{
+		LatencyBuckets: defaultLatencyBuckets,
+		SizeBuckets:    defaultSizeBuckets,
+		requests:       map[metricLabels]*requestMetric{},
+		inFlight:       map[string]int64{},
+	}
+	if len(init) > 0 {
+		init[0](m)
+	}
+	return m
+}
+
+func statusClass(statusCode int) string {
+	if statusCode < 100 || statusCode > 599 {
+		return "other"
+	}
+	return strconv.Itoa(statusCode/100) + "xx"
+}
+
+// 方法名来自客户端，只保留标准方法，避免标签基数失控
+func methodLabel(m string) string {
+	switch parsed := method.Parse(m); parsed {
+	case method.OPTIONS, method.GET, method.HEAD, method.POST, method.PUT,
+		method.DELETE, method.CONNECT, method.TRACE, method.PATCH:
+		return parsed.String()
+	default:
+		return "OTHER"
+	}
+}
+
+func (m Metrics) begin(host string) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.inFlight[host]++
+}
+
+func (m Metrics) end(host string) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.inFlight[host]--
+}
+
+func (m Metrics) observe(labels metricLabels, duration time.Duration, size int64, panicked bool) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	rm, has := m.requests[labels]
+	if !has {
+		rm = &requestMetric{
+			duration: newHistogram(m.LatencyBuckets),
+			size:     newHistogram(m.SizeBuckets),
+		}
+		m.requests[labels] = rm
+	}
+	rm.count++
+	if panicked {
+		rm.panics++
+	}
+	rm.duration.observe(duration.Seconds())
+	rm.size.observe(float64(size))
+}
+
+func (m Metrics) record(r *http.Request, state *requestState) {
+	if m == nil || state == nil {
+		return
+	}
+	entry := newAccessLogEntry(r, state)
+	m.observe(metricLabels{
+		host:        state.metricHost(),
+		node:        strings.Join(entry.Nodes, "/"),
+		method:      methodLabel(entry.Method),
+		statusClass: statusClass(entry.Status),
+	}, entry.Duration, entry.Size, state.errorID != "")
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func (l metricLabels) String() string {
+	return fmt.Sprintf(
+		`host="%s",node="%s",method="%s",status_class="%s"`,
+		escapeLabelValue(l.host),
+		escapeLabelValue(l.node),
+		escapeLabelValue(l.method),
+		escapeLabelValue(l.statusClass),
+	)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func writeHistogram(w io.Writer, name string, labels string, h *histogram) {
+	for i, b := range h.buckets {
+		_, _ = fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(b), h.counts[i])
+	}
+	_, _ = fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	_, _ = fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+	_, _ = fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+// WritePrometheus 以 Prometheus 文本格式输出所有指标，m 为 nil 时不输出
+func (m Metrics) WritePrometheus(w io.Writer) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	labelList := make([]metricLabels, 0, len(m.requests))
+	for l := range m.requests {
+		labelList = append(labelList, l)
+	}
+	sort.Slice(labelList, func(i, j int) bool {
+		return labelList[i].String() < labelList[j].String()
+	})
+	_, _ = fmt.Fprint(w, "# HELP http_requests_total Total number of HTTP requests.\n# TYPE http_requests_total counter\n")
+	for _, l := range labelList {
+		_, _ = fmt.Fprintf(w, "http_requests_total{%s} %d\n", l, m.requests[l].count)
+	}
+	_, _ = fmt.Fprint(w, "# HELP http_panics_total Total number of HTTP requests that ended in a panic.\n# TYPE http_panics_total counter\n")
+	for _, l := range labelList {
+		_, _ = fmt.Fprintf(w, "http_panics_total{%s} %d\n", l, m.requests[l].panics)
+	}
+	_, _ = fmt.Fprint(w, "# HELP http_request_duration_seconds HTTP request latency.\n# TYPE http_request_duration_seconds histogram\n")
+	for _, l := range labelList {
+		writeHistogram(w, "http_request_duration_seconds", l.String(), m.requests[l].duration)
+	}
+	_, _ = fmt.Fprint(w, "# HELP http_response_size_bytes HTTP response body size.\n# TYPE http_response_size_bytes histogram\n")
+	for _, l := range labelList {
+		writeHistogram(w, "http_response_size_bytes", l.String(), m.requests[l].size)
+	}
+	hosts := make([]string, 0, len(m.inFlight))
+	for host := range m.inFlight {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	_, _ = fmt.Fprint(w, "# HELP http_requests_in_flight Number of HTTP requests being served.\n# TYPE http_requests_in_flight gauge\n")
+	for _, host := range hosts {
+		_, _ = fmt.Fprintf(w, "http_requests_in_flight{host=\"%s\"} %d\n", escapeLabelValue(host), m.inFlight[host])
+	}
+	if m.FileCache != nil {
+		m.FileCache.WritePrometheus(w)
+	}
+}
+
+// ServeHTTP 输出所有指标，m 为 nil 时回复 404
+func (m Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch method.Parse(r.Method) {
+	case method.GET, method.HEAD:
+		w.Header().Set(header.ContentType, "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if method.Parse(r.Method) == method.GET {
+			m.WritePrometheus(w)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Service 返回一个只提供指标输出的管理服务，可以加入 Container.GetServices 的返回值中
+func (m Metrics) Service(network string, address string) Service {
+	return Service{
+		Network: network,
+		Address: address,
+		Handler: m,
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 模拟 net/http 为每个请求设置的本地地址
+func newLocalRequest(method string, target string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	local := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 80}
+	return r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, local))
+}
+
+func TestMetricsHostLabel(t *testing.T) {
+	tests := []struct {
+		name      string
+		hosts     []string
+		requested []string
+		want      string
+	}{
+		{"catch-all server", nil, []string{"a.example.com", "b.example.com", "random.invalid"}, `host=""`},
+		{"wildcard pattern", []string{"*.example.com"}, []string{"a.example.com", "B.example.com"}, `host="*.example.com"`},
+		{"plain host", []string{"WWW.example.com"}, []string{"www.example.com"}, `host="www.example.com"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMetrics()
+			s := NewServer(nil, nil, func(s Server) {
+				if tt.hosts != nil {
+					hosts := tt.hosts
+					s.GetHosts = func() []string { return hosts }
+				}
+				s.Guard = func(w http.ResponseWriter, _ *http.Request, _ *PathPack) bool {
+					w.WriteHeader(http.StatusNoContent)
+					return true
+				}
+				s.Metrics = m
+			})
+			for _, host := range tt.requested {
+				s.Handle(httptest.NewRecorder(), newLocalRequest("GET", "http://"+host+"/"))
+			}
+			var sb strings.Builder
+			m.WritePrometheus(&sb)
+			var series []string
+			for _, line := range strings.Split(sb.String(), "\n") {
+				if strings.HasPrefix(line, "http_requests_total{") {
+					series = append(series, line)
+				}
+			}
+			if len(series) != 1 || !strings.Contains(series[0], tt.want) {
+				t.Errorf("http_requests_total series = %q, want a single series with %s", series, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricsNil(t *testing.T) {
+	var m Metrics
+	for _, method := range []string{"GET", "HEAD", "POST"} {
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, httptest.NewRequest(method, "/metrics", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want %d", method, w.Code, http.StatusNotFound)
+		}
+	}
+	var sb strings.Builder
+	m.WritePrometheus(&sb)
+	if sb.Len() != 0 {
+		t.Errorf("WritePrometheus() = %q, want nothing", sb.String())
+	}
+}
+
+func metricsText(m Metrics) string {
+	var sb strings.Builder
+	m.WritePrometheus(&sb)
+	return sb.String()
+}
+
+// 统计 http_requests_total 各序列的总和
+func requestsTotal(m Metrics) int {
+	total := 0
+	for _, line := range strings.Split(metricsText(m), "\n") {
+		if strings.HasPrefix(line, "http_requests_total{") {
+			var n int
+			_, _ = fmt.Sscan(line[strings.LastIndex(line, " ")+1:], &n)
+			total += n
+		}
+	}
+	return total
+}
+
+func TestMetricsOnContainerAndServer(t *testing.T) {
+	tests := []struct {
+		name string
+		// 0 表示不设置，相同的数字表示同一个 Metrics
+		container int
+		server    int
+		// 各个 Metrics 统计到的请求数
+		want map[int]int
+		// 带有 Server 主机标签的进行中请求数序列所在的 Metrics
+		wantHostInFlight int
+	}{
+		{"container only", 1, 0, map[int]int{1: 1}, 0},
+		{"server only", 0, 1, map[int]int{1: 1}, 1},
+		{"same metrics counted once", 1, 1, map[int]int{1: 1}, 0},
+		{"different metrics", 1, 2, map[int]int{1: 1, 2: 1}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := map[int]Metrics{0: nil, 1: NewMetrics(), 2: NewMetrics()}
+			s := NewServer(nil, nil, func(s Server) {
+				s.GetHosts = func() []string { return []string{"example.com"} }
+				s.Guard = func(w http.ResponseWriter, _ *http.Request, _ *PathPack) bool {
+					w.WriteHeader(http.StatusNoContent)
+					return true
+				}
+				s.Metrics = metrics[tt.server]
+			})
+			c := NewContainer(nil, nil, nil, func(c Container) {
+				c.Metrics = metrics[tt.container]
+			})
+			c.serve(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				s.Handle(w, r)
+			})).ServeHTTP(httptest.NewRecorder(), newLocalRequest("GET", "http://example.com/"))
+			for i := 1; i <= 2; i++ {
+				if got := requestsTotal(metrics[i]); got != tt.want[i] {
+					t.Errorf("metrics %d counted %d requests, want %d", i, got, tt.want[i])
+				}
+				hasHost := strings.Contains(metricsText(metrics[i]), `http_requests_in_flight{host="example.com"} 0`)
+				if hasHost != (i == tt.wantHostInFlight) {
+					t.Errorf("metrics %d has in-flight series for the server host = %v, want %v", i, hasHost, !hasHost)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"github.com/TelephoneTan/GoHTTPServer/types"
+	"regexp"
+)
+
+// Param 描述参数节点
+//
+// 同一层级中，字面量节点（按 WordList 匹配）优先于单段参数节点，单段参数节点优先于通配节点；
+// 同类节点之间按 Use 的顺序匹配
+type Param struct {
+	Name string
+	// 单段参数的约束，为空表示任意值均可，会被自动加上首尾锚定
+	Pattern *regexp.Regexp
+	// 通配节点会捕获剩余的全部路径（以 '/' 连接），并且不会再匹配子节点
+	CatchAll bool
+}
+
+func (p *Param) match(token string) bool {
+	return p.Pattern == nil || p.Pattern.MatchString(token)
+}
+
+// 参数节点在 WordList.Join() 中的形式，例如 {id}、{path...}，用于日志和指标
+func (p *Param) wordList() types.WordList {
+	name := "{" + p.Name + "}"
+	if p.CatchAll {
+		name = "{" + p.Name + "...}"
+	}
+	return types.WordList{{name}}
+}
+
+type paramNode interface {
+	param() *Param
+}
+
+// NewParamResourceManager 创建单段参数节点，pattern 为空表示不限制参数值
+func NewParamResourceManager[PACK any](name string, pattern string, getRelativeRootDir func() string, init ...func(b ResourceManager[PACK])) ResourceManager[PACK] {
+	p := &Param{Name: name}
+	if pattern != "" {
+		p.Pattern = regexp.MustCompile(`^(?:` + pattern + `)$`)
+	}
+	return newParamResourceManager(p, getRelativeRootDir, init...)
+}
+
+// NewCatchAllResourceManager 创建通配节点，捕获剩余的全部路径
+func NewCatchAllResourceManager[PACK any](name string, getRelativeRootDir func() string, init ...func(b ResourceManager[PACK])) ResourceManager[PACK] {
+	return newParamResourceManager(&Param{Name: name, CatchAll: true}, getRelativeRootDir, init...)
+}
+
+func newParamResourceManager[PACK any](p *Param, getRelativeRootDir func() string, init ...func(b ResourceManager[PACK])) ResourceManager[PACK] {
+	return NewResourceManager[PACK](p.wordList, getRelativeRootDir, func(rm ResourceManager[PACK]) {
+		rm.Param = p
+		if len(init) > 0 {
+			init[0](rm)
+		}
+	})
+}
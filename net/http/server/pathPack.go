@@ -6,12 +6,38 @@ type PathPack struct {
 	Path       []string
 	PrefixPath []string
 	SuffixPath []string
+	// 参数节点捕获的值，参数名 -> 值
+	Params map[string]string `json:",omitempty"`
 }
 
 func (p *PathPack) Clone() PathPack {
+	var params map[string]string
+	if p.Params != nil {
+		params = make(map[string]string, len(p.Params))
+		for k, v := range p.Params {
+			params[k] = v
+		}
+	}
 	return PathPack{
 		Path:       util.ShallowCloneSlice(p.Path),
 		PrefixPath: util.ShallowCloneSlice(p.PrefixPath),
 		SuffixPath: util.ShallowCloneSlice(p.SuffixPath),
+		Params:     params,
+	}
+}
+
+// Param 获取参数节点捕获的值，没有该参数时返回空字符串
+func (p *PathPack) Param(name string) string {
+	return p.Params[name]
+}
+
+// 返回捕获了一个参数之后的 PathPack，路径切片与原 PathPack 共享底层数组
+func (p PathPack) withParam(name string, value string) PathPack {
+	params := make(map[string]string, len(p.Params)+1)
+	for k, v := range p.Params {
+		params[k] = v
 	}
+	params[name] = value
+	p.Params = params
+	return p
 }
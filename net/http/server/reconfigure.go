@@ -0,0 +1,80 @@
+package server
+
+import (
+	"github.com/TelephoneTan/GoHTTPServer/util"
+	"reflect"
+	"sync/atomic"
+)
+
+// 任意 Server 被 Reconfigure 时递增，Dispatcher 据此判断主机索引是否需要重建
+var serverGeneration atomic.Uint64
+
+// 当前生效的配置，Reconfigure 之前就是 Server 自身
+func (s Server) current() Server {
+	if active := s.active.Load(); active != nil {
+		return active
+	}
+	return s
+}
+
+// 复制 Server 的全部导出字段和子节点列表
+func copyServerConfig(dst Server, src Server) {
+	srcValue := reflect.ValueOf(src).Elem()
+	dstValue := reflect.ValueOf(dst).Elem()
+	for i := 0; i < srcValue.NumField(); i++ {
+		if srcValue.Type().Field(i).IsExported() {
+			dstValue.Field(i).Set(srcValue.Field(i))
+		}
+	}
+	dst.nodes = util.ShallowCloneSlice(src.nodes)
+}
+
+// 得到一份独立的配置
+func (s Server) cloneConfig() Server {
+	clone := &_Server{switches: s.switches}
+	copyServerConfig(clone, s)
+	return clone
+}
+
+// Reconfigure 原子地修改 Server 的配置
+//
+// update 在当前配置的副本上进行修改，修改完成后副本整体生效：新的请求使用新的配置，
+// 正在处理中的请求继续使用旧的配置直到结束
+//
+// 调用过 Reconfigure 之后，Server 自身的字段不再反映生效的配置，应当通过 Reconfigure 读取和修改
+func (s Server) Reconfigure(update func(Server)) Server {
+	s.reconfigureLock.Lock()
+	defer s.reconfigureLock.Unlock()
+	next := s.current().cloneConfig()
+	update(next)
+	next.router.Store(newChildRouter(next.nodes))
+	s.active.Store(next)
+	serverGeneration.Add(1)
+	return s
+}
+
+// SetNodes 原子地替换 Server 的全部子节点
+func (s Server) SetNodes(nodes ...ResourceManagerI) Server {
+	return s.Reconfigure(func(next Server) {
+		next.nodes = nodes
+	})
+}
+
+// SetHosts 原子地替换 Server 接受的主机名列表，nil 表示接受所有主机名
+func (s Server) SetHosts(hosts []string) Server {
+	return s.Reconfigure(func(next Server) {
+		if hosts == nil {
+			next.GetHosts = nil
+		} else {
+			next.GetHosts = func() []string { return hosts }
+		}
+	})
+}
+
+// Replace 原子地将 Server 的配置替换为 other 的配置，例如重新加载配置文件后使用
+func (s Server) Replace(other Server) Server {
+	source := other.current()
+	return s.Reconfigure(func(next Server) {
+		copyServerConfig(next, source)
+	})
+}
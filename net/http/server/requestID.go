@@ -0,0 +1,81 @@
+package server
+
+import (
+	"github.com/TelephoneTan/GoHTTPServer/util"
+	"github.com/TelephoneTan/GoLog/log"
+	"net/http"
+)
+
+const defaultRequestIDHeader = "X-Request-ID"
+
+// 请求 ID 只允许可打印的 ASCII 字符，并且不能过长，避免污染日志
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	return randomHex(16)
+}
+
+func (c Container) requestIDHeader() string {
+	if c.GetRequestIDHeader != nil {
+		if h := c.GetRequestIDHeader(); h != "" {
+			return h
+		}
+	}
+	return defaultRequestIDHeader
+}
+
+// 判断请求的对端是否可信，可信对端传入的请求 ID 会被沿用
+//
+// 可信代理（见 Container.GetTrustedProxies）同样视为可信对端
+func (c Container) trustRequestIDPeer(r *http.Request) bool {
+	peer := util.RemoteIP(r.RemoteAddr)
+	if c.trustedProxies().Contains(peer) {
+		return true
+	}
+	if c.GetRequestIDTrustedPeers == nil {
+		return false
+	}
+	peers := c.GetRequestIDTrustedPeers()
+	trusted := c.requestIDPeerSet.get(listKey(nil).strings(peers), func() util.IPRangeSet {
+		set, err := util.ParseIPRangeSet(peers...)
+		if err != nil {
+			log.E("请求 ID 可信对端配置有误：", err)
+		}
+		return set
+	})
+	return trusted.Contains(peer)
+}
+
+// 为请求分配 ID 并在回复中回显
+func (st *requestState) assignRequestID(w http.ResponseWriter, r *http.Request, headerKey string, trusted bool) {
+	if st.requestID != "" {
+		return
+	}
+	if trusted {
+		if id := r.Header.Get(headerKey); validRequestID(id) {
+			st.requestID = id
+		}
+	}
+	if st.requestID == "" {
+		st.requestID = newRequestID()
+	}
+	w.Header().Set(headerKey, st.requestID)
+}
+
+// RequestID 获取请求的 ID，请求没有经过 Container 或 Server 处理时返回空字符串
+func RequestID(r *http.Request) string {
+	if state := getRequestState(r); state != nil {
+		return state.requestID
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustRequestIDPeer(t *testing.T) {
+	tests := []struct {
+		name       string
+		peers      []string
+		proxies    []string
+		remoteAddr string
+		want       bool
+	}{
+		{"nothing configured", nil, nil, "10.0.0.1:1234", false},
+		{"peer CIDR", []string{"10.0.0.0/8"}, nil, "10.1.2.3:1234", true},
+		{"peer range", []string{"10.0.0.1-10.0.0.9"}, nil, "10.0.0.10:1234", false},
+		{"peer excluded", []string{"10.0.0.0/8", "!10.0.0.5"}, nil, "10.0.0.5:1234", false},
+		{"IPv6 peer", []string{"fd00::/8"}, nil, "[fd00::1]:1234", true},
+		{"trusted proxy", nil, []string{"192.168.0.0/16"}, "192.168.1.1:1234", true},
+		{"neither", []string{"10.0.0.0/8"}, []string{"192.168.0.0/16"}, "172.16.0.1:1234", false},
+		{"invalid peer list", []string{"not-an-ip"}, nil, "10.0.0.1:1234", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewContainer(nil, nil, nil, func(c Container) {
+				if tt.peers != nil {
+					peers := tt.peers
+					c.GetRequestIDTrustedPeers = func() []string { return peers }
+				}
+				if tt.proxies != nil {
+					proxies := tt.proxies
+					c.GetTrustedProxies = func() []string { return proxies }
+				}
+			})
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			// 第二次调用使用缓存的查找结构
+			for i := 0; i < 2; i++ {
+				if got := c.trustRequestIDPeer(r); got != tt.want {
+					t.Errorf("trustRequestIDPeer(%s) = %v, want %v", tt.remoteAddr, got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// requestState 保存单个请求在处理过程中产生的状态，存放在 r.Context() 中
+type requestState struct {
+	container Container
+	server    Server
+	// 当前正在处理的节点所看到的路径
+	paths *PathPack
+	// 最外层的回复追踪器，用于判断回复是否已经开始发送
+	response *responseTracker
+	start    time.Time
+	hostInfo *HostPack
+	// 处理该请求的 Server 所匹配的 GetHosts 中的项，用作指标的 host 标签
+	hostLabel string
+	// 处理该请求的节点链，每个节点为其 WordList.Join()
+	nodes   []string
+	errorID string
+	// 请求是否已被某个 Server 处理
+	handled bool
+	// 请求的追踪状态，没有配置 SpanExporter 时为空
+	tracer *tracer
+	// 请求 ID，见 RequestID
+	requestID string
+	// 经过可信代理还原的请求，见 Effective
+	effective *EffectiveRequest
+	// 服务开启了 gzip 时，gzip.Handler 外层的信息，见 keepAcceptEncoding
+	beforeGzip *beforeGzip
+}
+
+type requestStateKey struct{}
+
+func getRequestState(r *http.Request) *requestState {
+	state, _ := r.Context().Value(requestStateKey{}).(*requestState)
+	return state
+}
+
+// 确保请求带有 requestState，如果没有则创建一个并返回带有新 Context 的请求
+func ensureRequestState(r *http.Request) (*http.Request, *requestState) {
+	if state := getRequestState(r); state != nil {
+		return r, state
+	}
+	state := &requestState{start: time.Now()}
+	return r.WithContext(context.WithValue(r.Context(), requestStateKey{}, state)), state
+}
+
+func (st *requestState) setPaths(paths PathPack) {
+	if st == nil {
+		return
+	}
+	p := paths.Clone()
+	st.paths = &p
+}
+
+// 如果请求还没有回复追踪器，则包装 w 作为追踪器
+func (st *requestState) trackResponse(w http.ResponseWriter) http.ResponseWriter {
+	if st.response != nil {
+		return w
+	}
+	st.response = newResponseTracker(w)
+	return exposeOptional(st.response, w)
+}
+
+// 用于指标标签的主机名，即 Server 配置中被匹配的主机（可能是通配或正则形式），而不是请求的 Host 头部，
+// 以免任意的 Host 头部导致标签基数失控；请求未被任何 Server 处理或 Server 不限制主机时为空
+func (st *requestState) metricHost() string {
+	if !st.handled {
+		return ""
+	}
+	return st.hostLabel
+}
+
+// Server 使用的指标统计：与 Container 上的是同一个时返回 nil，以免同一个请求被统计两次
+func (st *requestState) serverMetrics(m Metrics) Metrics {
+	if st.container != nil && st.container.Metrics == m {
+		return nil
+	}
+	return m
+}
@@ -9,12 +9,14 @@ import (
 	"golang.org/x/net/idna"
 	"net/http"
 	"strings"
+	"sync/atomic"
 )
 
 type ResourceRequestHandler[PACK any] struct {
 	// 用于解析请求并决定是否要拦截请求
 	Peek func(r *http.Request, paths PathPack) (pack PACK, hijacked bool)
-	// 如果请求被拦截，此函数会被调用用于作出回复
+	// 如果请求被拦截，此函数会被调用用于作出回复；
+	// 调用 toCDN 会在需要时重定向到 CDN 并返回 true，按请求路径匹配到的缓存规则不允许公共缓存时总是返回 false
 	Reply func(w http.ResponseWriter, toCDN func() bool, pack PACK)
 	// 用于统计业务，此函数相比于 ResourceManager.Record 有如下差异：
 	//
@@ -26,6 +28,8 @@ type ResourceRequestHandler[PACK any] struct {
 	//
 	// 当请求使用的是非 OPTIONS 方法时，参数 hijacked 表示该请求是否会被拦截。
 	Monitor func(pack PACK, hijacked bool)
+	// 与 Monitor 相同，但额外提供请求，可以通过 RequestID(r) 获取请求 ID 用于关联访问日志
+	MonitorRequest func(r *http.Request, pack PACK, hijacked bool)
 }
 
 type ResourceManagerI interface {
@@ -34,16 +38,27 @@ type ResourceManagerI interface {
 }
 
 type _ResourceManager[PACK any] struct {
+	// 节点匹配的路径段，父节点构建子节点查找表时读取；返回值改变后需要对父节点调用一次 Use() 使查找表重建
 	GetWordList         func() types.WordList
 	GetRelativeRootDir  func() string
 	GetHomepageFileName func() string
+	// 路由名，用于根据路由名生成 URL，见 Server.URLPath
+	GetRouteName func() string
 	// 用于决定该请求是否需要自动重定向，以及如果需要的话，提供自动重定向的状态码和 Location
 	GetRedirect func(r *http.Request, paths PathPack) (redirect bool, statusCode int, location string)
-	// 用于记录请求，所有情况下均会被调用
-	Record           func(r *http.Request, paths PathPack)
-	Guide            map[method.Method]ResourceRequestHandler[PACK]
+	// 用于记录请求，所有情况下（包括被访问控制拒绝时）均会被调用，可以通过 RequestID(r) 获取请求 ID
+	Record func(r *http.Request, paths PathPack)
+	Guide  map[method.Method]ResourceRequestHandler[PACK]
+	// 允许跨域访问的源，例如 https://www.x.com；self 表示请求自身的源，即 Effective(r).Origin()
 	CORSAllowOrigins func() []string
-	nodes            []ResourceManagerI
+	// 按客户端 IP 的访问控制，对该节点及其所有子节点生效，每个请求都会重新读取
+	GetAccessControl func() AccessControl
+	// 不为空时该节点为参数节点，见 NewParamResourceManager 和 NewCatchAllResourceManager
+	Param *Param
+	nodes []ResourceManagerI
+	// 编译好的子节点查找表，首次路由时根据各节点的 WordList 构建，Use 之后重新构建
+	router        atomic.Pointer[childRouter]
+	accessControl matcherCache[compiledAccessControl]
 }
 
 type ResourceManager[PACK any] struct {
@@ -65,9 +80,19 @@ func NewResourceManager[PACK any](getWordList func() types.WordList, getRelative
 
 func (rm ResourceManager[PACK]) Use(child ...ResourceManagerI) ResourceManager[PACK] {
 	rm.nodes = append(rm.nodes, child...)
+	rm.router.Store(nil)
 	return rm
 }
 
+func (rm ResourceManager[PACK]) childRouter() *childRouter {
+	if router := rm.router.Load(); router != nil {
+		return router
+	}
+	router := newChildRouter(rm.nodes)
+	rm.router.Store(router)
+	return router
+}
+
 func (rm ResourceManager[PACK]) getRelativeRootDir() (relativeRootDir string) {
 	goto start
 end:
@@ -140,21 +165,32 @@ start:
 	}
 	var pack PACK
 	if handler.Peek != nil {
-		pack, hijacked = handler.Peek(r, paths.Clone())
+		pack, hijacked = func() (PACK, bool) {
+			span := startSpan(r, "peek", "node", rm.WordList().Join())
+			defer span.end()
+			return handler.Peek(r, paths.Clone())
+		}()
 	} else {
 		hijacked = true
 	}
 	hijacked = hijacked && handler.Reply != nil
 	if hijacked {
 		reply = func() {
-			handler.Reply(w, func() bool {
-				return s.toCDN(w, r)
+			span := startSpan(r, "reply", "node", rm.WordList().Join())
+			defer span.end()
+			handler.Reply(s.wrapCachePolicy(w, r), func() bool {
+				return s.replyToCDN(w, r)
 			}, pack)
 		}
 	}
-	if handler.Monitor != nil {
+	if handler.Monitor != nil || handler.MonitorRequest != nil {
 		monitor = func(hijacked bool) {
-			handler.Monitor(pack, hijacked)
+			if handler.Monitor != nil {
+				handler.Monitor(pack, hijacked)
+			}
+			if handler.MonitorRequest != nil {
+				handler.MonitorRequest(r, pack, hijacked)
+			}
 		}
 	}
 	goto end
@@ -256,6 +292,9 @@ start:
 			corsMethod := r.Header.Get("Access-Control-Request-Method")
 			corsHeaders := r.Header.Get("Access-Control-Request-Headers")
 			for _, allow := range corsOrigins {
+				if allow == "self" {
+					allow = Effective(r).Origin()
+				}
 				if !matchOrigin(allow, origin) {
 					continue
 				}
@@ -288,23 +327,37 @@ func (rm ResourceManager[PACK]) Handle(
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if state := getRequestState(r); state != nil {
+		state.setPaths(paths)
+		state.nodes = append(state.nodes, rm.WordList().Join())
+	}
+	if checkAccess(w, r, rm.GetAccessControl, &rm.accessControl) {
+		if rm.Record != nil {
+			rm.Record(r, paths.Clone())
+		}
+		return
+	}
 	hijacked := rm.handle(server, r, w, paths)
 	if hijacked {
 		return
 	}
 	filePath := rm.getRootDir(hostInfo, server, relativeRootDirList)
 	var noCDN bool
-	if len(paths.SuffixPath) == 1 {
+	if rm.Param != nil && rm.Param.CatchAll { // 通配节点消耗剩余的全部路径，不再匹配子节点
+		nodes := make([]string, 0, len(paths.SuffixPath)+1)
+		nodes = append(nodes, filePath)
+		nodes = append(nodes, paths.SuffixPath...)
+		filePath = util.JoinPath(nodes...)
+		noCDN = false
+	} else if len(paths.SuffixPath) == 1 {
 		filePath = util.JoinPath(filePath, rm.getHomepageFileName())
 		noCDN = true
 	} else {
 		paths.PrefixPath = paths.PrefixPath[:len(paths.PrefixPath)+1]
 		paths.SuffixPath = paths.SuffixPath[1:]
-		for _, manager := range rm.nodes {
-			if manager.WordList().Match(paths.SuffixPath[0]) {
-				manager.Handle(w, r, hostInfo, paths, server, append(relativeRootDirList, rm.getRelativeRootDir()))
-				return
-			}
+		if manager, paths := rm.childRouter().match(paths); manager != nil {
+			manager.Handle(w, r, hostInfo, paths, server, append(relativeRootDirList, rm.getRelativeRootDir()))
+			return
 		}
 		nodes := make([]string, 0, len(paths.SuffixPath)+1)
 		nodes = append(nodes, filePath)
@@ -315,6 +368,21 @@ func (rm ResourceManager[PACK]) Handle(
 	server.HandleFile(w, r, filePath, noCDN)
 }
 
+func (rm ResourceManager[PACK]) children() []ResourceManagerI {
+	return rm.nodes
+}
+
+func (rm ResourceManager[PACK]) routeName() string {
+	if rm.GetRouteName == nil {
+		return ""
+	}
+	return rm.GetRouteName()
+}
+
+func (rm ResourceManager[PACK]) param() *Param {
+	return rm.Param
+}
+
 func (rm ResourceManager[PACK]) WordList() *types.WordList {
 	wl := rm.GetWordList()
 	return &wl
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// responseTracker 包装 http.ResponseWriter，记录回复头部和回复体是否已经发出
+type responseTracker struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	written     int64
+	hijacked    bool
+}
+
+func newResponseTracker(w http.ResponseWriter) *responseTracker {
+	return &responseTracker{ResponseWriter: w}
+}
+
+func (t *responseTracker) WriteHeader(statusCode int) {
+	if !t.wroteHeader {
+		// 1xx 信息性回复不会提交最终的回复头部（101 除外）
+		if statusCode >= 200 || statusCode == http.StatusSwitchingProtocols {
+			t.statusCode = statusCode
+			t.wroteHeader = true
+		}
+	}
+	t.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (t *responseTracker) Write(bs []byte) (int, error) {
+	if !t.wroteHeader {
+		t.statusCode = http.StatusOK
+		t.wroteHeader = true
+	}
+	n, err := t.ResponseWriter.Write(bs)
+	t.written += int64(n)
+	return n, err
+}
+
+func (t *responseTracker) Flush() {
+	if !t.wroteHeader {
+		t.statusCode = http.StatusOK
+		t.wroteHeader = true
+	}
+	t.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (t *responseTracker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := t.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		t.hijacked = true
+	}
+	return conn, rw, err
+}
+
+func (t *responseTracker) Push(target string, opts *http.PushOptions) error {
+	return t.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// ReadFrom 保留底层的 io.ReaderFrom，http.ServeContent 发送文件时可以使用 sendfile
+func (t *responseTracker) ReadFrom(src io.Reader) (int64, error) {
+	if !t.wroteHeader {
+		t.statusCode = http.StatusOK
+		t.wroteHeader = true
+	}
+	n, err := t.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	t.written += n
+	return n, err
+}
+
+// Unwrap 供 http.ResponseController 使用
+func (t *responseTracker) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+// 之后的回复直接写入 w，用于绕过 t 与 w 之间的包装器；只能在回复开始发送之前调用
+func (t *responseTracker) bypassTo(w http.ResponseWriter) {
+	t.ResponseWriter = w
+}
+
+// 回复是否已经开始发送，开始之后就无法再改写状态码了
+func (t *responseTracker) started() bool {
+	return t.wroteHeader || t.hijacked
+}
+
+// 获取状态码，尚未写入时返回 0
+func (t *responseTracker) status() int {
+	return t.statusCode
+}
+
+// 包装器实现了全部可选接口，但只有被包装的 http.ResponseWriter 也实现时才可以对外暴露
+type responseWrapper interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	http.Pusher
+	io.ReaderFrom
+	Unwrap() http.ResponseWriter
+}
+
+type unwrapper interface {
+	Unwrap() http.ResponseWriter
+}
+
+// 返回只暴露 inner 所实现的 http.Flusher、http.Hijacker、http.Pusher 和 io.ReaderFrom 的 wrapper，
+// 以免调用方通过类型断言误以为底层支持这些功能
+func exposeOptional(wrapper responseWrapper, inner http.ResponseWriter) http.ResponseWriter {
+	_, f := inner.(http.Flusher)
+	_, h := inner.(http.Hijacker)
+	_, p := inner.(http.Pusher)
+	_, rf := inner.(io.ReaderFrom)
+	type w = http.ResponseWriter
+	type u = unwrapper
+	switch {
+	case f && h && p && rf:
+		return struct {
+			w
+			u
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{wrapper, wrapper, wrapper, wrapper, wrapper, wrapper}
+	case f && h && p:
+		return struct {
+			w
+			u
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{wrapper, wrapper, wrapper, wrapper, wrapper}
+	case f && h && rf:
+		return struct {
+			w
+			u
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{wrapper, wrapper, wrapper, wrapper, wrapper}
+	case f && p && rf:
+		return struct {
+			w
+			u
+			http.Flusher
+			http.Pusher
+			io.ReaderFrom
+		}{wrapper, wrapper, wrapper, wrapper, wrapper}
+	case h && p && rf:
+		return struct {
+			w
+			u
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{wrapper, wrapper, wrapper, wrapper, wrapper}
+	case f && h:
+		return struct {
+			w
+			u
+			http.Flusher
+			http.Hijacker
+		}{wrapper, wrapper, wrapper, wrapper}
+	case f && p:
+		return struct {
+			w
+			u
+			http.Flusher
+			http.Pusher
+		}{wrapper, wrapper, wrapper, wrapper}
+	case f && rf:
+		return struct {
+			w
+			u
+			http.Flusher
+			io.ReaderFrom
+		}{wrapper, wrapper, wrapper, wrapper}
+	case h && p:
+		return struct {
+			w
+			u
+			http.Hijacker
+			http.Pusher
+		}{wrapper, wrapper, wrapper, wrapper}
+	case h && rf:
+		return struct {
+			w
+			u
+			http.Hijacker
+			io.ReaderFrom
+		}{wrapper, wrapper, wrapper, wrapper}
+	case p && rf:
+		return struct {
+			w
+			u
+			http.Pusher
+			io.ReaderFrom
+		}{wrapper, wrapper, wrapper, wrapper}
+	case f:
+		return struct {
+			w
+			u
+			http.Flusher
+		}{wrapper, wrapper, wrapper}
+	case h:
+		return struct {
+			w
+			u
+			http.Hijacker
+		}{wrapper, wrapper, wrapper}
+	case p:
+		return struct {
+			w
+			u
+			http.Pusher
+		}{wrapper, wrapper, wrapper}
+	case rf:
+		return struct {
+			w
+			u
+			io.ReaderFrom
+		}{wrapper, wrapper, wrapper}
+	}
+	return struct {
+		w
+		u
+	}{wrapper, wrapper}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 只实现 http.ResponseWriter 的最小实现
+type plainResponseWriter struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func (w *plainResponseWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = http.Header{}
+	}
+	return w.header
+}
+
+func (w *plainResponseWriter) Write(bs []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(bs)
+}
+
+func (w *plainResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+// 额外实现 io.ReaderFrom
+type readerFromResponseWriter struct {
+	plainResponseWriter
+	readFrom bool
+}
+
+func (w *readerFromResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.readFrom = true
+	return w.body.ReadFrom(src)
+}
+
+func TestExposeOptional(t *testing.T) {
+	tests := []struct {
+		name                                    string
+		inner                                   http.ResponseWriter
+		flusher, hijacker, pusher, readerFromOK bool
+	}{
+		{"plain", &plainResponseWriter{}, false, false, false, false},
+		{"recorder", httptest.NewRecorder(), true, false, false, false},
+		{"readerFrom", &readerFromResponseWriter{}, false, false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := exposeOptional(newResponseTracker(tt.inner), tt.inner)
+			if _, ok := w.(http.Flusher); ok != tt.flusher {
+				t.Errorf("http.Flusher = %v, want %v", ok, tt.flusher)
+			}
+			if _, ok := w.(http.Hijacker); ok != tt.hijacker {
+				t.Errorf("http.Hijacker = %v, want %v", ok, tt.hijacker)
+			}
+			if _, ok := w.(http.Pusher); ok != tt.pusher {
+				t.Errorf("http.Pusher = %v, want %v", ok, tt.pusher)
+			}
+			if _, ok := w.(io.ReaderFrom); ok != tt.readerFromOK {
+				t.Errorf("io.ReaderFrom = %v, want %v", ok, tt.readerFromOK)
+			}
+			if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok || u.Unwrap() != tt.inner {
+				t.Errorf("Unwrap does not return the inner writer")
+			}
+		})
+	}
+}
+
+func TestResponseTrackerReadFrom(t *testing.T) {
+	inner := &readerFromResponseWriter{}
+	tracker := newResponseTracker(inner)
+	w := exposeOptional(tracker, inner)
+	// 去掉 strings.Reader 的 io.WriterTo，使 io.Copy 使用 io.ReaderFrom
+	n, err := io.Copy(w, struct{ io.Reader }{strings.NewReader("hello")})
+	if err != nil || n != 5 {
+		t.Fatalf("io.Copy = %d, %v", n, err)
+	}
+	if !inner.readFrom {
+		t.Error("io.Copy did not use the inner io.ReaderFrom")
+	}
+	if !tracker.started() || tracker.status() != http.StatusOK || tracker.written != 5 {
+		t.Errorf("tracker = started %v, status %d, written %d", tracker.started(), tracker.status(), tracker.written)
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"fmt"
+	"golang.org/x/net/idna"
+	"net/url"
+	"strings"
+)
+
+// treeNode 是可以被遍历的节点，ResourceManager 实现了此接口
+type treeNode interface {
+	children() []ResourceManagerI
+	routeName() string
+}
+
+// 查找路由名为 name 的节点，返回从 Server 的子节点到该节点的节点链
+func findRoute(nodes []ResourceManagerI, name string) []ResourceManagerI {
+	for _, node := range nodes {
+		tn, ok := node.(treeNode)
+		if !ok {
+			continue
+		}
+		if name != "" && tn.routeName() == name {
+			return []ResourceManagerI{node}
+		}
+		if chain := findRoute(tn.children(), name); chain != nil {
+			return append([]ResourceManagerI{node}, chain...)
+		}
+	}
+	return nil
+}
+
+// 节点在 URL 中的规范形式：优先使用 WordList.Join()，没有纯 ASCII 的别名时使用第一组单词
+func canonicalToken(node ResourceManagerI) string {
+	wl := node.WordList()
+	if token := wl.Join(); token != "" {
+		return url.PathEscape(token)
+	}
+	for _, words := range *wl {
+		if len(words) > 0 {
+			return url.PathEscape(strings.Join(words, "."))
+		}
+	}
+	return ""
+}
+
+// URLPath 根据路由名和参数生成路径，例如 /users/12/orders
+//
+// 参数节点的值从 params 中获取并校验，没有被路径使用的参数会作为查询参数附加在路径之后
+func (s Server) URLPath(name string, params map[string]string) (string, error) {
+	chain := findRoute(s.current().nodes, name)
+	if chain == nil {
+		return "", fmt.Errorf("route %q not found", name)
+	}
+	used := map[string]bool{}
+	segments := make([]string, 0, len(chain))
+	for _, node := range chain {
+		pn, ok := node.(paramNode)
+		if !ok || pn.param() == nil {
+			segments = append(segments, canonicalToken(node))
+			continue
+		}
+		p := pn.param()
+		value, has := params[p.Name]
+		if !has || value == "" {
+			return "", fmt.Errorf("route %q: missing parameter %q", name, p.Name)
+		}
+		used[p.Name] = true
+		if p.CatchAll {
+			parts := strings.Split(strings.Trim(value, "/"), "/")
+			for i, part := range parts {
+				parts[i] = url.PathEscape(part)
+			}
+			segments = append(segments, strings.Join(parts, "/"))
+			break // 通配节点之后不会再有子节点
+		}
+		if strings.Contains(value, "/") || !p.match(value) {
+			return "", fmt.Errorf("route %q: invalid value %q for parameter %q", name, value, p.Name)
+		}
+		segments = append(segments, url.PathEscape(value))
+	}
+	path := "/" + strings.Join(segments, "/")
+	query := url.Values{}
+	for k, v := range params {
+		if !used[k] {
+			query.Set(k, v)
+		}
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path, nil
+}
+
+// 第一个普通主机名，主机名模式（见 isHostPattern）不能用于生成 URL
+func (s Server) primaryHost() string {
+	//goland:noinspection GoAssignmentToReceiver
+	s = s.current()
+	if s.GetHosts == nil {
+		return ""
+	}
+	for _, host := range s.GetHosts() {
+		if host == "" || isHostPattern(host) {
+			continue
+		}
+		return host
+	}
+	return ""
+}
+
+// URL 根据路由名和参数生成绝对 URL
+//
+// scheme 为空时使用 https，host 为空时使用 GetHosts 中的第一个主机
+func (s Server) URL(name string, params map[string]string, scheme string, host string) (string, error) {
+	path, err := s.URLPath(name, params)
+	if err != nil {
+		return "", err
+	}
+	if scheme == "" {
+		scheme = "https"
+	}
+	if host == "" {
+		host = s.primaryHost()
+	}
+	if host == "" {
+		return "", fmt.Errorf("route %q: no host for absolute URL", name)
+	}
+	host, err = idna.ToASCII(host)
+	if err != nil {
+		return "", err
+	}
+	return scheme + "://" + host + path, nil
+}
+
+// CDNURL 根据路由名和参数生成指向 GetCDNHost 的 URL
+//
+// scheme 为空时生成与 CDN 重定向相同的协议相对 URL，即 //cdnHost/path；设置了 GetCDNSignOptions 时 URL 带有签名
+func (s Server) CDNURL(name string, params map[string]string, scheme string) (string, error) {
+	//goland:noinspection GoAssignmentToReceiver
+	s = s.current()
+	var cdnHost string
+	if getCDNHost := s.GetCDNHost; getCDNHost != nil {
+		cdnHost = getCDNHost()
+	}
+	if cdnHost == "" {
+		return "", fmt.Errorf("route %q: no CDN host", name)
+	}
+	path, err := s.URLPath(name, params)
+	if err != nil {
+		return "", err
+	}
+	cdnHost, err = idna.ToASCII(cdnHost)
+	if err != nil {
+		return "", err
+	}
+	prefix := "//"
+	if scheme != "" {
+		prefix = scheme + "://"
+	}
+	return prefix + cdnHost + s.signCDNURI(path), nil
+}
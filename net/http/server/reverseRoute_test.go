@@ -0,0 +1,179 @@
+package server
+
+import (
+	"github.com/TelephoneTan/GoHTTPServer/types"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func routeNamed(name string) func(ResourceManager[any]) {
+	return func(rm ResourceManager[any]) {
+		rm.GetRouteName = func() string { return name }
+	}
+}
+
+func wordNode(words types.WordList, name string) ResourceManager[any] {
+	return NewResourceManager[any](func() types.WordList { return words }, nil, routeNamed(name))
+}
+
+// 测试用的路由树：
+//
+//	/users                    users
+//	/users/{id:[0-9]+}        user
+//	/users/{id}/orders        orders
+//	/static.files/{rest...}   file
+//	/文件（别名 docs）/{name}  doc
+//	/文件                      chinese-only
+func newReverseRouteServer(init ...func(Server)) Server {
+	return NewServer(nil, nil, init...).Use(
+		wordNode(types.WordList{{"users"}}, "users").Use(
+			NewParamResourceManager[any]("id", "[0-9]+", nil, routeNamed("user")).Use(
+				wordNode(types.WordList{{"orders"}}, "orders"),
+			),
+		),
+		wordNode(types.WordList{{"static", "files"}}, "").Use(
+			NewCatchAllResourceManager[any]("rest", nil, routeNamed("file")),
+		),
+		wordNode(types.WordList{{"文件"}, {"docs"}}, "").Use(
+			NewParamResourceManager[any]("name", "", nil, routeNamed("doc")),
+		),
+		wordNode(types.WordList{{"文件"}}, "chinese-only"),
+	)
+}
+
+func TestURLPath(t *testing.T) {
+	s := newReverseRouteServer()
+	tests := []struct {
+		name    string
+		route   string
+		params  map[string]string
+		want    string
+		wantErr string
+	}{
+		{"literal", "users", nil, "/users", ""},
+		{"param", "user", map[string]string{"id": "12"}, "/users/12", ""},
+		{"nested", "orders", map[string]string{"id": "12"}, "/users/12/orders", ""},
+		{"extra params become query", "orders", map[string]string{"id": "12", "page": "2", "q": "a b&c"}, "/users/12/orders?page=2&q=a+b%26c", ""},
+		{"joined words", "file", map[string]string{"rest": "a/b.js"}, "/static.files/a/b.js", ""},
+		{"catch-all escaping", "file", map[string]string{"rest": "/dir name/a?b#c.js/"}, "/static.files/dir%20name/a%3Fb%23c.js", ""},
+		{"ascii alias preferred", "doc", map[string]string{"name": "说明 1"}, "/docs/%E8%AF%B4%E6%98%8E%201", ""},
+		{"non-ascii token escaped", "chinese-only", nil, "/%E6%96%87%E4%BB%B6", ""},
+		{"unknown route", "nothing", nil, "", `route "nothing" not found`},
+		{"missing param", "user", nil, "", `missing parameter "id"`},
+		{"empty param", "user", map[string]string{"id": ""}, "", `missing parameter "id"`},
+		{"param pattern mismatch", "user", map[string]string{"id": "abc"}, "", `invalid value "abc"`},
+		{"param with slash", "doc", map[string]string{"name": "a/b"}, "", `invalid value "a/b"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.URLPath(tt.route, tt.params)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("URLPath() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("URLPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		hosts   []string
+		scheme  string
+		host    string
+		want    string
+		wantErr bool
+	}{
+		{"first plain host", []string{"*.example.com", "www.example.com", "example.com"}, "", "", "https://www.example.com/users/7", false},
+		{"explicit scheme and host", []string{"www.example.com"}, "http", "other.example:8080", "http://other.example:8080/users/7", false},
+		{"internationalized host", []string{"例子.测试"}, "", "", "https://xn--fsqu00a.xn--0zwm56d/users/7", false},
+		{"only patterns", []string{"*.example.com"}, "", "", "", true},
+		{"no hosts", nil, "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newReverseRouteServer(func(s Server) {
+				if tt.hosts != nil {
+					hosts := tt.hosts
+					s.GetHosts = func() []string { return hosts }
+				}
+			})
+			got, err := s.URL("user", map[string]string{"id": "7"}, tt.scheme, tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("URL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("URL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCDNURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		cdnHost string
+		sign    CDNSignOptions
+		scheme  string
+		// 未签名时的完整 URL；签名时为签名前的路径
+		want    string
+		wantErr bool
+	}{
+		{"protocol relative", "cdn.example.com", CDNSignOptions{}, "", "//cdn.example.com/static.files/a%20b.js?v=1", false},
+		{"explicit scheme", "cdn.example.com", CDNSignOptions{}, "https", "https://cdn.example.com/static.files/a%20b.js?v=1", false},
+		{"signed A", "cdn.example.com", CDNSignOptions{Keys: []string{"k"}}, "", "/static.files/a%20b.js", false},
+		{"signed B", "cdn.example.com", CDNSignOptions{Keys: []string{"k"}, Type: CDNSignTypeB}, "", "/static.files/a%20b.js", false},
+		{"signed C", "cdn.example.com", CDNSignOptions{Keys: []string{"k"}, Type: CDNSignTypeC}, "", "/static.files/a%20b.js", false},
+		{"no CDN host", "", CDNSignOptions{}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newReverseRouteServer(func(s Server) {
+				s.GetCDNHost = func() string { return tt.cdnHost }
+				s.GetCDNSignOptions = func() CDNSignOptions { return tt.sign }
+			})
+			got, err := s.CDNURL("file", map[string]string{"rest": "a b.js", "v": "1"}, tt.scheme)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CDNURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !tt.sign.enabled() {
+				if got != tt.want {
+					t.Errorf("CDNURL() = %q, want %q", got, tt.want)
+				}
+				return
+			}
+			u, err := url.Parse("https:" + got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Host != tt.cdnHost {
+				t.Errorf("CDNURL() host = %q, want %q", u.Host, tt.cdnHost)
+			}
+			r := httptest.NewRequest("GET", u.RequestURI(), nil)
+			path, ok := tt.sign.verify(r, time.Now())
+			if !ok {
+				t.Fatalf("CDNURL() = %q does not verify", got)
+			}
+			if want, _ := url.PathUnescape(tt.want); path != want {
+				t.Errorf("verified path = %q, want %q", path, want)
+			}
+			if r.URL.Query().Get("v") != "1" {
+				t.Errorf("CDNURL() = %q lost the query parameter", got)
+			}
+		})
+	}
+}
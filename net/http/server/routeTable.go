@@ -0,0 +1,298 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/TelephoneTan/GoHTTPServer/net/http/header"
+	"github.com/TelephoneTan/GoHTTPServer/net/http/method"
+	"github.com/TelephoneTan/GoHTTPServer/net/mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RouteNode 描述路由树中的一个节点
+type RouteNode struct {
+	// WordList.Join() 的结果，参数节点为 {name} 或 {name...}
+	Token string `json:"token"`
+	// WordList 中的所有别名
+	Aliases         [][]string  `json:"aliases"`
+	Param           string      `json:"param,omitempty"`
+	ParamPattern    string      `json:"paramPattern,omitempty"`
+	CatchAll        bool        `json:"catchAll,omitempty"`
+	RouteName       string      `json:"routeName,omitempty"`
+	RelativeRootDir string      `json:"relativeRootDir,omitempty"`
+	Homepage        string      `json:"homepage,omitempty"`
+	Methods         []string    `json:"methods,omitempty"`
+	CORSOrigins     []string    `json:"corsOrigins,omitempty"`
+	HasRedirect     bool        `json:"hasRedirect"`
+	AccessControl   bool        `json:"accessControl,omitempty"`
+	FileServer      bool        `json:"fileServer"`
+	Children        []RouteNode `json:"children,omitempty"`
+}
+
+// RouteTable 描述一个 Server 及其全部节点
+type RouteTable struct {
+	Hosts          []string    `json:"hosts,omitempty"`
+	HostPorts      []uint16    `json:"hostPorts,omitempty"`
+	IPs            []string    `json:"ips,omitempty"`
+	IPPorts        []uint16    `json:"ipPorts,omitempty"`
+	HostPortRanges []string    `json:"hostPortRanges,omitempty"`
+	IPRanges       []string    `json:"ipRanges,omitempty"`
+	IPPortRanges   []string    `json:"ipPortRanges,omitempty"`
+	CDNHost        string      `json:"cdnHost,omitempty"`
+	CDNSignType    string      `json:"cdnSignType,omitempty"`
+	CacheRules     int         `json:"cacheRules,omitempty"`
+	HasGuard       bool        `json:"hasGuard"`
+	AccessControl  bool        `json:"accessControl,omitempty"`
+	RootFileServer bool        `json:"rootFileServer"`
+	FileCache      bool        `json:"fileCache,omitempty"`
+	Precompressed  bool        `json:"precompressed,omitempty"`
+	Nodes          []RouteNode `json:"nodes,omitempty"`
+}
+
+// 可以描述自身的节点，ResourceManager 实现了此接口
+type describableNode interface {
+	describe() RouteNode
+}
+
+func describeNodes(nodes []ResourceManagerI) []RouteNode {
+	result := make([]RouteNode, 0, len(nodes))
+	for _, node := range nodes {
+		if dn, ok := node.(describableNode); ok {
+			result = append(result, dn.describe())
+			continue
+		}
+		// 其他 ResourceManagerI 实现只能得到 WordList
+		wl := node.WordList()
+		result = append(result, RouteNode{Token: wl.Join(), Aliases: *wl})
+	}
+	return result
+}
+
+func (rm ResourceManager[PACK]) describe() RouteNode {
+	wl := rm.WordList()
+	node := RouteNode{
+		Token:           wl.Join(),
+		Aliases:         *wl,
+		RouteName:       rm.routeName(),
+		RelativeRootDir: rm.getRelativeRootDir(),
+		Homepage:        rm.getHomepageFileName(),
+		HasRedirect:     rm.GetRedirect != nil,
+		AccessControl:   rm.GetAccessControl != nil,
+		// 没有被拦截的请求总会交给文件服务器
+		FileServer: true,
+		Children:   describeNodes(rm.nodes),
+	}
+	if rm.Param != nil {
+		node.Param = rm.Param.Name
+		node.CatchAll = rm.Param.CatchAll
+		if rm.Param.Pattern != nil {
+			node.ParamPattern = rm.Param.Pattern.String()
+		}
+	}
+	for m, h := range rm.Guide {
+		if h.Reply == nil { // 没有 Reply 的方法不会拦截请求
+			continue
+		}
+		node.Methods = append(node.Methods, m.String())
+	}
+	sort.Strings(node.Methods)
+	if rm.CORSAllowOrigins != nil {
+		node.CORSOrigins = rm.CORSAllowOrigins()
+	}
+	return node
+}
+
+// Routes 遍历 Server 及其全部节点，得到路由表
+func (s Server) Routes() RouteTable {
+	//goland:noinspection GoAssignmentToReceiver
+	s = s.current()
+	table := RouteTable{
+		HasGuard:       s.Guard != nil,
+		AccessControl:  s.GetAccessControl != nil,
+		RootFileServer: s.HasRootFileServer != nil && s.HasRootFileServer(),
+		FileCache:      s.FileCache != nil,
+		Precompressed:  s.HasPrecompressedFiles != nil && s.HasPrecompressedFiles(),
+		Nodes:          describeNodes(s.nodes),
+	}
+	if s.GetHosts != nil {
+		table.Hosts = s.GetHosts()
+	}
+	if s.GetHostPorts != nil {
+		table.HostPorts = s.GetHostPorts()
+	}
+	if s.GetIPs != nil {
+		for _, ip := range s.GetIPs() {
+			table.IPs = append(table.IPs, ip.String())
+		}
+	}
+	if s.GetIPPorts != nil {
+		table.IPPorts = s.GetIPPorts()
+	}
+	if s.GetHostPortRanges != nil {
+		table.HostPortRanges = s.GetHostPortRanges()
+	}
+	if s.GetIPRanges != nil {
+		table.IPRanges = s.GetIPRanges()
+	}
+	if s.GetIPPortRanges != nil {
+		table.IPPortRanges = s.GetIPPortRanges()
+	}
+	if s.GetCDNHost != nil {
+		table.CDNHost = s.GetCDNHost()
+	}
+	if s.GetCacheRules != nil {
+		table.CacheRules = len(s.GetCacheRules())
+	}
+	if options := s.cdnSignOptions(); options.enabled() {
+		table.CDNSignType = options.Type.String()
+	}
+	return table
+}
+
+func formatAliases(aliases [][]string) string {
+	list := make([]string, 0, len(aliases))
+	for _, words := range aliases {
+		list = append(list, strings.Join(words, "."))
+	}
+	return strings.Join(list, " | ")
+}
+
+func (n RouteNode) writeText(sb *strings.Builder, indent string) {
+	sb.WriteString(indent + "/" + n.Token)
+	if n.Param == "" && len(n.Aliases) > 1 {
+		sb.WriteString(" (" + formatAliases(n.Aliases) + ")")
+	}
+	if n.ParamPattern != "" {
+		sb.WriteString(" pattern=" + n.ParamPattern)
+	}
+	if n.RouteName != "" {
+		sb.WriteString(" name=" + n.RouteName)
+	}
+	if len(n.Methods) > 0 {
+		sb.WriteString(" methods=" + strings.Join(n.Methods, ","))
+	}
+	if n.RelativeRootDir != "" {
+		sb.WriteString(" root=" + n.RelativeRootDir)
+	}
+	if n.Homepage != "" {
+		sb.WriteString(" homepage=" + n.Homepage)
+	}
+	if len(n.CORSOrigins) > 0 {
+		sb.WriteString(" cors=" + strings.Join(n.CORSOrigins, ","))
+	}
+	if n.HasRedirect {
+		sb.WriteString(" redirect")
+	}
+	if n.AccessControl {
+		sb.WriteString(" acl")
+	}
+	if n.FileServer {
+		sb.WriteString(" file")
+	}
+	sb.WriteString("\n")
+	for _, child := range n.Children {
+		child.writeText(sb, indent+"  ")
+	}
+}
+
+// Text 以缩进的树形文本输出路由表
+func (t RouteTable) Text() string {
+	var sb strings.Builder
+	sb.WriteString("server")
+	if len(t.Hosts) > 0 {
+		sb.WriteString(" hosts=" + strings.Join(t.Hosts, ","))
+	}
+	if len(t.HostPorts) > 0 {
+		sb.WriteString(fmt.Sprintf(" hostPorts=%v", t.HostPorts))
+	}
+	if len(t.IPs) > 0 {
+		sb.WriteString(" ips=" + strings.Join(t.IPs, ","))
+	}
+	if len(t.IPPorts) > 0 {
+		sb.WriteString(fmt.Sprintf(" ipPorts=%v", t.IPPorts))
+	}
+	if len(t.HostPortRanges) > 0 {
+		sb.WriteString(" hostPortRanges=" + strings.Join(t.HostPortRanges, ","))
+	}
+	if len(t.IPRanges) > 0 {
+		sb.WriteString(" ipRanges=" + strings.Join(t.IPRanges, ","))
+	}
+	if len(t.IPPortRanges) > 0 {
+		sb.WriteString(" ipPortRanges=" + strings.Join(t.IPPortRanges, ","))
+	}
+	if t.CDNHost != "" {
+		sb.WriteString(" cdn=" + t.CDNHost)
+	}
+	if t.CDNSignType != "" {
+		sb.WriteString(" cdnSign=" + t.CDNSignType)
+	}
+	if t.CacheRules > 0 {
+		sb.WriteString(" cacheRules=" + strconv.Itoa(t.CacheRules))
+	}
+	if t.HasGuard {
+		sb.WriteString(" guard")
+	}
+	if t.AccessControl {
+		sb.WriteString(" acl")
+	}
+	if t.RootFileServer {
+		sb.WriteString(" file")
+	}
+	if t.FileCache {
+		sb.WriteString(" fileCache")
+	}
+	if t.Precompressed {
+		sb.WriteString(" precompressed")
+	}
+	sb.WriteString("\n")
+	for _, node := range t.Nodes {
+		node.writeText(&sb, "  ")
+	}
+	return sb.String()
+}
+
+func (t RouteTable) JSON() ([]byte, error) {
+	return json.MarshalIndent(t, "", "  ")
+}
+
+// RouteTableHandler 输出各 Server 的路由表，默认为文本格式，请求带有 ?format=json 时输出 JSON
+func RouteTableHandler(servers ...Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m := method.Parse(r.Method); m != method.GET && m != method.HEAD {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		tables := make([]RouteTable, 0, len(servers))
+		for _, s := range servers {
+			tables = append(tables, s.Routes())
+		}
+		if r.URL.Query().Get("format") == "json" {
+			bs, err := json.MarshalIndent(tables, "", "  ")
+			if err != nil {
+				panic(err)
+			}
+			w.Header().Set(header.ContentType, mime.JSON)
+			_, _ = w.Write(bs)
+			return
+		}
+		w.Header().Set(header.ContentType, mime.TextPlainUTF8)
+		for i, t := range tables {
+			if i > 0 {
+				_, _ = w.Write([]byte("\n"))
+			}
+			_, _ = w.Write([]byte(t.Text()))
+		}
+	})
+}
+
+// RouteTableService 返回一个只提供路由表的管理服务，可以加入 Container.GetServices 的返回值中
+func RouteTableService(network string, address string, servers ...Server) Service {
+	return Service{
+		Network: network,
+		Address: address,
+		Handler: RouteTableHandler(servers...),
+	}
+}
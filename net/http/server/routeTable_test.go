@@ -0,0 +1,146 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/TelephoneTan/GoHTTPServer/net/http/method"
+	"github.com/TelephoneTan/GoHTTPServer/types"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newRouteTableServer() Server {
+	reply := func(w http.ResponseWriter, _ func() bool, _ any) {}
+	return NewServer(nil, nil, func(s Server) {
+		s.GetHosts = func() []string { return []string{"example.com", "*.example.com"} }
+		s.GetIPs = func() []net.IP { return []net.IP{net.ParseIP("127.0.0.1")} }
+		s.GetHostPorts = func() []uint16 { return []uint16{80, 443} }
+		s.GetCDNHost = func() string { return "cdn.example.com" }
+		s.GetCDNSignOptions = func() CDNSignOptions { return CDNSignOptions{Keys: []string{"k"}, Type: CDNSignTypeC} }
+		s.Guard = func(http.ResponseWriter, *http.Request, *PathPack) bool { return false }
+	}).Use(
+		NewResourceManager[any](func() types.WordList { return types.WordList{{"api"}, {"接口"}} }, func() string { return "api" }, func(rm ResourceManager[any]) {
+			rm.GetRouteName = func() string { return "api" }
+			rm.Guide = map[method.Method]ResourceRequestHandler[any]{
+				method.POST: {Reply: reply},
+				method.GET:  {Reply: reply},
+				// 没有 Reply 的方法不会拦截请求，不出现在路由表中
+				method.DELETE: {Monitor: func(any, bool) {}},
+			}
+			rm.CORSAllowOrigins = func() []string { return []string{"self", "https://a.example.com"} }
+			rm.GetAccessControl = func() AccessControl { return AccessControl{} }
+		}).Use(
+			NewParamResourceManager[any]("id", "[0-9]+", nil, routeNamed("item")).Use(
+				NewCatchAllResourceManager[any]("rest", nil),
+			),
+		),
+		NewResourceManager[any](func() types.WordList { return types.WordList{{"old"}} }, nil, func(rm ResourceManager[any]) {
+			rm.GetHomepageFileName = func() string { return "index.htm" }
+			rm.GetRedirect = func(*http.Request, PathPack) (bool, int, string) { return false, 0, "" }
+		}),
+	)
+}
+
+const routeTableText = `server hosts=example.com,*.example.com hostPorts=[80 443] ips=127.0.0.1 cdn=cdn.example.com cdnSign=C guard
+  /api (api | 接口) name=api methods=GET,POST root=api cors=self,https://a.example.com acl file
+    /{id} pattern=^(?:[0-9]+)$ name=item file
+      /{rest...} file
+  /old homepage=index.htm redirect file
+`
+
+func TestRoutes(t *testing.T) {
+	table := newRouteTableServer().Routes()
+	if got := strings.Join(table.Hosts, ","); got != "example.com,*.example.com" {
+		t.Errorf("Hosts = %q", got)
+	}
+	if got := strings.Join(table.IPs, ","); got != "127.0.0.1" {
+		t.Errorf("IPs = %q", got)
+	}
+	if table.CDNHost != "cdn.example.com" || table.CDNSignType != "C" || !table.HasGuard || table.RootFileServer {
+		t.Errorf("table = %+v", table)
+	}
+	if len(table.Nodes) != 2 {
+		t.Fatalf("len(Nodes) = %d, want 2", len(table.Nodes))
+	}
+	api := table.Nodes[0]
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"api token", api.Token, "api"},
+		{"api aliases", formatAliases(api.Aliases), "api | 接口"},
+		{"api methods", strings.Join(api.Methods, ","), "GET,POST"},
+		{"api route name", api.RouteName, "api"},
+		{"api root", api.RelativeRootDir, "api"},
+		{"api cors", strings.Join(api.CORSOrigins, ","), "self,https://a.example.com"},
+		{"api access control", api.AccessControl, true},
+		{"param name", api.Children[0].Param, "id"},
+		{"param token", api.Children[0].Token, "{id}"},
+		{"param route name", api.Children[0].RouteName, "item"},
+		{"catch-all", api.Children[0].Children[0].CatchAll, true},
+		{"catch-all token", api.Children[0].Children[0].Token, "{rest...}"},
+		{"homepage", table.Nodes[1].Homepage, "index.htm"},
+		{"redirect", table.Nodes[1].HasRedirect, true},
+		{"no methods", len(table.Nodes[1].Methods), 0},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestRouteTableText(t *testing.T) {
+	if got := newRouteTableServer().Routes().Text(); got != routeTableText {
+		t.Errorf("Text() =\n%s\nwant\n%s", got, routeTableText)
+	}
+	if got := NewServer(nil, nil).Routes().Text(); got != "server\n" {
+		t.Errorf("empty server Text() = %q, want %q", got, "server\n")
+	}
+}
+
+func TestRouteTableHandler(t *testing.T) {
+	handler := RouteTableHandler(newRouteTableServer(), NewServer(nil, nil))
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"text", "GET", "/", http.StatusOK, "text/plain; charset=UTF-8", routeTableText + "\nserver\n"},
+		{"head", "HEAD", "/", http.StatusOK, "text/plain; charset=UTF-8", ""},
+		{"json", "GET", "/?format=json", http.StatusOK, "application/json", ""},
+		{"wrong method", "POST", "/", http.StatusMethodNotAllowed, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("body =\n%s\nwant\n%s", w.Body.String(), tt.body)
+			}
+			if tt.contentType != "application/json" {
+				return
+			}
+			var tables []RouteTable
+			if err := json.Unmarshal(w.Body.Bytes(), &tables); err != nil {
+				t.Fatal(err)
+			}
+			if len(tables) != 2 || tables[0].CDNHost != "cdn.example.com" || len(tables[0].Nodes) != 2 ||
+				strings.Join(tables[0].Nodes[0].Methods, ",") != "GET,POST" || len(tables[1].Nodes) != 0 {
+				t.Errorf("tables = %+v", tables)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"github.com/TelephoneTan/GoHTTPServer/types"
+	"regexp"
+	"strings"
+)
+
+type routeEntry struct {
+	// 在 Use 中的顺序，多个节点都匹配时顺序靠前的优先
+	index   int
+	node    ResourceManagerI
+	matcher *regexp.Regexp
+}
+
+type paramEntry struct {
+	node  ResourceManagerI
+	param *Param
+}
+
+// childRouter 是编译好的子节点查找表
+//
+// 只由字面量单词组成的组以 types.NormalizeToken 的结果为键，查找只需一次哈希，与子节点数量无关；
+// 键相同的候选节点再用预编译的正则确认。含有正则元字符的组无法归一化，这些节点按顺序逐一用正则匹配。
+// 两者都匹配时 Use 中顺序靠前的优先，与逐一调用 WordList.Match 的结果完全相同
+//
+// 字面量节点都不匹配时，依次尝试单段参数节点和通配节点，见 Param
+//
+// 各节点的 WordList 只在构建时读取，GetWordList 的返回值改变后需要调用一次 Use()（可以不带参数）使查找表重建
+type childRouter struct {
+	// 归一化键 -> 候选节点，按 Use 的顺序排列
+	literal map[string][]routeEntry
+	// 含有正则的节点，按 Use 的顺序排列
+	patterns []routeEntry
+	params   []paramEntry
+	catchAll []paramEntry
+}
+
+func newChildRouter(nodes []ResourceManagerI) *childRouter {
+	router := &childRouter{literal: map[string][]routeEntry{}}
+	for i, node := range nodes {
+		if pn, ok := node.(paramNode); ok && pn.param() != nil {
+			p := pn.param()
+			if p.CatchAll {
+				router.catchAll = append(router.catchAll, paramEntry{node: node, param: p})
+			} else {
+				router.params = append(router.params, paramEntry{node: node, param: p})
+			}
+			continue
+		}
+		wl := node.WordList()
+		entry := routeEntry{index: i, node: node, matcher: wl.Compile()}
+		keys, hasPattern := wl.LiteralKeys()
+		if hasPattern {
+			// 正则已经包括了所有的组，不需要再放入字面量表
+			router.patterns = append(router.patterns, entry)
+			continue
+		}
+		seen := map[string]bool{}
+		for _, key := range keys {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			router.literal[key] = append(router.literal[key], entry)
+		}
+	}
+	return router
+}
+
+// 查找匹配 paths.SuffixPath[0] 的子节点，没有则返回 nil；匹配到参数节点时，返回的 PathPack 中包含捕获的值
+func (router *childRouter) match(paths PathPack) (ResourceManagerI, PathPack) {
+	token := paths.SuffixPath[0]
+	var found *routeEntry
+	candidates := router.literal[types.NormalizeToken(token)]
+	for i := range candidates {
+		if candidates[i].matcher.MatchString(token) {
+			found = &candidates[i]
+			break
+		}
+	}
+	// 只需要尝试顺序在已找到的字面量节点之前的正则节点
+	for i := range router.patterns {
+		if found != nil && router.patterns[i].index > found.index {
+			break
+		}
+		if router.patterns[i].matcher.MatchString(token) {
+			found = &router.patterns[i]
+			break
+		}
+	}
+	if found != nil {
+		return found.node, paths
+	}
+	for _, entry := range router.params {
+		if entry.param.match(token) {
+			return entry.node, paths.withParam(entry.param.Name, token)
+		}
+	}
+	if len(router.catchAll) > 0 {
+		entry := router.catchAll[0]
+		return entry.node, paths.withParam(entry.param.Name, strings.Join(paths.SuffixPath, "/"))
+	}
+	return nil, paths
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"github.com/TelephoneTan/GoHTTPServer/types"
+	"strconv"
+	"testing"
+)
+
+// 比较逐一调用 WordList.Match 与 childRouter 查找的开销，要查找的是最后一个子节点，即逐一匹配的最坏情况
+func BenchmarkChildRouter(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		specs := make([]routeSpec, n)
+		for i := range specs {
+			specs[i] = routeSpec{words: types.WordList{{"node", strconv.Itoa(i)}}}
+		}
+		nodes := newRouteNodes(specs)
+		token := "Node-" + strconv.Itoa(n-1)
+		b.Run("scan/n="+strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, node := range nodes {
+					if node.WordList().Match(token) {
+						break
+					}
+				}
+			}
+		})
+		b.Run("router/n="+strconv.Itoa(n), func(b *testing.B) {
+			router := newChildRouter(nodes)
+			paths := PathPack{SuffixPath: []string{token}}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if node, _ := router.match(paths); node == nil {
+					b.Fatal("no match")
+				}
+			}
+		})
+	}
+}
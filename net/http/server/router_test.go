@@ -0,0 +1,100 @@
+package server
+
+import (
+	"github.com/TelephoneTan/GoHTTPServer/types"
+	"testing"
+)
+
+// 测试用的子节点描述
+type routeSpec struct {
+	words    types.WordList
+	param    string
+	pattern  string
+	catchAll bool
+}
+
+func newRouteNodes(specs []routeSpec) []ResourceManagerI {
+	nodes := make([]ResourceManagerI, 0, len(specs))
+	for _, spec := range specs {
+		switch {
+		case spec.catchAll:
+			nodes = append(nodes, NewCatchAllResourceManager[any](spec.param, nil))
+		case spec.param != "":
+			nodes = append(nodes, NewParamResourceManager[any](spec.param, spec.pattern, nil))
+		default:
+			words := spec.words
+			nodes = append(nodes, NewResourceManager[any](func() types.WordList { return words }, nil))
+		}
+	}
+	return nodes
+}
+
+func TestChildRouterMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		specs  []routeSpec
+		suffix []string
+		// 匹配到的节点下标，-1 表示没有匹配
+		want       int
+		wantParams map[string]string
+	}{
+		{"literal", []routeSpec{{words: types.WordList{{"static"}}}}, []string{"static"}, 0, nil},
+		{"case insensitive", []routeSpec{{words: types.WordList{{"static"}}}}, []string{"STATIC"}, 0, nil},
+		{"separators between words", []routeSpec{{words: types.WordList{{"user", "info"}}}}, []string{"user-_.INFO"}, 0, nil},
+		{"words without separator", []routeSpec{{words: types.WordList{{"user", "info"}}}}, []string{"userinfo"}, 0, nil},
+		{"leading separator", []routeSpec{{words: types.WordList{{"user", "info"}}}}, []string{"-userinfo"}, -1, nil},
+		{"long s folds to s", []routeSpec{{words: types.WordList{{"css"}}}}, []string{"cſs"}, 0, nil},
+		{"kelvin sign folds to k", []routeSpec{{words: types.WordList{{"kb"}}}}, []string{"Kb"}, 0, nil},
+		{"second group", []routeSpec{{words: types.WordList{{"img"}, {"image"}}}}, []string{"Image"}, 0, nil},
+		{"regex group", []routeSpec{{words: types.WordList{{"v[0-9]+"}}}}, []string{"v12"}, 0, nil},
+		{"mixed node literal group", []routeSpec{{words: types.WordList{{"latest"}, {"v[0-9]+"}}}}, []string{"LATEST"}, 0, nil},
+		{"earlier regex wins", []routeSpec{{words: types.WordList{{"v[0-9]+"}}}, {words: types.WordList{{"v1"}}}}, []string{"v1"}, 0, nil},
+		{"earlier literal wins", []routeSpec{{words: types.WordList{{"v1"}}}, {words: types.WordList{{"v[0-9]+"}}}}, []string{"v1"}, 0, nil},
+		{"later regex", []routeSpec{{words: types.WordList{{"v1"}}}, {words: types.WordList{{"v[0-9]+"}}}}, []string{"v2"}, 1, nil},
+		{"earlier literal of same key wins", []routeSpec{{words: types.WordList{{"a", "b"}}}, {words: types.WordList{{"ab"}}}}, []string{"ab"}, 0, nil},
+		{"no match", []routeSpec{{words: types.WordList{{"static"}}}}, []string{"dynamic"}, -1, nil},
+		{"literal before param", []routeSpec{{words: types.WordList{{"list"}}}, {param: "id", pattern: "[0-9]+"}}, []string{"list"}, 0, nil},
+		{"param", []routeSpec{{words: types.WordList{{"list"}}}, {param: "id", pattern: "[0-9]+"}}, []string{"42"}, 1, map[string]string{"id": "42"}},
+		{"param pattern mismatch", []routeSpec{{param: "id", pattern: "[0-9]+"}}, []string{"abc"}, -1, nil},
+		{"catch-all", []routeSpec{{param: "id", pattern: "[0-9]+"}, {param: "rest", catchAll: true}}, []string{"a", "b"}, 1, map[string]string{"rest": "a/b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := newRouteNodes(tt.specs)
+			node, paths := newChildRouter(nodes).match(PathPack{SuffixPath: tt.suffix})
+			got := -1
+			for i, n := range nodes {
+				if n == node {
+					got = i
+				}
+			}
+			if got != tt.want {
+				t.Fatalf("match(%q) = node %d, want %d", tt.suffix, got, tt.want)
+			}
+			if len(paths.Params) != len(tt.wantParams) {
+				t.Fatalf("match(%q) params = %v, want %v", tt.suffix, paths.Params, tt.wantParams)
+			}
+			for k, v := range tt.wantParams {
+				if paths.Params[k] != v {
+					t.Errorf("match(%q) params = %v, want %v", tt.suffix, paths.Params, tt.wantParams)
+				}
+			}
+			// 没有参数节点时与逐一调用 WordList.Match 的结果相同
+			if tt.wantParams == nil {
+				scan := -1
+				for i, n := range nodes {
+					if pn, ok := n.(paramNode); ok && pn.param() != nil {
+						continue
+					}
+					if n.WordList().Match(tt.suffix[0]) {
+						scan = i
+						break
+					}
+				}
+				if scan != got {
+					t.Errorf("match(%q) = node %d, WordList.Match scan = %d", tt.suffix, got, scan)
+				}
+			}
+		})
+	}
+}
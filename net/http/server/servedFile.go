@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"github.com/TelephoneTan/GoHTTPServer/net/http/header"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// 文件服务器要发送的文件，内容可能来自磁盘或 FileCache
+type servedFile struct {
+	path    string
+	info    os.FileInfo
+	content io.ReadSeeker
+	// 来自 FileCache 时已经计算好，否则为空
+	etag  string
+	close func()
+}
+
+func (entry *fileCacheEntry) served() *servedFile {
+	return &servedFile{
+		path:    entry.path,
+		info:    entry.info,
+		content: bytes.NewReader(entry.content),
+		etag:    entry.etag,
+		close:   func() {},
+	}
+}
+
+// 打开文件，设置了 FileCache 时优先使用缓存，没有命中时读取文件并尝试加入缓存
+func (s Server) openFile(filePath string) (*servedFile, error) {
+	if s.FileCache != nil {
+		if entry, hit := s.FileCache.get(filePath); hit {
+			return entry.served(), nil
+		}
+	}
+	return s.readFile(filePath)
+}
+
+// 打开预压缩文件，与 openFile 相同，但 FileCache 还会记住不存在的文件，并且查找不计入命中和未命中
+func (s Server) openVariant(filePath string) (*servedFile, error) {
+	if s.FileCache == nil {
+		return s.readFile(filePath)
+	}
+	if entry, hit := s.FileCache.lookup(filePath); hit {
+		if entry.info == nil {
+			return nil, fs.ErrNotExist
+		}
+		return entry.served(), nil
+	}
+	file, err := s.readFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.FileCache.putMissing(filePath)
+	}
+	return file, err
+}
+
+// 从磁盘读取文件，设置了 FileCache 时尝试加入缓存
+func (s Server) readFile(filePath string) (*servedFile, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if s.FileCache != nil {
+		if entry, ok := s.FileCache.put(filePath, info, f); ok {
+			_ = f.Close()
+			return entry.served(), nil
+		}
+	}
+	return &servedFile{path: filePath, info: info, content: f, close: func() { _ = f.Close() }}, nil
+}
+
+// 预压缩文件的编码和扩展名，按优先级排列
+var precompressedEncodings = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// gzip.Handler 外层的请求头部和 http.ResponseWriter
+type beforeGzip struct {
+	acceptEncoding []string
+	w              http.ResponseWriter
+}
+
+// 包装 gzip.Handler，在它删除 Accept-Encoding 之前记下原值，使预压缩文件在开启 gzip 的服务上仍然可用
+func keepAcceptEncoding(gzipHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, state := ensureRequestState(r)
+		state.beforeGzip = &beforeGzip{acceptEncoding: r.Header.Values(header.AcceptEncoding), w: w}
+		gzipHandler.ServeHTTP(w, r)
+	})
+}
+
+// gzip.Handler 正在压缩该请求的回复时返回其外层的信息，否则返回空
+func (st *requestState) gzipping(r *http.Request) *beforeGzip {
+	if st == nil || st.beforeGzip == nil || len(st.beforeGzip.acceptEncoding) == 0 {
+		return nil
+	}
+	// gzip.Handler 只在压缩时删除 Accept-Encoding
+	if len(r.Header.Values(header.AcceptEncoding)) > 0 {
+		return nil
+	}
+	return st.beforeGzip
+}
+
+// 客户端是否接受 encoding 编码，q=0 表示不接受
+func acceptsEncoding(acceptEncoding []string, encoding string) bool {
+	for _, value := range acceptEncoding {
+		for _, part := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(part, ";")
+			if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+				continue
+			}
+			q := strings.ReplaceAll(params, " ", "")
+			return !strings.HasPrefix(q, "q=0") || strings.Trim(q[len("q="):], "0.") != ""
+		}
+	}
+	return false
+}
+
+// 客户端接受时，改为发送与 source 同目录的预压缩文件（例如 app.js.br、app.js.gz），返回空表示发送原文件
+//
+// 比原文件旧的预压缩文件视为过期，不会被发送。
+// 请求经过 gzip.Handler 时，按其删除之前的 Accept-Encoding 选择，并让回复绕过 gzip.Handler，以免重复压缩
+func (s Server) openPrecompressed(w http.ResponseWriter, r *http.Request, source *servedFile) *servedFile {
+	if s.HasPrecompressedFiles == nil || !s.HasPrecompressedFiles() {
+		return nil
+	}
+	addVary(w, header.AcceptEncoding)
+	acceptEncoding := r.Header.Values(header.AcceptEncoding)
+	state := getRequestState(r)
+	gzipping := state.gzipping(r)
+	if gzipping != nil {
+		if state.response == nil || state.response.started() {
+			return nil
+		}
+		acceptEncoding = gzipping.acceptEncoding
+	}
+	for _, pc := range precompressedEncodings {
+		if !acceptsEncoding(acceptEncoding, pc.encoding) {
+			continue
+		}
+		file, err := s.openVariant(source.path + pc.extension)
+		if err != nil {
+			continue
+		}
+		if !file.info.Mode().IsRegular() || file.info.ModTime().Before(source.info.ModTime()) {
+			file.close()
+			continue
+		}
+		if gzipping != nil {
+			state.response.bypassTo(gzipping.w)
+		}
+		w.Header().Set(header.ContentEncoding, pc.encoding)
+		return file
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"github.com/TelephoneTan/GoHTTPGzipServer/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding []string
+		encoding       string
+		want           bool
+	}{
+		{[]string{"gzip, br"}, "br", true},
+		{[]string{"gzip", "BR"}, "br", true},
+		{[]string{"gzip;q=1.0, br;q=0.5"}, "br", true},
+		{[]string{"br;q=0"}, "br", false},
+		{[]string{"br; q=0.000"}, "br", false},
+		{[]string{"br;q=0.001"}, "br", true},
+		{[]string{"gzip"}, "br", false},
+		{nil, "gzip", false},
+	}
+	for _, tt := range tests {
+		if got := acceptsEncoding(tt.acceptEncoding, tt.encoding); got != tt.want {
+			t.Errorf("acceptsEncoding(%q, %s) = %v, want %v", tt.acceptEncoding, tt.encoding, got, tt.want)
+		}
+	}
+}
+
+func TestPrecompressedFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string, modTime time.Time) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(dir, name), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().Truncate(time.Second)
+	write("app.js", "source", now)
+	write("app.js.br", "brotli", now)
+	write("app.js.gz", "gzipped", now.Add(-time.Hour))
+	write("old.js", "old source", now)
+	write("old.js.br", "stale", now.Add(-time.Hour))
+
+	s := NewServer(nil, nil, func(s Server) {
+		s.HasPrecompressedFiles = func() bool { return true }
+	})
+	c := NewContainer(nil, nil, nil)
+	serveFile := c.serve(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.HandleFile(w, r, filepath.Join(dir, filepath.Base(r.URL.Path)), false)
+	}))
+	tests := []struct {
+		name           string
+		file           string
+		acceptEncoding string
+		gzip           bool
+		wantEncoding   string
+		wantBody       string
+	}{
+		{"brotli", "app.js", "gzip, br", false, "br", "brotli"},
+		{"stale gzip variant", "app.js", "gzip", false, "", "source"},
+		{"stale brotli variant", "old.js", "br", false, "", "old source"},
+		{"not accepted", "app.js", "identity", false, "", "source"},
+		{"brotli behind gzip.Handler", "app.js", "gzip, br", true, "br", "brotli"},
+		{"stale variant behind gzip.Handler", "old.js", "gzip, br", true, "gzip", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := serveFile
+			if tt.gzip {
+				handler = keepAcceptEncoding(&gzip.Handler{Handler: serveFile})
+			}
+			r := httptest.NewRequest("GET", "/"+tt.file, nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d", w.Code)
+			}
+			// gzip.Handler 在回复发出之后才整理头部，只比较发出时的头部
+			if got := w.Result().Header.Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			// 经过 gzip.Handler 压缩的回复体不作比较
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if r.Header.Get("Accept-Encoding") != tt.acceptEncoding {
+				t.Errorf("Accept-Encoding = %q after serving", r.Header.Get("Accept-Encoding"))
+			}
+		})
+	}
+}
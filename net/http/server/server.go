@@ -1,7 +1,6 @@
 package server
 
 import (
-	"fmt"
 	"github.com/TelephoneTan/GoHTTPServer/net/http/header"
 	"github.com/TelephoneTan/GoHTTPServer/net/http/method"
 	"github.com/TelephoneTan/GoHTTPServer/util"
@@ -12,10 +11,11 @@ import (
 	"mime"
 	"net"
 	"net/http"
-	"os"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,20 +24,71 @@ type HostPack struct {
 	HostPort *uint16
 	IP       net.IP
 	IPPort   *uint16
+	// 主机名被 GetHosts 中的通配、后缀或正则形式匹配时捕获的部分（例如租户名），小写
+	Tenant string `json:",omitempty"`
 }
 
 type _Server struct {
-	GetRoot           func(HostPack) string
-	GetRootRelative   func(HostPack) string
-	GetHosts          func() []string
-	GetHostPorts      func() []uint16
-	GetIPs            func() []net.IP
-	GetIPPorts        func() []uint16
+	GetRoot         func(HostPack) string
+	GetRootRelative func(HostPack) string
+	GetHosts        func() []string
+	GetHostPorts    func() []uint16
+	GetIPs          func() []net.IP
+	GetIPPorts      func() []uint16
+	// 以下三项分别补充 GetHostPorts、GetIPs 和 GetIPPorts，与之取并集，两者都为空时不限制：
+	//
+	// 端口可以是单个端口或区间（例如 8000-8999），IP 可以是单个 IP、CIDR（例如 10.0.0.0/8）或区间（例如 10.0.0.1-10.0.0.99）；
+	// 以 ! 开头的项表示排除，排除优先，只有排除项时表示除排除项之外的全部
+	GetHostPortRanges func() []string
+	GetIPRanges       func() []string
+	GetIPPortRanges   func() []string
 	Guard             func(http.ResponseWriter, *http.Request, *PathPack) bool
 	HasRootFileServer func() bool
 	GetCDNHost        func() string
 	GetCDNOriginHosts func() []string
-	nodes             []ResourceManagerI
+	// CDN 重定向 URL 的签名设置，设置了密钥时重定向 URL 带有签名，来自 GetCDNOriginHosts 的回源请求必须带有有效的签名
+	GetCDNSignOptions func() CDNSignOptions
+	// 缓存规则，按顺序使用第一条匹配的规则设置 Cache-Control 和 Vary，用于文件服务器和 ResourceRequestHandler.Reply；
+	// 没有匹配的规则时，文件服务器使用 private 或永久缓存，Reply 不做改动
+	GetCacheRules func() []CacheRule
+	// 根据内容计算文件 ETag 的最大文件大小，默认为 64 MiB，为负数时不计算；更大的文件只使用 Last-Modified
+	GetETagMaxFileSize func() int64
+	// 文件服务器的内存缓存，为空时每次都从磁盘读取
+	FileCache FileCache
+	// 为 true 时，如果客户端接受，文件服务器改为发送同目录下的预压缩文件（.br 或 .gz）；
+	// 比原文件旧的预压缩文件不会被发送。服务开启了 gzip 时同样有效，预压缩文件不会被再次压缩
+	HasPrecompressedFiles func() bool
+	// 维护模式的设置，维护模式通过 SetMaintenance 开启和关闭
+	GetMaintenanceOptions func() MaintenanceOptions
+	// 按客户端 IP 的访问控制，每个请求都会重新读取，在维护模式之后、守卫之前检查
+	GetAccessControl func() AccessControl
+	// 错误上报钩子，HandlePanic 处理本 Server 上发生的错误时会调用
+	ErrorHooks ErrorHooks
+	// 访问日志，只记录被本 Server 处理的请求
+	AccessLog AccessLog
+	// 指标统计，只统计被本 Server 处理的请求；与 Container.Metrics 是同一个时由 Container 统计，不重复计数
+	Metrics Metrics
+	// 追踪导出器，仅在请求没有被 Container 追踪时使用，只追踪匹配并处理了的请求
+	SpanExporter SpanExporter
+	nodes        []ResourceManagerI
+	// 编译好的子节点查找表，首次路由时根据各节点的 WordList 构建，Use 之后重新构建
+	router atomic.Pointer[childRouter]
+	// Reconfigure 之后生效的配置
+	active          atomic.Pointer[_Server]
+	reconfigureLock sync.Mutex
+	// 运行时开关，在 Reconfigure 前后的配置之间共享
+	switches *serverSwitches
+	// 端口和 IP 的查找结构
+	hostPortMatcher matcherCache[util.PortSet]
+	ipMatcher       matcherCache[util.IPRangeSet]
+	ipPortMatcher   matcherCache[util.PortSet]
+	accessControl   matcherCache[compiledAccessControl]
+}
+
+type serverSwitches struct {
+	maintenance atomic.Bool
+	// 最近一次开启维护模式时加载的设置
+	maintenanceSettings atomic.Pointer[loadedMaintenance]
 }
 
 type Server = *_Server
@@ -60,14 +111,51 @@ func NewServer(getRoot func(HostPack) string, getRootRelative func(HostPack) str
 	return util.New(&_Server{
 		GetRoot:         getRoot,
 		GetRootRelative: getRootRelative,
+		switches:        &serverSwitches{},
 	}, init...)
 }
 
 func (s Server) Use(child ...ResourceManagerI) Server {
+	if s.active.Load() != nil {
+		return s.Reconfigure(func(next Server) {
+			next.nodes = append(next.nodes, child...)
+		})
+	}
 	s.nodes = append(s.nodes, child...)
+	s.router.Store(nil)
 	return s
 }
 
+// SetMaintenance 开启或关闭维护模式，可以在运行时随时切换
+//
+// 维护模式下 Server 对所有请求回复 503，附带 GetMaintenanceOptions 指定的 Retry-After 和维护页面，
+// 来自允许的 IP、携带绕过 Cookie 或头部以及访问绕过路径的请求除外。维护模式在守卫和节点匹配之前检查
+//
+// 开启时读取 GetMaintenanceOptions，并加载维护页面文件和解析允许的 IP；设置或页面文件改变后再次调用 SetMaintenance(true) 使其生效
+func (s Server) SetMaintenance(on bool) {
+	if on {
+		var options MaintenanceOptions
+		if current := s.current(); current.GetMaintenanceOptions != nil {
+			options = current.GetMaintenanceOptions()
+		}
+		s.switches.maintenanceSettings.Store(loadMaintenance(options))
+	}
+	s.switches.maintenance.Store(on)
+}
+
+func (s Server) InMaintenance() bool {
+	return s.switches != nil && s.switches.maintenance.Load()
+}
+
+func (s Server) childRouter() *childRouter {
+	if router := s.router.Load(); router != nil {
+		return router
+	}
+	router := newChildRouter(s.nodes)
+	s.router.Store(router)
+	return router
+}
+
 func extractHost(s string) string {
 	if s[0] == '[' {
 		return s[:strings.IndexRune(s, ']')+1]
@@ -97,8 +185,12 @@ func getIPPort(r *http.Request) (ip net.IP, port *uint16) {
 }
 
 func getHostPort(r *http.Request) (host string, port *uint16) {
-	host = extractHost(r.Host)
-	port, _ = extractPort(r.Host)
+	effectiveHost := Effective(r).Host
+	if effectiveHost == "" {
+		return "", nil
+	}
+	host = extractHost(effectiveHost)
+	port, _ = extractPort(effectiveHost)
 	return host, port
 }
 
@@ -125,98 +217,133 @@ func withoutBrackets(s string) string {
 	return s
 }
 
-func matchHost(host string, getValidHosts func() []string) bool {
+// 除了普通主机名，GetHosts 中还可以使用以下形式：
+//
+//	*.example.com   通配，匹配 example.com 下一级的任意子域名，捕获该级标签
+//	.example.com    后缀，匹配 example.com 及其任意级子域名，捕获 example.com 之前的部分
+//	~regexp         正则，不区分大小写地匹配整个主机名，捕获名为 tenant 的分组，没有时捕获第一个分组
+func matchHost(host string, getValidHosts func() []string) (matched bool, pattern string, tenant string) {
 	if getValidHosts == nil {
-		return true
+		return true, "", ""
 	}
 	if host == "" {
-		return false
+		return false, "", ""
 	}
 	host, err := idna.ToUnicode(host)
 	if err != nil {
-		return false
+		return false, "", ""
 	}
 	host = withoutBrackets(host)
 	validHosts := getValidHosts()
 	for _, validHost := range validHosts {
-		validHost, err = idna.ToUnicode(validHost)
-		if err == nil && strings.EqualFold(host, withoutBrackets(validHost)) {
-			return true
+		pattern = validHost
+		if strings.HasPrefix(validHost, "~") {
+			if matched, tenant = matchHostRegexp(host, validHost[1:]); matched {
+				return true, pattern, tenant
+			}
+			continue
 		}
-	}
-	return false
-}
-
-func matchIP(ip net.IP, getValidIPs func() []net.IP) bool {
-	if getValidIPs == nil {
-		return true
-	}
-	if ip == nil {
-		return false
-	}
-	validIPs := getValidIPs()
-	for _, validIP := range validIPs {
-		if validIP.Equal(ip) {
-			return true
+		validHost, err = idna.ToUnicode(validHost)
+		if err != nil {
+			continue
 		}
-	}
-	return false
-}
-
-func matchPort(port *uint16, getValidPorts func() []uint16) bool {
-	if getValidPorts == nil {
-		return true
-	}
-	if port == nil {
-		return false
-	}
-	validPorts := getValidPorts()
-	for _, validPort := range validPorts {
-		if *port == validPort {
-			return true
+		switch {
+		case strings.HasPrefix(validHost, "*."):
+			if matched, tenant = matchHostSuffix(host, validHost[1:]); matched && !strings.Contains(tenant, ".") {
+				return true, pattern, tenant
+			}
+		case strings.HasPrefix(validHost, "."):
+			if strings.EqualFold(host, validHost[1:]) {
+				return true, pattern, ""
+			}
+			if matched, tenant = matchHostSuffix(host, validHost); matched {
+				return true, pattern, tenant
+			}
+		default:
+			if strings.EqualFold(host, withoutBrackets(validHost)) {
+				return true, pattern, ""
+			}
 		}
 	}
-	return false
+	return false, "", ""
 }
 
-func (s Server) match(hostInfo HostPack) bool {
-	return matchHost(hostInfo.Host, s.GetHosts) &&
-		matchPort(hostInfo.HostPort, s.GetHostPorts) &&
-		matchIP(hostInfo.IP, s.GetIPs) &&
-		matchPort(hostInfo.IPPort, s.GetIPPorts)
+// 匹配成功时还返回匹配的 GetHosts 中的项，GetHosts 为空时为空字符串
+func (s Server) match(hostInfo *HostPack) (bool, string) {
+	matched, pattern, tenant := matchHost(hostInfo.Host, s.GetHosts)
+	if !matched ||
+		!matchPort(hostInfo.HostPort, s.GetHostPorts, s.GetHostPortRanges, &s.hostPortMatcher) ||
+		!matchIP(hostInfo.IP, s.GetIPs, s.GetIPRanges, &s.ipMatcher) ||
+		!matchPort(hostInfo.IPPort, s.GetIPPorts, s.GetIPPortRanges, &s.ipPortMatcher) {
+		return false, ""
+	}
+	hostInfo.Tenant = tenant
+	return true, pattern
 }
 
+// HandlePanic 处理错误并作出错误回复
+//
+// 如果回复已经开始发送（头部已写出或连接已被劫持），则无法再改写状态码，
+// 此时只记录并上报错误，然后以 http.ErrAbortHandler 中止连接（HTTP/2 下会发送 RST_STREAM），
+// 以免客户端收到被破坏的回复
 func HandlePanic(w http.ResponseWriter, r *http.Request, panicArgument any) {
 	var id string
+	var code string
 	var statusCode int
 	var stackTrace []byte
+	aborted := false
+	requestID := RequestID(r)
+	if state := getRequestState(r); state != nil && state.response != nil && state.response.started() {
+		aborted = true
+	}
 	switch e := panicArgument.(type) {
 	case Exception:
-		e.SetHeader(w)
-		w.Header().Add("Reason", mime.QEncoding.Encode("utf-8", e.TipZH()))
-		w.Header().Add("Error-Code", mime.QEncoding.Encode("utf-8", e.Code()))
-		w.Header().Add("Error-ID", mime.QEncoding.Encode("utf-8", e.ID()))
+		id = e.ID()
+		code = e.Code()
 		statusCode = e.HTTPCode()
 		stackTrace = []byte(e.StackTrace())
+		if !aborted {
+			e.SetHeader(w)
+			w.Header().Add("Reason", mime.QEncoding.Encode("utf-8", e.TipZH()))
+			w.Header().Add("Error-Code", mime.QEncoding.Encode("utf-8", e.Code()))
+			w.Header().Add("Error-ID", mime.QEncoding.Encode("utf-8", e.ID()))
+		}
 	default:
-		id = fmt.Sprintf("E#%v#%v ", time.Now().UnixNano(), rand.Int())
-		w.Header().Add("Error-ID", id)
+		id = newErrorID()
 		statusCode = http.StatusInternalServerError
+		code = http.StatusText(statusCode)
 		stackTrace = debug.Stack()
+		if !aborted {
+			w.Header().Add("Error-ID", id)
+		}
 	}
-	if r.Method != "HEAD" {
-		w.Header().Set("Content-Length", "0")
+	if !aborted {
+		if r.Method != "HEAD" {
+			w.Header().Set("Content-Length", "0")
+		}
+		w.WriteHeader(statusCode)
 	}
-	w.WriteHeader(statusCode)
 	log.EF(
-		"\n发生了错误：%v%v\n"+
+		"\n发生了错误：%v %v\n"+
+			"\n请求 ID：%v\n"+
 			"\n======================================\n"+
 			"\n%s\n"+
 			"\n======================================\n",
 		id,
 		panicArgument,
+		requestID,
 		stackTrace,
 	)
+	if state := getRequestState(r); state != nil {
+		state.errorID = id
+	}
+	event := newPanicEvent(r, id, code, statusCode, stackTrace, panicArgument)
+	event.Aborted = aborted
+	reportPanic(r, event)
+	if aborted {
+		log.EF("回复已经开始发送，中止连接：%v", id)
+		panic(http.ErrAbortHandler)
+	}
 }
 
 func (s Server) Handle(w http.ResponseWriter, r *http.Request) (handled bool) {
@@ -232,6 +359,30 @@ notHandle:
 	handled = false
 	goto end
 start:
+	//goland:noinspection GoAssignmentToReceiver
+	s = s.current()
+	r, state := ensureRequestState(r)
+	state.server = s
+	w = state.trackResponse(w)
+	state.assignRequestID(w, r, defaultRequestIDHeader, false)
+	state.nodes = nil
+	metrics := state.serverMetrics(s.Metrics)
+	defer func() {
+		if handled || state.response.started() {
+			state.handled = true
+			s.AccessLog.log(r, state)
+			metrics.record(r, state)
+		}
+	}()
+	// 追踪只在请求匹配该 Server 之后开始，以免 Dispatcher 下不匹配的 Server 提前结束根 Span
+	var root *activeSpan
+	defer func() {
+		if handled || state.response.started() {
+			state.endTrace(root)
+		} else {
+			state.discardTrace(w, root)
+		}
+	}()
 	defer func() {
 		if !normal {
 			HandlePanic(w, r, recover())
@@ -239,9 +390,15 @@ start:
 		}
 	}()
 	hostInfo := getHostInfo(r)
-	if !s.match(hostInfo) {
+	state.hostInfo = &hostInfo
+	if matched, pattern := s.match(&hostInfo); !matched {
 		goto notHandle
+	} else {
+		state.hostLabel = strings.ToLower(pattern)
 	}
+	root = state.startTrace(w, r, s.SpanExporter)
+	metrics.begin(state.hostLabel)
+	defer metrics.end(state.hostLabel)
 	if !s.handle(w, r, hostInfo) {
 		goto notHandle
 	}
@@ -263,7 +420,7 @@ func (s Server) toCDN(w http.ResponseWriter, r *http.Request) bool {
 		}
 		cdnHost, _ := idna.ToASCII(cdnHost)
 		w.Header().Set("Content-Length", "0")
-		w.Header().Set("Location", "//"+cdnHost+r.RequestURI)
+		w.Header().Set("Location", "//"+cdnHost+s.cdnRedirectURI(r))
 		w.WriteHeader(http.StatusTemporaryRedirect)
 		return true
 	} else {
@@ -272,24 +429,17 @@ func (s Server) toCDN(w http.ResponseWriter, r *http.Request) bool {
 }
 
 func (s Server) HandleFile(w http.ResponseWriter, r *http.Request, filePath string, privateOrNoCDN bool) {
+	span := startSpan(r, "file", "file.path", filePath)
+	defer span.end()
 	tag := "FileServer"
-	fileInfo, err := os.Stat(filePath)
-	ff, err2 := os.Open(filePath)
-	if err2 == nil { // 如果成功打开了文件，记得关闭文件
-		defer func() {
-			_ = ff.Close()
-		}()
-	}
+	file, err := s.openFile(filePath)
 	if err != nil {
 		log.EF("%s : 发生了错误 (%v) 在文件 (%s) 上", tag, err, filePath)
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
-	if err2 != nil {
-		log.EF("%s : 发生了错误 (%v) 在文件 (%s) 上", tag, err2, filePath)
-		w.WriteHeader(http.StatusNotFound)
-		return
-	}
+	// 记得关闭文件
+	defer file.close()
 	switch method.Parse(r.Method) {
 	// 方法查询
 	case method.OPTIONS:
@@ -307,12 +457,22 @@ func (s Server) HandleFile(w http.ResponseWriter, r *http.Request, filePath stri
 		method.HEAD,
 		// 查
 		method.GET:
-		if fileInfo.IsDir() {
+		if file.info.IsDir() {
 			log.WF("%s : 文件 (%s) 是个目录", tag, filePath)
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		if privateOrNoCDN {
+		policy, hasPolicy := s.cachePolicy(newCacheSubject(r, filePath, ""))
+		if hasPolicy {
+			if privateOrNoCDN {
+				// 私有的文件不能存放在公共缓存上，也不能重定向到 CDN
+				policy.Private = true
+				policy.SMaxAge = 0
+			} else if policy.public() && s.toCDN(w, r) {
+				return
+			}
+			policy.apply(w)
+		} else if privateOrNoCDN {
 			// 私有缓存
 			w.Header().Set(header.CacheControl, "private")
 		} else {
@@ -326,15 +486,41 @@ func (s Server) HandleFile(w http.ResponseWriter, r *http.Request, filePath stri
 			//   max-age 不会导致需要身份认证才能访问的请求回复被缓存在公有缓存上
 			httpUtil.CacheForever(w)
 		}
-		http.ServeContent(w, r, fileInfo.Name(), fileInfo.ModTime(), ff)
+		// 内容类型总是根据原文件名推断
+		name := file.info.Name()
+		if precompressed := s.openPrecompressed(w, r, file); precompressed != nil {
+			defer precompressed.close()
+			file = precompressed
+		}
+		s.setFileETag(w, file)
+		http.ServeContent(w, r, name, file.info.ModTime(), file.content)
 	// 不支持其他方法
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
+func (s Server) guard(w http.ResponseWriter, r *http.Request, paths *PathPack) bool {
+	span := startSpan(r, "guard")
+	defer span.end()
+	return s.Guard(w, r, paths)
+}
+
 func (s Server) handle(w http.ResponseWriter, r *http.Request, hostInfo HostPack) bool {
-	path := r.URL.Path
+	span := startSpan(r, "route")
+	defer span.end()
+	// 维护模式优先于一切
+	if s.InMaintenance() && s.replyMaintenance(w, r) {
+		return true
+	}
+	if checkAccess(w, r, s.GetAccessControl, &s.accessControl) {
+		return true
+	}
+	// 回源请求的签名不对时，请求不能用于路由
+	path, denied := s.checkCDNSignature(w, r)
+	if denied {
+		return true
+	}
 	if !strings.HasPrefix(path, "/") { // 确保路径以 '/' 开头，否则路径分割会不一致
 		path = "/" + path
 	}
@@ -365,18 +551,16 @@ func (s Server) handle(w http.ResponseWriter, r *http.Request, hostInfo HostPack
 			PrefixPath: prefixPath,
 			SuffixPath: suffixPath,
 		}
+		getRequestState(r).setPaths(paths)
 		{
 			// 守卫优先
-			if s.Guard != nil && s.Guard(w, r, &paths) {
+			if s.Guard != nil && s.guard(w, r, &paths) {
 				return true
 			}
 			// 匹配子节点
-			token := paths.SuffixPath[0]
-			for _, handler := range s.nodes {
-				if handler.WordList().Match(token) {
-					handler.Handle(w, r, hostInfo, paths, s, nil)
-					return true
-				}
+			if handler, paths := s.childRouter().match(paths); handler != nil {
+				handler.Handle(w, r, hostInfo, paths, s, nil)
+				return true
 			}
 			if s.HasRootFileServer != nil && s.HasRootFileServer() {
 				// 文件服务器
@@ -0,0 +1,335 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/TelephoneTan/GoHTTPServer/util"
+	"github.com/TelephoneTan/GoLog/log"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	traceParentHeader = "traceparent"
+	traceStateHeader  = "tracestate"
+	// W3C Trace Context Level 2 中的回复头部，格式与 traceparent 相同
+	traceResponseHeader = "traceresponse"
+)
+
+// TraceContext 是 W3C Trace Context，详见：https://www.w3.org/TR/trace-context/
+type TraceContext struct {
+	// 32 位小写十六进制
+	TraceID string
+	// 16 位小写十六进制，即 traceparent 中的 parent-id
+	SpanID string
+	Flags  byte
+	// tracestate 头部原样透传
+	State string
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isAllZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
+
+// ParseTraceParent 解析 traceparent 头部，格式为：version-traceid-parentid-flags
+func ParseTraceParent(traceParent string) (tc TraceContext, ok bool) {
+	traceParent = strings.TrimSpace(traceParent)
+	if len(traceParent) < 55 {
+		return tc, false
+	}
+	version := traceParent[:2]
+	if !isLowerHex(version) || version == "ff" {
+		return tc, false
+	}
+	// version 00 的长度必须恰好为 55，更高版本允许在后面追加字段
+	if version == "00" && len(traceParent) != 55 || len(traceParent) > 55 && traceParent[55] != '-' {
+		return tc, false
+	}
+	if traceParent[2] != '-' || traceParent[35] != '-' || traceParent[52] != '-' {
+		return tc, false
+	}
+	traceID, spanID, flags := traceParent[3:35], traceParent[36:52], traceParent[53:55]
+	if !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) || isAllZero(traceID) || isAllZero(spanID) {
+		return tc, false
+	}
+	flagBytes, _ := hex.DecodeString(flags)
+	return TraceContext{TraceID: traceID, SpanID: spanID, Flags: flagBytes[0]}, true
+}
+
+func (tc TraceContext) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// Inject 将 traceparent 和 tracestate 写入头部，用于调用下游服务
+func (tc TraceContext) Inject(h http.Header) {
+	h.Set(traceParentHeader, tc.TraceParent())
+	if tc.State != "" {
+		h.Set(traceStateHeader, tc.State)
+	}
+}
+
+func randomHex(n int) string {
+	bs := make([]byte, n)
+	_, _ = rand.Read(bs)
+	return hex.EncodeToString(bs)
+}
+
+// Span 是一段被追踪的处理过程
+type Span struct {
+	TraceID      string            `json:"traceID"`
+	SpanID       string            `json:"spanID"`
+	ParentSpanID string            `json:"parentSpanID,omitempty"`
+	Name         string            `json:"name"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+}
+
+// SpanExporter 接收已经结束的 Span，同一请求的 Span 在请求处理结束时一并导出，必须是并发安全的
+type SpanExporter interface {
+	Export(span Span)
+}
+
+type _MemorySpanExporter struct {
+	lock  sync.Mutex
+	spans []Span
+}
+
+// MemorySpanExporter 将 Span 保存在内存中，用于测试
+type MemorySpanExporter = *_MemorySpanExporter
+
+func NewMemorySpanExporter() MemorySpanExporter {
+	return &_MemorySpanExporter{}
+}
+
+func (e MemorySpanExporter) Export(span Span) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func (e MemorySpanExporter) Spans() []Span {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return util.ShallowCloneSlice(e.spans)
+}
+
+func (e MemorySpanExporter) Reset() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = nil
+}
+
+type _JSONSpanExporter struct {
+	writer io.Writer
+	lock   sync.Mutex
+}
+
+// JSONSpanExporter 以 JSON Lines 格式写出 Span
+type JSONSpanExporter = *_JSONSpanExporter
+
+func NewJSONSpanExporter(writer io.Writer) JSONSpanExporter {
+	return &_JSONSpanExporter{writer: writer}
+}
+
+// NewJSONFileSpanExporter 以 JSON Lines 格式将 Span 写入文件，文件超过 maxSize 字节时滚动
+func NewJSONFileSpanExporter(filePath string, maxSize int64, maxBackups int) JSONSpanExporter {
+	return NewJSONSpanExporter(util.NewRotatingFile(filePath, maxSize, maxBackups))
+}
+
+func (e JSONSpanExporter) Export(span Span) {
+	bs, err := json.Marshal(span)
+	if err != nil {
+		log.E("Span 序列化失败：", err)
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if _, err := e.writer.Write(append(bs, '\n')); err != nil {
+		log.E("Span 写入失败：", err)
+	}
+}
+
+// 单个请求的追踪状态
+type tracer struct {
+	exporter SpanExporter
+	traceID  string
+	flags    byte
+	state    string
+	current  *activeSpan
+	// 已经结束的子 Span，在根 Span 结束时一并导出，追踪被放弃时丢弃
+	finished []Span
+}
+
+type activeSpan struct {
+	tracer *tracer
+	parent *activeSpan
+	span   Span
+}
+
+func newTracer(r *http.Request, exporter SpanExporter) *tracer {
+	t := &tracer{exporter: exporter}
+	parentSpanID := ""
+	if tc, ok := ParseTraceParent(r.Header.Get(traceParentHeader)); ok {
+		t.traceID = tc.TraceID
+		t.flags = tc.Flags
+		parentSpanID = tc.SpanID
+		t.state = strings.Join(r.Header.Values(traceStateHeader), ",")
+	} else {
+		t.traceID = randomHex(16)
+		t.flags = 0x01
+	}
+	t.current = &activeSpan{
+		tracer: t,
+		span: Span{
+			TraceID:      t.traceID,
+			SpanID:       randomHex(8),
+			ParentSpanID: parentSpanID,
+			Name:         "request",
+			Start:        time.Now(),
+		},
+	}
+	return t
+}
+
+// traceparent 的 sampled 标志，没有设置时只传播追踪上下文，不导出 Span
+func (t *tracer) sampled() bool {
+	return t.flags&0x01 != 0
+}
+
+func (t *tracer) context() TraceContext {
+	return TraceContext{
+		TraceID: t.traceID,
+		SpanID:  t.current.span.SpanID,
+		Flags:   t.flags,
+		State:   t.state,
+	}
+}
+
+// 开始一个子 Span，tracer 为 nil 时返回 nil
+func (t *tracer) start(name string, attributes ...string) *activeSpan {
+	if t == nil {
+		return nil
+	}
+	s := &activeSpan{
+		tracer: t,
+		parent: t.current,
+		span: Span{
+			TraceID:      t.traceID,
+			SpanID:       randomHex(8),
+			ParentSpanID: t.current.span.SpanID,
+			Name:         name,
+			Start:        time.Now(),
+		},
+	}
+	for i := 0; i+1 < len(attributes); i += 2 {
+		s.setAttribute(attributes[i], attributes[i+1])
+	}
+	t.current = s
+	return s
+}
+
+func (s *activeSpan) setAttribute(key string, value string) {
+	if s == nil {
+		return
+	}
+	if s.span.Attributes == nil {
+		s.span.Attributes = map[string]string{}
+	}
+	s.span.Attributes[key] = value
+}
+
+// 结束 Span，当前 Span 回到父 Span；根 Span 结束时导出全部 Span
+func (s *activeSpan) end() {
+	if s == nil {
+		return
+	}
+	s.span.End = time.Now()
+	t := s.tracer
+	if s.parent != nil {
+		t.current = s.parent
+		t.finished = append(t.finished, s.span)
+		return
+	}
+	if !t.sampled() {
+		return
+	}
+	for _, span := range t.finished {
+		t.exporter.Export(span)
+	}
+	t.finished = nil
+	t.exporter.Export(s.span)
+}
+
+// 在请求上开始一个子 Span，请求没有被追踪时返回 nil
+func startSpan(r *http.Request, name string, attributes ...string) *activeSpan {
+	state := getRequestState(r)
+	if state == nil {
+		return nil
+	}
+	return state.tracer.start(name, attributes...)
+}
+
+// TraceContextFromContext 获取当前请求的追踪上下文，其中的 SpanID 是当前正在进行的 Span
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	state, _ := ctx.Value(requestStateKey{}).(*requestState)
+	if state == nil || state.tracer == nil {
+		return TraceContext{}, false
+	}
+	return state.tracer.context(), true
+}
+
+// 开始追踪请求：解析 traceparent/tracestate，在回复的 traceresponse 头部中写出本服务的根 Span，返回根 Span
+//
+// traceparent 和 tracestate 是请求头部，不会出现在回复中
+func (st *requestState) startTrace(w http.ResponseWriter, r *http.Request, exporter SpanExporter) *activeSpan {
+	if exporter == nil || st.tracer != nil {
+		return nil
+	}
+	st.tracer = newTracer(r, exporter)
+	root := st.tracer.current
+	root.setAttribute("http.method", r.Method)
+	root.setAttribute("http.host", r.Host)
+	root.setAttribute("http.target", r.RequestURI)
+	root.setAttribute("request.id", st.requestID)
+	w.Header().Set(traceResponseHeader, st.tracer.context().TraceParent())
+	return root
+}
+
+// 放弃由 root 开始的追踪，用于匹配了但没有处理请求的 Server，以便后续的 Server 重新开始追踪
+func (st *requestState) discardTrace(w http.ResponseWriter, root *activeSpan) {
+	if root == nil || st.tracer != root.tracer {
+		return
+	}
+	st.tracer = nil
+	w.Header().Del(traceResponseHeader)
+}
+
+// 结束根 Span，补充回复信息
+func (st *requestState) endTrace(root *activeSpan) {
+	if root == nil {
+		return
+	}
+	if st.response != nil {
+		root.setAttribute("http.status_code", fmt.Sprint(st.response.status()))
+	}
+	if st.errorID != "" {
+		root.setAttribute("error.id", st.errorID)
+	}
+	root.end()
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		name  string
+		input string
+		ok    bool
+		flags byte
+	}{
+		{"valid sampled", "00-" + traceID + "-" + spanID + "-01", true, 0x01},
+		{"valid not sampled", "00-" + traceID + "-" + spanID + "-00", true, 0x00},
+		{"surrounding spaces", " 00-" + traceID + "-" + spanID + "-01 ", true, 0x01},
+		{"empty", "", false, 0},
+		{"too short", "00-" + traceID + "-" + spanID[1:] + "-01", false, 0},
+		{"version 00 with extra fields", "00-" + traceID + "-" + spanID + "-01-extra", false, 0},
+		{"future version with extra fields", "01-" + traceID + "-" + spanID + "-01-extra", true, 0x01},
+		{"future version without separator", "01-" + traceID + "-" + spanID + "-01extra", false, 0},
+		{"version ff", "ff-" + traceID + "-" + spanID + "-01", false, 0},
+		{"uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + spanID + "-01", false, 0},
+		{"all-zero trace id", "00-00000000000000000000000000000000-" + spanID + "-01", false, 0},
+		{"all-zero span id", "00-" + traceID + "-0000000000000000-01", false, 0},
+		{"wrong separator", "00_" + traceID + "-" + spanID + "-01", false, 0},
+		{"non-hex flags", "00-" + traceID + "-" + spanID + "-zz", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc, ok := ParseTraceParent(tt.input)
+			if ok != tt.ok {
+				t.Fatalf("ParseTraceParent(%q) ok = %v, want %v", tt.input, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if tc.TraceID != traceID || tc.SpanID != spanID || tc.Flags != tt.flags {
+				t.Errorf("ParseTraceParent(%q) = %+v", tt.input, tc)
+			}
+		})
+	}
+}
+
+func TestTraceResponseHeader(t *testing.T) {
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tests := []struct {
+		name        string
+		traceParent string
+		wantTraceID string
+	}{
+		{"continues incoming trace", incoming, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"starts new trace", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := NewMemorySpanExporter()
+			s := NewServer(nil, nil, func(s Server) {
+				s.Guard = func(w http.ResponseWriter, _ *http.Request, _ *PathPack) bool {
+					w.WriteHeader(http.StatusNoContent)
+					return true
+				}
+				s.SpanExporter = exporter
+			})
+			r := newLocalRequest("GET", "http://example.com/")
+			if tt.traceParent != "" {
+				r.Header.Set(traceParentHeader, tt.traceParent)
+				r.Header.Set(traceStateHeader, "vendor=value")
+			}
+			w := httptest.NewRecorder()
+			s.Handle(w, r)
+			if got := w.Header().Get(traceParentHeader); got != "" {
+				t.Errorf("response traceparent = %q, want none", got)
+			}
+			if got := w.Header().Get(traceStateHeader); got != "" {
+				t.Errorf("response tracestate = %q, want none", got)
+			}
+			tc, ok := ParseTraceParent(w.Header().Get(traceResponseHeader))
+			if !ok {
+				t.Fatalf("response traceresponse = %q, want a valid value", w.Header().Get(traceResponseHeader))
+			}
+			if tt.wantTraceID != "" && tc.TraceID != tt.wantTraceID {
+				t.Errorf("traceresponse trace id = %s, want %s", tc.TraceID, tt.wantTraceID)
+			}
+			var root *Span
+			for _, span := range exporter.Spans() {
+				if span.Name == "request" {
+					span := span
+					root = &span
+				}
+			}
+			if root == nil || root.SpanID != tc.SpanID {
+				t.Errorf("traceresponse span id = %s, want the root span %+v", tc.SpanID, root)
+			}
+		})
+	}
+}
+
+func TestTraceSampledFlag(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	tests := []struct {
+		name        string
+		traceParent string
+		wantFlags   byte
+		wantSpans   bool
+	}{
+		{"sampled", "00-" + traceID + "-00f067aa0ba902b7-01", 0x01, true},
+		{"not sampled", "00-" + traceID + "-00f067aa0ba902b7-00", 0x00, false},
+		{"other flags without sampled", "00-" + traceID + "-00f067aa0ba902b7-02", 0x02, false},
+		{"new trace", "", 0x01, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := NewMemorySpanExporter()
+			var inner TraceContext
+			s := NewServer(nil, nil, func(s Server) {
+				s.Guard = func(w http.ResponseWriter, r *http.Request, _ *PathPack) bool {
+					inner, _ = TraceContextFromContext(r.Context())
+					w.WriteHeader(http.StatusNoContent)
+					return true
+				}
+				s.SpanExporter = exporter
+			})
+			r := newLocalRequest("GET", "http://example.com/")
+			if tt.traceParent != "" {
+				r.Header.Set(traceParentHeader, tt.traceParent)
+			}
+			w := httptest.NewRecorder()
+			s.Handle(w, r)
+			tc, ok := ParseTraceParent(w.Header().Get(traceResponseHeader))
+			if !ok || tc.Flags != tt.wantFlags {
+				t.Errorf("traceresponse = %q, want flags %02x", w.Header().Get(traceResponseHeader), tt.wantFlags)
+			}
+			// 没有采样的请求仍然向下游传播追踪上下文
+			if inner.TraceID != tc.TraceID || inner.Flags != tt.wantFlags {
+				t.Errorf("trace context = %+v, want trace %s with flags %02x", inner, tc.TraceID, tt.wantFlags)
+			}
+			if got := len(exporter.Spans()) > 0; got != tt.wantSpans {
+				t.Errorf("exported %d spans, want spans = %v", len(exporter.Spans()), tt.wantSpans)
+			}
+		})
+	}
+}
+
+func TestTraceUnderDispatcher(t *testing.T) {
+	newTracedServer := func(name string, hosts ...string) (Server, MemorySpanExporter) {
+		exporter := NewMemorySpanExporter()
+		s := newNamedServer(name, hosts...)
+		s.SpanExporter = exporter
+		return s, exporter
+	}
+	a, aSpans := newTracedServer("a", "a.example")
+	b, bSpans := newTracedServer("b", "b.example")
+	// 匹配所有主机但不处理请求
+	passThrough := NewServer(nil, nil, func(s Server) {
+		s.SpanExporter = NewMemorySpanExporter()
+	})
+	passThroughSpans := passThrough.SpanExporter.(MemorySpanExporter)
+	d := NewDispatcher().Add(passThrough, 1).Add(a).Add(b)
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, newLocalRequest("GET", "http://b.example/"))
+	if w.Header().Get("X-Server") != "b" {
+		t.Fatalf("served by %q, want b", w.Header().Get("X-Server"))
+	}
+	if n := len(aSpans.Spans()) + len(passThroughSpans.Spans()); n != 0 {
+		t.Errorf("servers that did not handle the request exported %d spans", n)
+	}
+	tc, ok := ParseTraceParent(w.Header().Get(traceResponseHeader))
+	if !ok {
+		t.Fatalf("traceresponse = %q, want a valid value", w.Header().Get(traceResponseHeader))
+	}
+	var root *Span
+	for _, span := range bSpans.Spans() {
+		if span.Name == "request" {
+			span := span
+			root = &span
+		}
+	}
+	if root == nil || root.SpanID != tc.SpanID || root.Attributes["http.status_code"] != "204" {
+		t.Errorf("root span = %+v, want the span %s of b", root, tc.SpanID)
+	}
+}
@@ -6,4 +6,5 @@ const (
 	TextPlainUTF8 Type = "text/plain; charset=UTF-8"
 	JSON          Type = "application/json"
 	HTML          Type = "text/html"
+	HTMLUTF8      Type = "text/html; charset=UTF-8"
 )
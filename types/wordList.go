@@ -4,10 +4,14 @@ import (
 	"github.com/TelephoneTan/GoHTTPServer/util"
 	"regexp"
 	"strings"
+	"unicode"
 )
 
 type WordList [][]string
 
+// 单词之间允许出现的分隔符
+const wordSeparators = ".-_,，。"
+
 func (w *WordList) Join() string {
 	for _, words := range *w {
 		if len(words) == 0 {
@@ -28,11 +32,64 @@ func (w *WordList) Join() string {
 	return ""
 }
 
-func (w *WordList) Match(s string) bool {
+// Compile 将 WordList 编译为正则表达式，匹配语义与 Match 相同
+func (w *WordList) Compile() *regexp.Regexp {
 	var sb strings.Builder
 	sb.WriteString(`(?i)^.^`)
 	for _, words := range *w {
 		sb.WriteString(`|^` + strings.Join(words, `[.\-_,，。]*`) + `$`)
 	}
-	return regexp.MustCompile(sb.String()).MatchString(s)
+	return regexp.MustCompile(sb.String())
+}
+
+func (w *WordList) Match(s string) bool {
+	return w.Compile().MatchString(s)
+}
+
+// 将字符映射为其大小写折叠等价类中最小的字符，与正则的 (?i) 使用相同的等价关系（unicode.SimpleFold）
+//
+// unicode.ToLower 不等价于 (?i)，例如 ſ（U+017F）在 (?i) 下与 s 相同，但 ToLower 保持不变
+func foldRune(r rune) rune {
+	smallest := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < smallest {
+			smallest = f
+		}
+	}
+	return smallest
+}
+
+// NormalizeToken 去除分隔符并做大小写折叠
+//
+// 能被 WordList 中某组字面量单词匹配的字符串，其归一化结果与该组单词拼接后的归一化结果相同，因此可以用作查找键
+func NormalizeToken(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(wordSeparators, r) {
+			return -1
+		}
+		return foldRune(r)
+	}, s)
+}
+
+// 单词中没有正则元字符时为字面量
+func isLiteral(word string) bool {
+	return regexp.QuoteMeta(word) == word
+}
+
+// LiteralKeys 返回每组字面量单词的归一化查找键，见 NormalizeToken
+//
+// 含有正则元字符的组无法用查找键表示，此时 hasPattern 为 true，调用方需要用 Compile 的结果逐一匹配
+func (w *WordList) LiteralKeys() (keys []string, hasPattern bool) {
+	for _, words := range *w {
+		literal := true
+		for _, word := range words {
+			literal = literal && isLiteral(word)
+		}
+		if !literal {
+			hasPattern = true
+			continue
+		}
+		keys = append(keys, NormalizeToken(strings.Join(words, "")))
+	}
+	return keys, hasPattern
 }
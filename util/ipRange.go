@@ -0,0 +1,171 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// 闭区间，IPv4 地址统一转换为 IPv4 映射的 IPv6 地址，使两者可以放在同一个有序列表中比较
+type ipRange struct {
+	from netip.Addr
+	to   netip.Addr
+}
+
+// 排序并合并重叠或相邻的区间，使查找可以使用二分
+func normalizeIPRanges(ranges []ipRange) []ipRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].from.Less(ranges[j].from)
+	})
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			// 重叠或相邻，即 r.from <= last.to + 1；last.to 为最大地址时 Next 无效
+			if next := last.to.Next(); !next.IsValid() || r.from.Compare(next) <= 0 {
+				if last.to.Less(r.to) {
+					last.to = r.to
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func containsIP(ranges []ipRange, addr netip.Addr) bool {
+	// 第一个 to >= addr 的区间
+	i := sort.Search(len(ranges), func(i int) bool {
+		return !ranges[i].to.Less(addr)
+	})
+	return i < len(ranges) && !addr.Less(ranges[i].from)
+}
+
+func to16(addr netip.Addr) netip.Addr {
+	return netip.AddrFrom16(addr.As16())
+}
+
+func parseAddr(s string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid IP: %q", s)
+	}
+	return to16(addr.WithZone("")), nil
+}
+
+func parseIPRange(entry string) (ipRange, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return ipRange{}, fmt.Errorf("invalid CIDR: %q", entry)
+		}
+		prefix = prefix.Masked()
+		from := prefix.Addr()
+		bits := prefix.Bits()
+		if from.Is4() {
+			bits += 96
+		}
+		from = to16(from)
+		// 将主机位全部置 1 得到区间的终点
+		to := from.As16()
+		for i := bits; i < 128; i++ {
+			to[i/8] |= 1 << (7 - i%8)
+		}
+		return ipRange{from: from, to: netip.AddrFrom16(to)}, nil
+	}
+	if dash := strings.IndexRune(entry, '-'); dash != -1 {
+		from, err := parseAddr(strings.TrimSpace(entry[:dash]))
+		if err != nil {
+			return ipRange{}, err
+		}
+		to, err := parseAddr(strings.TrimSpace(entry[dash+1:]))
+		if err != nil {
+			return ipRange{}, err
+		}
+		if to.Less(from) {
+			return ipRange{}, fmt.Errorf("invalid IP range: %q", entry)
+		}
+		return ipRange{from: from, to: to}, nil
+	}
+	addr, err := parseAddr(entry)
+	if err != nil {
+		return ipRange{}, err
+	}
+	return ipRange{from: addr, to: addr}, nil
+}
+
+// IPRangeSet 是预先排序合并好的 IP 集合，查找的时间复杂度为 O(log n)
+//
+// 每一项可以是单个 IP、CIDR 前缀（例如 10.0.0.0/8）或区间（例如 10.0.0.1-10.0.0.99），
+// 以 ! 开头的项表示排除。只有排除项时表示除排除项之外的所有 IP
+type IPRangeSet struct {
+	include []ipRange
+	exclude []ipRange
+	// 只有排除项
+	all bool
+}
+
+func ParseIPRangeSet(entries ...string) (set IPRangeSet, err error) {
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		negate := strings.HasPrefix(entry, "!")
+		if negate {
+			entry = strings.TrimSpace(entry[1:])
+		}
+		r, err := parseIPRange(entry)
+		if err != nil {
+			return IPRangeSet{}, err
+		}
+		if negate {
+			set.exclude = append(set.exclude, r)
+		} else {
+			set.include = append(set.include, r)
+		}
+	}
+	set.all = len(set.include) == 0 && len(set.exclude) > 0
+	set.include = normalizeIPRanges(set.include)
+	set.exclude = normalizeIPRanges(set.exclude)
+	return set, nil
+}
+
+// AddIPs 加入单个 IP，用于与 net.IP 列表合并，排除项仍然优先
+func (s *IPRangeSet) AddIPs(ips ...net.IP) {
+	for _, ip := range ips {
+		if addr, ok := netip.AddrFromSlice(ip); ok {
+			addr = to16(addr)
+			s.include = append(s.include, ipRange{from: addr, to: addr})
+		}
+	}
+	s.include = normalizeIPRanges(s.include)
+}
+
+func (s IPRangeSet) Empty() bool {
+	return len(s.include) == 0 && len(s.exclude) == 0
+}
+
+func (s IPRangeSet) Contains(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = to16(addr)
+	if containsIP(s.exclude, addr) {
+		return false
+	}
+	return s.all || containsIP(s.include, addr)
+}
+
+// RemoteIP 解析 r.RemoteAddr 中的 IP
+func RemoteIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return net.ParseIP(strings.Trim(host, "[]"))
+}
@@ -0,0 +1,94 @@
+package util
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseIPRangeSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		wantErr bool
+		in      []string
+		out     []string
+	}{
+		{"empty", nil, false, nil, []string{"10.0.0.1", "::1"}},
+		{"single IP", []string{"10.0.0.1"}, false, []string{"10.0.0.1", "::ffff:10.0.0.1"}, []string{"10.0.0.2"}},
+		{"IPv4 CIDR", []string{"10.0.0.0/8"}, false, []string{"10.0.0.0", "10.255.255.255"}, []string{"9.255.255.255", "11.0.0.0"}},
+		{"unmasked CIDR", []string{"192.168.1.77/24"}, false, []string{"192.168.1.0", "192.168.1.255"}, []string{"192.168.2.0"}},
+		{"IPv6 CIDR", []string{"2001:db8::/32"}, false, []string{"2001:db8::1", "2001:db8:ffff::"}, []string{"2001:db9::"}},
+		{"range", []string{"10.0.0.1 - 10.0.0.99"}, false, []string{"10.0.0.1", "10.0.0.50", "10.0.0.99"}, []string{"10.0.0.0", "10.0.0.100"}},
+		{"bracketed IPv6", []string{"[::1]"}, false, []string{"::1"}, []string{"::2"}},
+		{"adjacent ranges merge", []string{"10.0.0.0-10.0.0.9", "10.0.0.10-10.0.0.19", "10.0.0.5"}, false, []string{"10.0.0.9", "10.0.0.10", "10.0.0.19"}, []string{"10.0.0.20"}},
+		{"whole address space", []string{"::/0"}, false, []string{"::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "1.2.3.4"}, nil},
+		{"exclusion", []string{"10.0.0.0/8", "!10.0.0.0/24"}, false, []string{"10.1.0.0"}, []string{"10.0.0.1", "11.0.0.0"}},
+		{"only exclusions", []string{"!127.0.0.1", " ", "!::1"}, false, []string{"10.0.0.1", "::2"}, []string{"127.0.0.1", "::1"}},
+		{"invalid IP", []string{"10.0.0.256"}, true, nil, nil},
+		{"invalid CIDR", []string{"10.0.0.0/33"}, true, nil, nil},
+		{"reversed range", []string{"10.0.0.9-10.0.0.1"}, true, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := ParseIPRangeSet(tt.entries...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIPRangeSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, ip := range tt.in {
+				if !set.Contains(net.ParseIP(ip)) {
+					t.Errorf("Contains(%s) = false, want true", ip)
+				}
+			}
+			for _, ip := range tt.out {
+				if set.Contains(net.ParseIP(ip)) {
+					t.Errorf("Contains(%s) = true, want false", ip)
+				}
+			}
+		})
+	}
+}
+
+func TestIPRangeSetAddIPs(t *testing.T) {
+	set, err := ParseIPRangeSet("!10.0.0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.AddIPs(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), net.IPv4(10, 0, 0, 3).To4())
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.0.0.1", true},
+		// 排除项优先
+		{"10.0.0.2", false},
+		{"10.0.0.3", true},
+		// 只有排除项时包含所有 IP，加入单个 IP 之后仍然如此
+		{"10.0.0.4", true},
+	}
+	for _, tt := range tests {
+		if got := set.Contains(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("Contains(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+	if set.Contains(nil) {
+		t.Error("Contains(nil) = true")
+	}
+}
+
+func TestRemoteIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"10.0.0.1:1234", "10.0.0.1"},
+		{"[::1]:1234", "::1"},
+		{"10.0.0.1", "10.0.0.1"},
+		{"[::1]", "::1"},
+		{"@", "<nil>"},
+	}
+	for _, tt := range tests {
+		if got := RemoteIP(tt.remoteAddr).String(); got != tt.want {
+			t.Errorf("RemoteIP(%q) = %s, want %s", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
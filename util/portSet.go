@@ -0,0 +1,84 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PortSet 是以位图表示的端口集合，查找的时间复杂度为 O(1)
+//
+// 每一项可以是单个端口或区间（例如 8000-8999），以 ! 开头的项表示排除。只有排除项时表示除排除项之外的所有端口
+type PortSet struct {
+	bits    *[1024]uint64
+	exclude *[1024]uint64
+}
+
+func parsePort(s string) (uint16, error) {
+	port, err := strconv.ParseUint(strings.TrimSpace(s), 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port: %q", s)
+	}
+	return uint16(port), nil
+}
+
+func ParsePortSet(entries ...string) (PortSet, error) {
+	var include, exclude [1024]uint64
+	hasInclude, hasExclude := false, false
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		bits := &include
+		if strings.HasPrefix(entry, "!") {
+			bits = &exclude
+			entry = entry[1:]
+			hasExclude = true
+		} else {
+			hasInclude = true
+		}
+		from, to := entry, entry
+		if dash := strings.IndexRune(entry, '-'); dash != -1 {
+			from, to = entry[:dash], entry[dash+1:]
+		}
+		fromPort, err := parsePort(from)
+		if err != nil {
+			return PortSet{}, err
+		}
+		toPort, err := parsePort(to)
+		if err != nil {
+			return PortSet{}, err
+		}
+		if toPort < fromPort {
+			return PortSet{}, fmt.Errorf("invalid port range: %q", entry)
+		}
+		for port := uint32(fromPort); port <= uint32(toPort); port++ {
+			bits[port/64] |= 1 << (port % 64)
+		}
+	}
+	if !hasInclude && hasExclude {
+		for i := range include {
+			include[i] = ^uint64(0)
+		}
+	}
+	for i := range include {
+		include[i] &^= exclude[i]
+	}
+	return PortSet{bits: &include, exclude: &exclude}, nil
+}
+
+// AddPorts 加入单个端口，用于与 uint16 列表合并，排除项仍然优先
+func (s *PortSet) AddPorts(ports ...uint16) {
+	if s.bits == nil {
+		s.bits = &[1024]uint64{}
+		s.exclude = &[1024]uint64{}
+	}
+	for _, port := range ports {
+		s.bits[port/64] |= (1 << (port % 64)) &^ s.exclude[port/64]
+	}
+}
+
+func (s PortSet) Contains(port uint16) bool {
+	return s.bits != nil && s.bits[port/64]&(1<<(port%64)) != 0
+}
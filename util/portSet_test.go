@@ -0,0 +1,68 @@
+package util
+
+import "testing"
+
+func TestParsePortSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		wantErr bool
+		in      []uint16
+		out     []uint16
+	}{
+		{"empty", nil, false, nil, []uint16{0, 80}},
+		{"single ports", []string{"80", " 443 "}, false, []uint16{80, 443}, []uint16{81, 8080}},
+		{"range", []string{"8000-8999"}, false, []uint16{8000, 8500, 8999}, []uint16{7999, 9000}},
+		{"full range", []string{"0-65535"}, false, []uint16{0, 65535}, nil},
+		{"exclusion", []string{"8000-8999", "!8080"}, false, []uint16{8081}, []uint16{8080, 80}},
+		{"only exclusions", []string{"!22", "!23-25"}, false, []uint16{0, 26, 65535}, []uint16{22, 24, 25}},
+		{"invalid port", []string{"65536"}, true, nil, nil},
+		{"not a number", []string{"http"}, true, nil, nil},
+		{"reversed range", []string{"9000-8000"}, true, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := ParsePortSet(tt.entries...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePortSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, port := range tt.in {
+				if !set.Contains(port) {
+					t.Errorf("Contains(%d) = false, want true", port)
+				}
+			}
+			for _, port := range tt.out {
+				if set.Contains(port) {
+					t.Errorf("Contains(%d) = true, want false", port)
+				}
+			}
+		})
+	}
+}
+
+func TestPortSetAddPorts(t *testing.T) {
+	set, err := ParsePortSet("!8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.AddPorts(80, 8080)
+	tests := []struct {
+		port uint16
+		want bool
+	}{
+		{80, true},
+		// 排除项优先
+		{8080, false},
+		{443, true},
+	}
+	for _, tt := range tests {
+		if got := set.Contains(tt.port); got != tt.want {
+			t.Errorf("Contains(%d) = %v, want %v", tt.port, got, tt.want)
+		}
+	}
+	var zero PortSet
+	zero.AddPorts(80)
+	if !zero.Contains(80) || zero.Contains(81) {
+		t.Error("AddPorts on zero PortSet")
+	}
+}
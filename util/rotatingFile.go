@@ -0,0 +1,128 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// RotatingFile 是一个按大小滚动的日志文件，实现了 io.Writer
+//
+// 当前文件超过 MaxSize 或者打开超过 MaxAge 时，file -> file.1 -> file.2 ... 依次后移，最多保留 MaxBackups 个旧文件
+type RotatingFile struct {
+	Path string
+	// 单个文件的最大字节数，0 表示不滚动
+	MaxSize int64
+	// 保留的旧文件数量，0 表示不保留
+	MaxBackups int
+	// 当前文件从打开起经过此时长后，下一次写入前滚动，0 表示不按时间滚动；
+	// 进程启动时已经存在的文件从本次打开时开始计时
+	MaxAge time.Duration
+	lock   sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	// 当前时间，为空时使用 time.Now
+	now func() time.Time
+}
+
+func NewRotatingFile(path string, maxSize int64, maxBackups int) *RotatingFile {
+	return &RotatingFile{
+		Path:       path,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+	}
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = f.currentTime()
+	return nil
+}
+
+func (f *RotatingFile) currentTime() time.Time {
+	if f.now == nil {
+		return time.Now()
+	}
+	return f.now()
+}
+
+// 写入 n 个字节前是否需要滚动，空文件不滚动
+func (f *RotatingFile) shouldRotate(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.MaxSize > 0 && f.size+int64(n) > f.MaxSize {
+		return true
+	}
+	return f.MaxAge > 0 && f.currentTime().Sub(f.opened) >= f.MaxAge
+}
+
+func (f *RotatingFile) rotate() error {
+	if f.file != nil {
+		_ = f.file.Close()
+		f.file = nil
+	}
+	if f.MaxBackups > 0 {
+		for i := f.MaxBackups - 1; i > 0; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", f.Path, i), fmt.Sprintf("%s.%d", f.Path, i+1))
+		}
+		if err := os.Rename(f.Path, f.Path+".1"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return f.open()
+}
+
+func (f *RotatingFile) Write(bs []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.shouldRotate(len(bs)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(bs)
+	f.size += int64(n)
+	return n, err
+}
+
+// Reopen 关闭并重新打开文件，用于配合外部的日志滚动工具
+func (f *RotatingFile) Reopen() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file != nil {
+		_ = f.file.Close()
+		f.file = nil
+	}
+	return f.open()
+}
+
+func (f *RotatingFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
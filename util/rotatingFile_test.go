@@ -0,0 +1,139 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 读取 path 及其旧文件 path.1、path.2 ... 的内容，不存在的文件为空字符串
+func readRotated(t *testing.T, path string, backups int) []string {
+	t.Helper()
+	contents := make([]string, backups+1)
+	for i := range contents {
+		name := path
+		if i > 0 {
+			name = path + "." + strconv.Itoa(i)
+		}
+		bs, err := os.ReadFile(name)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		contents[i] = string(bs)
+	}
+	return contents
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxSize    int64
+		maxBackups int
+		writes     []string
+		// 当前文件和各个旧文件的内容
+		want []string
+	}{
+		{"no limit", 0, 2, []string{"aaaa", "bbbb", "cccc"}, []string{"aaaabbbbcccc", "", ""}},
+		{"fits", 8, 2, []string{"aaaa", "bbbb"}, []string{"aaaabbbb", "", ""}},
+		{"rotates", 8, 2, []string{"aaaa", "bbbb", "cccc"}, []string{"cccc", "aaaabbbb", ""}},
+		{"shifts backups", 4, 2, []string{"aaaa", "bbbb", "cccc"}, []string{"cccc", "bbbb", "aaaa"}},
+		{"drops oldest", 4, 2, []string{"aaaa", "bbbb", "cccc", "dddd"}, []string{"dddd", "cccc", "bbbb"}},
+		{"no backups", 4, 0, []string{"aaaa", "bbbb"}, []string{"bbbb"}},
+		{"oversized write to empty file", 4, 1, []string{"aaaaaaaa", "bb"}, []string{"bb", "aaaaaaaa"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "access.log")
+			f := NewRotatingFile(path, tt.maxSize, tt.maxBackups)
+			defer func() {
+				_ = f.Close()
+			}()
+			for _, s := range tt.writes {
+				if n, err := f.Write([]byte(s)); err != nil || n != len(s) {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+			}
+			got := readRotated(t, path, tt.maxBackups)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("files = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	type write struct {
+		after time.Duration
+		s     string
+	}
+	tests := []struct {
+		name   string
+		maxAge time.Duration
+		writes []write
+		want   []string
+	}{
+		{"no limit", 0, []write{{0, "a"}, {48 * time.Hour, "b"}}, []string{"ab", "", ""}},
+		{"within age", time.Hour, []write{{0, "a"}, {59 * time.Minute, "b"}}, []string{"ab", "", ""}},
+		{"rotates", time.Hour, []write{{0, "a"}, {time.Hour, "b"}, {90 * time.Minute, "c"}}, []string{"bc", "a", ""}},
+		{"age counts from rotation", time.Hour, []write{{0, "a"}, {time.Hour, "b"}, {2 * time.Hour, "c"}}, []string{"c", "b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "access.log")
+			now := start
+			f := NewRotatingFile(path, 0, 2)
+			f.MaxAge = tt.maxAge
+			f.now = func() time.Time {
+				return now
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			for _, w := range tt.writes {
+				now = start.Add(w.after)
+				if _, err := f.Write([]byte(w.s)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := readRotated(t, path, 2)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("files = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotatingFileAppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := NewRotatingFile(path, 6, 1)
+	defer func() {
+		_ = f.Close()
+	}()
+	for _, s := range []string{"new", "next"} {
+		if _, err := f.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readRotated(t, path, 1); got[0] != "next" || got[1] != "oldnew" {
+		t.Errorf("files = %q, want [next oldnew]", got)
+	}
+	if err := os.Rename(path, path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("reopened")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readRotated(t, path, 0); got[0] != "reopened" {
+		t.Errorf("after Reopen: %q, want reopened", got[0])
+	}
+}